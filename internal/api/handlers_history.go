@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+const maxHistoryBuckets = 10000
+
+// Steps picked when none is given, the smallest one that keeps the
+// number of buckets under defaultHistoryBuckets gets used
+var historyStepCandidates = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	3 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+}
+
+const defaultHistoryBuckets = 300
+
+var historyAggregations = map[string]func(*database.HistoryBucket) float64{
+	"avg":  (*database.HistoryBucket).Avg,
+	"min":  func(b *database.HistoryBucket) float64 { return b.Min },
+	"max":  func(b *database.HistoryBucket) float64 { return b.Max },
+	"last": func(b *database.HistoryBucket) float64 { return b.Last },
+}
+
+type historyPoint struct {
+	Time time.Time `json:"time"`
+	// Nil when nothing was recorded within the bucket
+	Value *float64 `json:"value"`
+	Count int64    `json:"count"`
+}
+
+// handleHistory returns the recorded values of a metric grouped into aligned
+// buckets, as JSON or as CSV when requested through format=csv or the Accept header
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.requireDatabase(w) {
+		return
+	}
+
+	query := r.URL.Query()
+	historyQuery := database.HistoryQuery{
+		WidgetID:   query.Get("widget"),
+		MetricName: query.Get("metric"),
+		To:         time.Now(),
+	}
+
+	if historyQuery.WidgetID == "" || historyQuery.MetricName == "" {
+		http.Error(w, "Both 'widget' and 'metric' are required", http.StatusBadRequest)
+		return
+	}
+
+	for param, target := range map[string]*time.Time{"from": &historyQuery.From, "to": &historyQuery.To} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid '%s', must be an RFC 3339 timestamp", param), http.StatusBadRequest)
+			return
+		}
+		*target = parsed
+	}
+
+	if historyQuery.From.IsZero() {
+		historyQuery.From = historyQuery.To.Add(-24 * time.Hour)
+	}
+
+	if !historyQuery.From.Before(historyQuery.To) {
+		http.Error(w, "'from' must be before 'to'", http.StatusBadRequest)
+		return
+	}
+
+	span := historyQuery.To.Sub(historyQuery.From)
+
+	if stepStr := query.Get("step"); stepStr != "" {
+		step, err := parseHistoryStep(stepStr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid 'step', %v", err), http.StatusBadRequest)
+			return
+		}
+		historyQuery.Step = step
+	} else {
+		historyQuery.Step = historyStepCandidates[len(historyStepCandidates)-1]
+		for _, candidate := range historyStepCandidates {
+			if span/candidate <= defaultHistoryBuckets {
+				historyQuery.Step = candidate
+				break
+			}
+		}
+	}
+
+	// The first bucket starts at the step boundary before 'from', so it can add one to the count
+	start := alignHistoryStart(historyQuery.From, historyQuery.Step)
+	if (historyQuery.To.Sub(start)+historyQuery.Step-1)/historyQuery.Step > maxHistoryBuckets {
+		http.Error(w, fmt.Sprintf("Too many buckets, use a larger 'step' or a smaller range to get at most %d", maxHistoryBuckets), http.StatusBadRequest)
+		return
+	}
+
+	agg := query.Get("agg")
+	if agg == "" {
+		agg = "avg"
+	}
+
+	aggregate, ok := historyAggregations[agg]
+	if !ok {
+		http.Error(w, "Invalid 'agg', must be one of avg, min, max or last", http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := s.db.History.Query(r.Context(), historyQuery)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve history: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Empty buckets are included so that gaps show up as such in charts
+	points := make([]historyPoint, 0)
+	step := historyQuery.Step
+	seconds := int64(step.Seconds())
+	next := 0
+	for ; start.Before(historyQuery.To); start = start.Add(step) {
+		point := historyPoint{Time: start}
+
+		if next < len(buckets) && buckets[next].Start.Equal(start) {
+			value := aggregate(&buckets[next])
+			point.Value = &value
+			point.Count = buckets[next].Count
+			next++
+		}
+
+		points = append(points, point)
+	}
+
+	if query.Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		writeHistoryCSV(w, points)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encodeJSON(w, map[string]interface{}{
+		"widget": historyQuery.WidgetID,
+		"metric": historyQuery.MetricName,
+		"step":   seconds,
+		"agg":    agg,
+		"points": points,
+	})
+}
+
+func writeHistoryCSV(w http.ResponseWriter, points []historyPoint) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"time", "value", "count"})
+
+	for _, point := range points {
+		value := ""
+		if point.Value != nil {
+			value = strconv.FormatFloat(*point.Value, 'f', -1, 64)
+		}
+
+		writer.Write([]string{point.Time.Format(time.RFC3339), value, strconv.FormatInt(point.Count, 10)})
+	}
+
+	writer.Flush()
+}
+
+func alignHistoryStart(from time.Time, step time.Duration) time.Time {
+	seconds := int64(step.Seconds())
+	return time.Unix(from.Unix()/seconds*seconds, 0).UTC()
+}
+
+var errInvalidHistoryStep = errors.New("must be a duration such as 30s, 5m, 1h or 1d")
+
+// Accepts Go durations as well as a number of days such as 7d
+func parseHistoryStep(value string) (time.Duration, error) {
+	var step time.Duration
+
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, errInvalidHistoryStep
+		}
+		step = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, errInvalidHistoryStep
+		}
+		step = parsed
+	}
+
+	if step < time.Second || step%time.Second != 0 {
+		return 0, errors.New("must be a whole number of seconds")
+	}
+
+	return step, nil
+}
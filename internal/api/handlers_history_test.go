@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+func TestHistoryBucketLimit(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := []database.MetricSample{{Name: "cpu", Value: 42}}
+	if err := db.History.Record(t.Context(), "server", "server-stats", samples, from.Add(90*time.Second)); err != nil {
+		t.Fatalf("Failed to record history: %v", err)
+	}
+
+	server := NewServer(db, &Config{})
+
+	request := func(from time.Time) *httptest.ResponseRecorder {
+		query := url.Values{
+			"widget": {"server"},
+			"metric": {"cpu"},
+			"step":   {"1m"},
+			"from":   {from.Format(time.RFC3339)},
+			"to":     {from.Add(maxHistoryBuckets * time.Minute).Format(time.RFC3339)},
+		}
+
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/history?"+query.Encode(), nil))
+		return recorder
+	}
+
+	response := request(from)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected exactly %d buckets to be allowed, got %d: %s", maxHistoryBuckets, response.Code, response.Body.String())
+	}
+
+	var body struct {
+		Points []historyPoint `json:"points"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(body.Points) != maxHistoryBuckets {
+		t.Errorf("Expected %d points, got %d", maxHistoryBuckets, len(body.Points))
+	}
+
+	if point := body.Points[1]; point.Value == nil || *point.Value != 42 {
+		t.Errorf("Expected the recorded value in the second bucket, got %+v", point)
+	}
+
+	// Starting off a step boundary adds the partial bucket at the start
+	if response := request(from.Add(30 * time.Second)); response.Code != http.StatusBadRequest {
+		t.Errorf("Expected a range that needs %d buckets once aligned to be rejected, got %d", maxHistoryBuckets+1, response.Code)
+	}
+}
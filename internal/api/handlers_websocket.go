@@ -3,20 +3,13 @@ package api
 import (
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 
 	wsinternal "github.com/glanceapp/glance/internal/websocket"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// TODO: Implement proper origin checking based on configuration
-		return true
-	},
-}
-
 // handleWebSocket handles WebSocket upgrade requests
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	if s.wsHub == nil {
@@ -24,6 +17,12 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     s.isAllowedWebSocketOrigin,
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -37,8 +36,8 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	go client.ReadPump()
 }
 
-// handleMetrics returns system and widget performance metrics
-func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+// handleMetricsWidget returns metrics for a specific widget
+func (s *Server) handleMetricsWidget(w http.ResponseWriter, r *http.Request, widgetID string) {
 	if s.metricsCollector == nil {
 		http.Error(w, "Metrics service not available", http.StatusServiceUnavailable)
 		return
@@ -49,33 +48,34 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metrics := map[string]interface{}{
-		"system":  s.metricsCollector.GetSystemMetrics(),
-		"widgets": s.metricsCollector.GetAllMetrics(),
+	metrics := s.metricsCollector.GetMetrics(widgetID)
+	if metrics == nil {
+		http.Error(w, "Widget not found", http.StatusNotFound)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	encodeJSON(w, metrics)
 }
 
-// handleMetricsWidget returns metrics for a specific widget
-func (s *Server) handleMetricsWidget(w http.ResponseWriter, r *http.Request, widgetID string) {
-	if s.metricsCollector == nil {
-		http.Error(w, "Metrics service not available", http.StatusServiceUnavailable)
-		return
+// isAllowedWebSocketOrigin only lets browsers open a connection from the same
+// host or from one of the origins listed explicitly in the CORS origins. Browsers
+// always send cookies along with the handshake, so "*" isn't enough.
+func (s *Server) isAllowedWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
 	}
 
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
 	}
 
-	metrics := s.metricsCollector.GetMetrics(widgetID)
-	if metrics == nil {
-		http.Error(w, "Widget not found", http.StatusNotFound)
-		return
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return true
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	encodeJSON(w, metrics)
+	_, credentials := s.allowedOrigin(origin)
+	return credentials
 }
@@ -1,27 +1,33 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/glanceapp/glance/internal/database"
+	"github.com/glanceapp/glance/internal/metrics"
 	"github.com/glanceapp/glance/internal/websocket"
 )
 
 // MetricsCollector interface for metrics collection
 type MetricsCollector interface {
 	GetSystemMetrics() map[string]interface{}
-	GetAllMetrics() map[string]interface{}
-	GetMetrics(widgetID string) interface{}
+	GetAllMetrics() map[string]*metrics.WidgetMetrics
+	GetMetrics(widgetID string) *metrics.WidgetMetrics
 }
 
 // Server represents the API server with all handlers and middleware
 type Server struct {
 	db               *database.DB
 	mux              *http.ServeMux
+	handler          http.Handler
 	config           *Config
+	rateLimiter      *RateLimiter
 	wsHub            *websocket.Hub
 	metricsCollector MetricsCollector
 }
@@ -32,20 +38,43 @@ type Config struct {
 	RateLimitRPM     int
 	CORSEnabled      bool
 	CORSOrigins      []string
+	// ClientAddress resolves the address used for rate limiting, defaults
+	// to RateLimiter.GetClientIP when not set
+	ClientAddress func(*http.Request) string
+	// Shared between the servers created on config reloads so that clients
+	// don't get a new budget with every reload, a new one is used when not set
+	RateLimiter *RateLimiter
 }
 
-// NewServer creates a new API server instance
+// NewServer creates a new API server instance, db may be nil in which
+// case endpoints that require the database respond with 503
 func NewServer(db *database.DB, config *Config) *Server {
 	s := &Server{
-		db:     db,
-		mux:    http.NewServeMux(),
-		config: config,
+		db:          db,
+		mux:         http.NewServeMux(),
+		config:      config,
+		rateLimiter: config.RateLimiter,
+	}
+
+	if s.rateLimiter == nil {
+		s.rateLimiter = NewRateLimiter()
+	}
+
+	if s.config.ClientAddress == nil {
+		s.config.ClientAddress = s.rateLimiter.GetClientIP
 	}
 
 	s.setupRoutes()
+	s.handler = s.buildMiddlewareChain()
 	return s
 }
 
+// Handle registers an additional handler on the API router, letting the host
+// application expose endpoints that depend on its own state
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
 // SetWebSocketHub sets the WebSocket hub for real-time communication
 func (s *Server) SetWebSocketHub(hub *websocket.Hub) {
 	s.wsHub = hub
@@ -68,12 +97,12 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/api/v1/metrics", s.handleMetrics)
 	s.mux.HandleFunc("/api/v1/metrics/widgets/", s.routeMetricsEndpoints)
 
-	// Search endpoint
-	s.mux.HandleFunc("/api/v1/search", s.handleSearch)
-
 	// Activity endpoint
 	s.mux.HandleFunc("/api/v1/activity", s.handleActivity)
 
+	// History endpoint
+	s.mux.HandleFunc("/api/v1/history", s.handleHistory)
+
 	// Widget data endpoints
 	s.mux.HandleFunc("/api/v1/widgets/", s.routeWidgetEndpoints)
 }
@@ -132,8 +161,22 @@ func (s *Server) routeMetricsEndpoints(w http.ResponseWriter, r *http.Request) {
 	s.handleMetricsWidget(w, r, widgetID)
 }
 
+// requireDatabase responds with 503 and returns false when the database is disabled
+func (s *Server) requireDatabase(w http.ResponseWriter) bool {
+	if s.db == nil {
+		http.Error(w, "Database is not enabled", http.StatusServiceUnavailable)
+		return false
+	}
+
+	return true
+}
+
 // handleWidgetData handles GET and POST for all widget data
 func (s *Server) handleWidgetData(w http.ResponseWriter, r *http.Request, widgetID string) {
+	if !s.requireDatabase(w) {
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		s.handleGetAllWidgetData(w, r, widgetID)
@@ -146,6 +189,10 @@ func (s *Server) handleWidgetData(w http.ResponseWriter, r *http.Request, widget
 
 // handleWidgetDataKey handles GET and DELETE for specific widget data
 func (s *Server) handleWidgetDataKey(w http.ResponseWriter, r *http.Request, widgetID, key string) {
+	if !s.requireDatabase(w) {
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		s.handleGetWidgetData(w, r, widgetID, key)
@@ -158,7 +205,7 @@ func (s *Server) handleWidgetDataKey(w http.ResponseWriter, r *http.Request, wid
 
 // handleGetAllWidgetData retrieves all data for a widget
 func (s *Server) handleGetAllWidgetData(w http.ResponseWriter, r *http.Request, widgetID string) {
-	data, err := s.db.GetAllWidgetData(widgetID)
+	data, err := s.db.WidgetData.List(r.Context(), widgetID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to retrieve widget data: %v", err), http.StatusInternalServerError)
 		return
@@ -168,12 +215,15 @@ func (s *Server) handleGetAllWidgetData(w http.ResponseWriter, r *http.Request,
 	json.NewEncoder(w).Encode(data)
 }
 
-// handleSaveWidgetData saves a piece of widget data
+// handleSaveWidgetData saves a piece of widget data. When the payload includes a revision
+// the save only succeeds if it matches the stored one, otherwise 409 is returned along
+// with the current data so that the client can merge its changes and try again.
 func (s *Server) handleSaveWidgetData(w http.ResponseWriter, r *http.Request, widgetID string) {
 	var payload struct {
-		Key   string      `json:"key"`
-		Value interface{} `json:"value"`
-		Type  string      `json:"type,omitempty"`
+		Key      string      `json:"key"`
+		Value    interface{} `json:"value"`
+		Type     string      `json:"type,omitempty"`
+		Revision *int64      `json:"revision,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -192,22 +242,57 @@ func (s *Server) handleSaveWidgetData(w http.ResponseWriter, r *http.Request, wi
 		widgetType = "unknown"
 	}
 
-	if err := s.db.SaveWidgetData(widgetID, widgetType, payload.Key, payload.Value); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to save widget data: %v", err), http.StatusInternalServerError)
-		return
+	var revision int64
+
+	if payload.Revision != nil {
+		var err error
+		revision, err = s.db.WidgetData.SaveIfRevision(r.Context(), widgetID, widgetType, payload.Key, payload.Value, *payload.Revision)
+
+		if errors.Is(err, database.ErrRevisionConflict) {
+			current, err := s.db.WidgetData.Get(r.Context(), widgetID, payload.Key)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, fmt.Sprintf("Failed to retrieve widget data: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			if current == nil {
+				current = &database.WidgetData{WidgetID: widgetID, DataKey: payload.Key}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(current)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to save widget data: %v", err), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		if err := s.db.WidgetData.Save(r.Context(), widgetID, widgetType, payload.Key, payload.Value); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to save widget data: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if saved, err := s.db.WidgetData.Get(r.Context(), widgetID, payload.Key); err == nil {
+			revision = saved.Revision
+		}
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "created",
+		"status":    "created",
 		"widget_id": widgetID,
-		"key": payload.Key,
+		"key":       payload.Key,
+		"revision":  revision,
 	})
 }
 
 // handleGetWidgetData retrieves a specific piece of widget data
 func (s *Server) handleGetWidgetData(w http.ResponseWriter, r *http.Request, widgetID, key string) {
-	data, err := s.db.GetWidgetData(widgetID, key)
+	data, err := s.db.WidgetData.Get(r.Context(), widgetID, key)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Widget data not found: %v", err), http.StatusNotFound)
 		return
@@ -219,7 +304,7 @@ func (s *Server) handleGetWidgetData(w http.ResponseWriter, r *http.Request, wid
 
 // handleDeleteWidgetData deletes a specific piece of widget data
 func (s *Server) handleDeleteWidgetData(w http.ResponseWriter, r *http.Request, widgetID, key string) {
-	if err := s.db.DeleteWidgetData(widgetID, key); err != nil {
+	if err := s.db.WidgetData.Delete(r.Context(), widgetID, key); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to delete widget data: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -261,18 +346,50 @@ func encodeJSON(w http.ResponseWriter, data interface{}) {
 
 // ServeHTTP implements http.Handler interface
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Apply middleware chain
+	start := time.Now()
+	s.handler.ServeHTTP(w, r)
+	s.TrackRequest(time.Since(start))
+}
+
+// buildMiddlewareChain wraps the router with the middleware enabled in the config
+func (s *Server) buildMiddlewareChain() http.Handler {
 	handler := http.Handler(s.mux)
 
+	if s.config.RateLimitEnabled {
+		handler = s.rateLimitMiddleware(handler)
+	}
+
+	// CORS goes on the outside so that preflight requests are never rate limited
 	if s.config.CORSEnabled {
 		handler = s.corsMiddleware(handler)
 	}
 
-	if s.config.RateLimitEnabled {
-		handler = s.rateLimitMiddleware(handler)
+	return handler
+}
+
+// allowedOrigin returns the value of Access-Control-Allow-Origin for the origin,
+// along with whether credentials may be sent. Only origins that are listed
+// explicitly get credentials, "*" lets anyone make requests without them since
+// otherwise any website could act with the session of the user
+func (s *Server) allowedOrigin(origin string) (string, bool) {
+	if !s.config.CORSEnabled {
+		return "", false
+	}
+
+	wildcard := false
+	for _, allowedOrigin := range s.config.CORSOrigins {
+		if allowedOrigin == "*" {
+			wildcard = true
+		} else if strings.EqualFold(allowedOrigin, origin) {
+			return origin, true
+		}
+	}
+
+	if wildcard {
+		return "*", false
 	}
 
-	handler.ServeHTTP(w, r)
+	return "", false
 }
 
 // corsMiddleware adds CORS headers to responses
@@ -280,24 +397,19 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
 
-		// Check if origin is allowed
-		allowed := false
-		for _, allowedOrigin := range s.config.CORSOrigins {
-			if allowedOrigin == "*" || allowedOrigin == origin {
-				allowed = true
-				break
+		if origin != "" {
+			if allowed, credentials := s.allowedOrigin(origin); allowed != "" {
+				w.Header().Set("Access-Control-Allow-Origin", allowed)
+				if credentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+				w.Header().Set("Access-Control-Max-Age", "3600")
+				w.Header().Add("Vary", "Origin")
 			}
 		}
 
-		if allowed {
-			if origin != "" {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-			}
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Max-Age", "3600")
-		}
-
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -307,11 +419,18 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// rateLimitMiddleware applies rate limiting to requests
+// rateLimitMiddleware applies per client rate limiting to requests
 func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	maxRequests := float64(s.config.RateLimitRPM)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// For now, implement a simple pass-through
-		// Rate limiting will be enhanced in Phase 2
+		if !s.rateLimiter.Allow(s.config.ClientAddress(r), maxRequests) {
+			rateLimitedCount.Add(1)
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWildcardCORSOriginNeverAllowsCredentials(t *testing.T) {
+	server := NewServer(nil, &Config{CORSEnabled: true, CORSOrigins: []string{"*", "https://dashboard.example.com"}})
+
+	request := func(origin string) http.Header {
+		request := httptest.NewRequest(http.MethodOptions, "/api/v1/alerts", nil)
+		request.Header.Set("Origin", origin)
+
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder.Header()
+	}
+
+	headers := request("https://evil.example.com")
+	if origin := headers.Get("Access-Control-Allow-Origin"); origin != "*" {
+		t.Errorf("Expected any origin to be allowed through the wildcard, got %q", origin)
+	}
+
+	if credentials := headers.Get("Access-Control-Allow-Credentials"); credentials != "" {
+		t.Errorf("Expected the wildcard not to allow credentials, got %q", credentials)
+	}
+
+	headers = request("https://dashboard.example.com")
+	if headers.Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" || headers.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected an explicitly listed origin to be allowed with credentials, got %v", headers)
+	}
+
+	websocketRequest := httptest.NewRequest(http.MethodGet, "http://glance.local/api/v1/ws", nil)
+	websocketRequest.Header.Set("Origin", "https://evil.example.com")
+	if server.isAllowedWebSocketOrigin(websocketRequest) {
+		t.Error("Expected the wildcard not to allow opening a WebSocket connection")
+	}
+}
@@ -1,58 +1,96 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 )
 
+// ActivityRepository stores the events shown in the activity log
+type ActivityRepository struct {
+	conn *sql.DB
+}
+
 type ActivityLog struct {
-	ID        int64
-	EventType string
-	WidgetID  string
-	UserID    string
-	Details   map[string]interface{}
-	IPAddress string
-	CreatedAt time.Time
+	ID        int64                  `json:"id"`
+	EventType string                 `json:"event_type"`
+	WidgetID  string                 `json:"widget_id,omitempty"`
+	UserID    string                 `json:"user_id,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	IPAddress string                 `json:"ip_address,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// ActivityFilter narrows down the entries returned by List, zero values are ignored
+type ActivityFilter struct {
+	EventTypes []string
+	WidgetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
 }
 
-func (db *DB) LogActivity(eventType, widgetID, userID, ipAddress string, details map[string]interface{}) error {
+// Log records an event
+func (r *ActivityRepository) Log(ctx context.Context, eventType, widgetID, userID, ipAddress string, details map[string]interface{}) error {
 	detailsJSON, _ := json.Marshal(details)
 	query := `
 		INSERT INTO activity_log (event_type, widget_id, user_id, details, ip_address, created_at)
 		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 	`
-	_, err := db.conn.Exec(query, eventType, widgetID, userID, string(detailsJSON), ipAddress)
+	_, err := r.conn.ExecContext(ctx, query, eventType, widgetID, userID, string(detailsJSON), ipAddress)
 	return err
 }
 
-func (db *DB) GetActivityLog(since time.Time, eventTypes []string, limit int) ([]ActivityLog, error) {
+// List returns the entries matching the filter, most recent first
+func (r *ActivityRepository) List(ctx context.Context, filter ActivityFilter) ([]ActivityLog, error) {
 	query := `
-		SELECT id, event_type, widget_id, user_id, details, ip_address, created_at
+		SELECT id, event_type, COALESCE(widget_id, ''), COALESCE(user_id, ''), COALESCE(details, ''), COALESCE(ip_address, ''), created_at
 		FROM activity_log
-		WHERE created_at >= ?
+		WHERE 1 = 1
 	`
-	args := []interface{}{since}
+	args := []interface{}{}
 
-	if len(eventTypes) > 0 {
-		placeholders := make([]string, len(eventTypes))
-		for i, et := range eventTypes {
+	if len(filter.EventTypes) > 0 {
+		placeholders := make([]string, len(filter.EventTypes))
+		for i, et := range filter.EventTypes {
 			placeholders[i] = "?"
 			args = append(args, et)
 		}
 		query += " AND event_type IN (" + strings.Join(placeholders, ",") + ")"
 	}
 
-	query += " ORDER BY created_at DESC LIMIT ?"
-	args = append(args, limit)
+	if filter.WidgetID != "" {
+		query += " AND widget_id = ?"
+		args = append(args, filter.WidgetID)
+	}
+
+	if !filter.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.Since.UTC())
+	}
 
-	rows, err := db.conn.Query(query, args...)
+	if !filter.Until.IsZero() {
+		query += " AND created_at <= ?"
+		args = append(args, filter.Until.UTC())
+	}
+
+	query += " ORDER BY created_at DESC, id DESC"
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.conn.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("querying activity log: %w", err)
 	}
 	defer rows.Close()
 
-	var logs []ActivityLog
+	logs := []ActivityLog{}
 	for rows.Next() {
 		var log ActivityLog
 		var detailsJSON string
@@ -60,9 +98,16 @@ func (db *DB) GetActivityLog(since time.Time, eventTypes []string, limit int) ([
 		if err != nil {
 			return nil, err
 		}
-		json.Unmarshal([]byte(detailsJSON), &log.Details)
+		if detailsJSON != "" {
+			json.Unmarshal([]byte(detailsJSON), &log.Details)
+		}
 		logs = append(logs, log)
 	}
 
 	return logs, rows.Err()
 }
+
+// DeleteOlderThan removes entries recorded before the given time and returns how many were removed
+func (r *ActivityRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	return execCountingRows(ctx, r.conn, "DELETE FROM activity_log WHERE created_at < ?", before.UTC())
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListActivityFilters(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+
+	entries := []struct{ eventType, widgetID string }{
+		{"login", ""},
+		{"widget_update_failed", "rss-1"},
+		{"widget_update_failed", "rss-2"},
+		{"widget_update_recovered", "rss-1"},
+	}
+
+	for _, entry := range entries {
+		if err := db.Activity.Log(ctx, entry.eventType, entry.widgetID, "", "", map[string]interface{}{"message": entry.eventType}); err != nil {
+			t.Fatalf("Failed to log activity: %v", err)
+		}
+	}
+
+	logs, err := db.Activity.List(ctx, ActivityFilter{WidgetID: "rss-1"})
+	if err != nil {
+		t.Fatalf("Failed to get activity log: %v", err)
+	}
+
+	if len(logs) != 2 || logs[0].EventType != "widget_update_recovered" {
+		t.Fatalf("Expected the 2 entries of rss-1 with the most recent first, got %+v", logs)
+	}
+
+	logs, err = db.Activity.List(ctx, ActivityFilter{EventTypes: []string{"widget_update_failed", "login"}, Limit: 2})
+	if err != nil {
+		t.Fatalf("Failed to get activity log: %v", err)
+	}
+
+	if len(logs) != 2 || logs[0].WidgetID != "rss-2" {
+		t.Fatalf("Expected the 2 most recent matching entries, got %+v", logs)
+	}
+
+	if logs[0].Details["message"] != "widget_update_failed" {
+		t.Errorf("Expected details to be decoded, got %v", logs[0].Details)
+	}
+
+	logs, err = db.Activity.List(ctx, ActivityFilter{Until: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("Failed to get activity log: %v", err)
+	}
+
+	if len(logs) != 0 {
+		t.Fatalf("Expected no entries before an hour ago, got %d", len(logs))
+	}
+
+	if _, err := db.Activity.DeleteOlderThan(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to delete activity: %v", err)
+	}
+
+	if logs, _ := db.Activity.List(ctx, ActivityFilter{}); len(logs) != 0 {
+		t.Fatalf("Expected all entries to be deleted, got %d", len(logs))
+	}
+}
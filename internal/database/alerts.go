@@ -0,0 +1,380 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AlertRepository stores the alert rules set up on widgets along with their state
+type AlertRepository struct {
+	conn *sql.DB
+}
+
+const (
+	// Alerts defined in the config file, they get replaced on every reload
+	AlertSourceConfig = "config"
+	// Alerts created through the API
+	AlertSourceAPI = "api"
+)
+
+type Alert struct {
+	ID                 int64     `json:"id"`
+	Name               string    `json:"name"`
+	Source             string    `json:"source"`
+	WidgetID           string    `json:"widget_id"`
+	ConditionType      string    `json:"condition_type"`
+	ConditionValue     string    `json:"condition_value"`
+	NotificationType   string    `json:"notification_type"`
+	NotificationTarget string    `json:"notification_target"`
+	Enabled            bool      `json:"enabled"`
+	LastTriggered      time.Time `json:"last_triggered,omitzero"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// AlertState is where a single subject of an alert is at, such as one of the sites of a monitor widget
+type AlertState struct {
+	AlertID   int64
+	Subject   string
+	Status    string
+	ChangedAt time.Time
+	// Zero when the alert has never fired for the subject
+	FiredAt      time.Time
+	LastNotified time.Time
+	// Whether a notification was sent the last time the alert fired
+	Notified bool
+	// Anything else that needs to be remembered between evaluations, such as the last seen version of a release
+	Detail string
+}
+
+// ErrAlertNameTaken is returned when creating an alert with the name of one that already exists
+var ErrAlertNameTaken = errors.New("an alert with that name already exists")
+
+const alertColumns = `id, name, source, widget_id, condition_type, condition_value, notification_type,
+	notification_target, enabled, last_triggered, created_at`
+
+// Create stores a new alert and sets its ID
+func (r *AlertRepository) Create(ctx context.Context, alert *Alert) error {
+	query := `
+	INSERT INTO alerts (name, source, widget_id, condition_type, condition_value, notification_type, notification_target, enabled)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.conn.ExecContext(
+		ctx,
+		query,
+		alert.Name,
+		alert.Source,
+		alert.WidgetID,
+		alert.ConditionType,
+		alert.ConditionValue,
+		alert.NotificationType,
+		alert.NotificationTarget,
+		alert.Enabled,
+	)
+	if err != nil {
+		return convertAlertError(err)
+	}
+
+	alert.ID, err = result.LastInsertId()
+	return err
+}
+
+// Get returns an alert or nil if it doesn't exist
+func (r *AlertRepository) Get(ctx context.Context, id int64) (*Alert, error) {
+	row := r.conn.QueryRowContext(ctx, "SELECT "+alertColumns+" FROM alerts WHERE id = ?", id)
+
+	alert, err := scanAlert(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return alert, err
+}
+
+// List returns the alerts of a widget, or of all widgets if widgetID is empty
+func (r *AlertRepository) List(ctx context.Context, widgetID string) ([]Alert, error) {
+	query := "SELECT " + alertColumns + " FROM alerts"
+	args := []any{}
+
+	if widgetID != "" {
+		query += " WHERE widget_id = ?"
+		args = append(args, widgetID)
+	}
+
+	return r.list(ctx, query+" ORDER BY id", args...)
+}
+
+// ListEnabled returns all enabled alerts
+func (r *AlertRepository) ListEnabled(ctx context.Context) ([]Alert, error) {
+	return r.list(ctx, "SELECT "+alertColumns+" FROM alerts WHERE enabled = 1 ORDER BY id")
+}
+
+func (r *AlertRepository) list(ctx context.Context, query string, args ...any) ([]Alert, error) {
+	rows, err := r.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := make([]Alert, 0)
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, *alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+// Update replaces the name, condition and notification of an alert, which
+// also forgets its state since it may not apply to the new condition
+func (r *AlertRepository) Update(ctx context.Context, alert *Alert) error {
+	err := inTransaction(ctx, r.conn, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			`
+			UPDATE alerts
+			SET name = ?, widget_id = ?, condition_type = ?, condition_value = ?, notification_type = ?, notification_target = ?, enabled = ?
+			WHERE id = ?
+			`,
+			alert.Name,
+			alert.WidgetID,
+			alert.ConditionType,
+			alert.ConditionValue,
+			alert.NotificationType,
+			alert.NotificationTarget,
+			alert.Enabled,
+			alert.ID,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM alert_states WHERE alert_id = ?", alert.ID)
+		return err
+	})
+
+	return convertAlertError(err)
+}
+
+// SetEnabled enables or disables an alert
+func (r *AlertRepository) SetEnabled(ctx context.Context, id int64, enabled bool) error {
+	_, err := r.conn.ExecContext(ctx, "UPDATE alerts SET enabled = ? WHERE id = ?", enabled, id)
+	return err
+}
+
+// MarkTriggered records when an alert last fired
+func (r *AlertRepository) MarkTriggered(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.conn.ExecContext(ctx, "UPDATE alerts SET last_triggered = ? WHERE id = ?", at.UTC(), id)
+	return err
+}
+
+// Delete removes an alert along with its state
+func (r *AlertRepository) Delete(ctx context.Context, id int64) error {
+	return inTransaction(ctx, r.conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM alert_states WHERE alert_id = ?", id); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, "DELETE FROM alerts WHERE id = ?", id)
+		return err
+	})
+}
+
+// ReplaceConfigAlerts makes the alerts from the config file match the given ones. Alerts
+// that are kept by name keep their ID, and their state unless their widget or condition
+// changed, the rest of the config alerts are deleted.
+// An alert whose name is taken by one created through the API is skipped and reported in
+// the returned error while the others are still replaced.
+func (r *AlertRepository) ReplaceConfigAlerts(ctx context.Context, alerts []Alert) error {
+	var skipped []string
+
+	err := inTransaction(ctx, r.conn, func(tx *sql.Tx) error {
+		names := make([]any, 0, len(alerts))
+
+		for i := range alerts {
+			alert := &alerts[i]
+
+			// The state of an alert no longer applies once what it watches changes, same as with Update
+			if _, err := tx.ExecContext(ctx, `
+			DELETE FROM alert_states WHERE alert_id IN (
+				SELECT id FROM alerts
+				WHERE name = ? AND source = ?
+				AND (widget_id IS NOT ? OR condition_type IS NOT ? OR condition_value IS NOT ?)
+			)
+			`,
+				alert.Name,
+				AlertSourceConfig,
+				alert.WidgetID,
+				alert.ConditionType,
+				alert.ConditionValue,
+			); err != nil {
+				return err
+			}
+
+			result, err := tx.ExecContext(ctx, `
+			INSERT INTO alerts (name, source, widget_id, condition_type, condition_value, notification_type, notification_target, enabled)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT(name) DO UPDATE SET
+				widget_id = excluded.widget_id,
+				condition_type = excluded.condition_type,
+				condition_value = excluded.condition_value,
+				notification_type = excluded.notification_type,
+				notification_target = excluded.notification_target,
+				enabled = 1
+			WHERE alerts.source = excluded.source
+			`,
+				alert.Name,
+				AlertSourceConfig,
+				alert.WidgetID,
+				alert.ConditionType,
+				alert.ConditionValue,
+				alert.NotificationType,
+				alert.NotificationTarget,
+			)
+			if err != nil {
+				return err
+			}
+
+			if affected, err := result.RowsAffected(); err != nil {
+				return err
+			} else if affected == 0 {
+				skipped = append(skipped, alert.Name)
+				continue
+			}
+
+			names = append(names, alert.Name)
+		}
+
+		condition := "source = ?"
+		args := []any{AlertSourceConfig}
+		if len(names) > 0 {
+			condition += " AND name NOT IN (" + strings.TrimSuffix(strings.Repeat("?,", len(names)), ",") + ")"
+			args = append(args, names...)
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM alert_states WHERE alert_id IN (SELECT id FROM alerts WHERE "+condition+")", args...); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, "DELETE FROM alerts WHERE "+condition, args...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(skipped) > 0 {
+		return fmt.Errorf("%w, skipped %s", ErrAlertNameTaken, strings.Join(skipped, ", "))
+	}
+
+	return nil
+}
+
+// ListStates returns the states of all alerts
+func (r *AlertRepository) ListStates(ctx context.Context) ([]AlertState, error) {
+	rows, err := r.conn.QueryContext(ctx, `
+	SELECT alert_id, subject, status, changed_at, fired_at, last_notified, notified, detail
+	FROM alert_states
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make([]AlertState, 0)
+	for rows.Next() {
+		var state AlertState
+		var firedAt, lastNotified sql.NullTime
+
+		if err := rows.Scan(
+			&state.AlertID,
+			&state.Subject,
+			&state.Status,
+			&state.ChangedAt,
+			&firedAt,
+			&lastNotified,
+			&state.Notified,
+			&state.Detail,
+		); err != nil {
+			return nil, err
+		}
+
+		state.FiredAt = firedAt.Time
+		state.LastNotified = lastNotified.Time
+		states = append(states, state)
+	}
+
+	return states, rows.Err()
+}
+
+// SaveState saves the state of an alert's subject, replacing the previous one
+func (r *AlertRepository) SaveState(ctx context.Context, state *AlertState) error {
+	query := `
+	INSERT INTO alert_states (alert_id, subject, status, changed_at, fired_at, last_notified, notified, detail)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(alert_id, subject) DO UPDATE SET
+		status = excluded.status,
+		changed_at = excluded.changed_at,
+		fired_at = excluded.fired_at,
+		last_notified = excluded.last_notified,
+		notified = excluded.notified,
+		detail = excluded.detail
+	`
+
+	_, err := r.conn.ExecContext(
+		ctx,
+		query,
+		state.AlertID,
+		state.Subject,
+		state.Status,
+		state.ChangedAt.UTC(),
+		nullTime(state.FiredAt),
+		nullTime(state.LastNotified),
+		state.Notified,
+		state.Detail,
+	)
+	return err
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+func convertAlertError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: alerts.name") {
+		return ErrAlertNameTaken
+	}
+
+	return err
+}
+
+func scanAlert(row rowScanner) (*Alert, error) {
+	var alert Alert
+	var lastTriggered sql.NullTime
+
+	if err := row.Scan(
+		&alert.ID,
+		&alert.Name,
+		&alert.Source,
+		&alert.WidgetID,
+		&alert.ConditionType,
+		&alert.ConditionValue,
+		&alert.NotificationType,
+		&alert.NotificationTarget,
+		&alert.Enabled,
+		&lastTriggered,
+		&alert.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	alert.LastTriggered = lastTriggered.Time
+	return &alert, nil
+}
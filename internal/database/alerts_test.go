@@ -0,0 +1,85 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReplaceConfigAlerts(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+
+	api := Alert{Name: "taken", Source: AlertSourceAPI, WidgetID: "monitor", ConditionType: "site-down", Enabled: true}
+	if err := db.Alerts.Create(ctx, &api); err != nil {
+		t.Fatalf("Failed to create alert: %v", err)
+	}
+
+	if err := db.Alerts.Create(ctx, &Alert{Name: "taken", Source: AlertSourceAPI}); !errors.Is(err, ErrAlertNameTaken) {
+		t.Errorf("Expected creating an alert with a taken name to fail with ErrAlertNameTaken, got %v", err)
+	}
+
+	alerts := []Alert{
+		{Name: "disk", WidgetID: "servers", ConditionType: "disk-usage-above", ConditionValue: `{"threshold":90}`},
+		{Name: "removed", WidgetID: "servers", ConditionType: "widget-error"},
+	}
+
+	if err := db.Alerts.ReplaceConfigAlerts(ctx, alerts); err != nil {
+		t.Fatalf("Failed to replace config alerts: %v", err)
+	}
+
+	before, _ := db.Alerts.List(ctx, "servers")
+	if len(before) != 2 {
+		t.Fatalf("Expected 2 config alerts, got %+v", before)
+	}
+
+	state := AlertState{AlertID: before[1].ID, Subject: "", Status: "firing", ChangedAt: time.Now()}
+	if err := db.Alerts.SaveState(ctx, &state); err != nil {
+		t.Fatalf("Failed to save alert state: %v", err)
+	}
+
+	alerts = []Alert{
+		{Name: "disk", WidgetID: "servers", ConditionType: "disk-usage-above", ConditionValue: `{"threshold":95}`},
+		{Name: "taken", WidgetID: "servers", ConditionType: "widget-error"},
+	}
+
+	if err := db.Alerts.ReplaceConfigAlerts(ctx, alerts); !errors.Is(err, ErrAlertNameTaken) {
+		t.Errorf("Expected the alert with a name taken by an API alert to be reported, got %v", err)
+	}
+
+	after, _ := db.Alerts.List(ctx, "servers")
+	if len(after) != 1 || after[0].ID != before[0].ID || after[0].ConditionValue != `{"threshold":95}` {
+		t.Fatalf("Expected only the kept config alert to remain with its ID and new condition, got %+v", after)
+	}
+
+	if kept, _ := db.Alerts.Get(ctx, api.ID); kept == nil || kept.Source != AlertSourceAPI || kept.WidgetID != "monitor" {
+		t.Errorf("Expected the API alert to be left alone, got %+v", kept)
+	}
+
+	if states, _ := db.Alerts.ListStates(ctx); len(states) != 0 {
+		t.Errorf("Expected the state of the removed alert to be deleted, got %+v", states)
+	}
+
+	state = AlertState{AlertID: after[0].ID, Subject: "", Status: "firing", ChangedAt: time.Now()}
+	if err := db.Alerts.SaveState(ctx, &state); err != nil {
+		t.Fatalf("Failed to save alert state: %v", err)
+	}
+
+	alerts = alerts[:1]
+	if err := db.Alerts.ReplaceConfigAlerts(ctx, alerts); err != nil {
+		t.Fatalf("Failed to replace config alerts: %v", err)
+	}
+
+	if states, _ := db.Alerts.ListStates(ctx); len(states) != 1 {
+		t.Errorf("Expected the state of an unchanged alert to be kept, got %+v", states)
+	}
+
+	alerts[0].ConditionValue = `{"threshold":80}`
+	if err := db.Alerts.ReplaceConfigAlerts(ctx, alerts); err != nil {
+		t.Fatalf("Failed to replace config alerts: %v", err)
+	}
+
+	if states, _ := db.Alerts.ListStates(ctx); len(states) != 0 {
+		t.Errorf("Expected the state of an alert whose condition changed to be deleted, got %+v", states)
+	}
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ConfigVersionRepository stores the history of accepted configs so that they can be compared and restored
+type ConfigVersionRepository struct {
+	conn *sql.DB
+}
+
+type ConfigVersion struct {
+	ID   int64  `json:"version"`
+	Hash string `json:"hash"`
+	// The config after includes have been resolved, as it was parsed
+	Contents string `json:"contents,omitempty"`
+	// The contents of each config file keyed by its absolute path
+	Files     map[string]string `json:"files,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Record stores a version unless it has the same hash as the latest one, in which case false is
+// returned. Only the newest keep versions are kept, older ones are deleted.
+func (r *ConfigVersionRepository) Record(ctx context.Context, version *ConfigVersion, keep int) (bool, error) {
+	files, err := json.Marshal(version.Files)
+	if err != nil {
+		return false, fmt.Errorf("encoding files: %w", err)
+	}
+
+	recorded := false
+	err = inTransaction(ctx, r.conn, func(tx *sql.Tx) error {
+		var latestHash string
+		err := tx.QueryRowContext(ctx, "SELECT hash FROM config_versions ORDER BY id DESC LIMIT 1").Scan(&latestHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if latestHash == version.Hash {
+			return nil
+		}
+
+		result, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO config_versions (hash, contents, files_json, created_at) VALUES (?, ?, ?, ?)",
+			version.Hash, version.Contents, string(files), version.CreatedAt.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+
+		if version.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			"DELETE FROM config_versions WHERE id NOT IN (SELECT id FROM config_versions ORDER BY id DESC LIMIT ?)",
+			keep,
+		)
+		recorded = err == nil
+		return err
+	})
+
+	return recorded, err
+}
+
+// Get returns a version along with its contents and files or nil if it doesn't exist
+func (r *ConfigVersionRepository) Get(ctx context.Context, id int64) (*ConfigVersion, error) {
+	var version ConfigVersion
+	var files string
+
+	err := r.conn.QueryRowContext(
+		ctx,
+		"SELECT id, hash, contents, files_json, created_at FROM config_versions WHERE id = ?",
+		id,
+	).Scan(&version.ID, &version.Hash, &version.Contents, &files, &version.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(files), &version.Files); err != nil {
+		return nil, fmt.Errorf("decoding files of version %d: %w", id, err)
+	}
+
+	return &version, nil
+}
+
+// List returns all versions without their contents and files, newest first
+func (r *ConfigVersionRepository) List(ctx context.Context) ([]ConfigVersion, error) {
+	rows, err := r.conn.QueryContext(ctx, "SELECT id, hash, created_at FROM config_versions ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]ConfigVersion, 0)
+	for rows.Next() {
+		var version ConfigVersion
+		if err := rows.Scan(&version.ID, &version.Hash, &version.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
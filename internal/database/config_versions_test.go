@@ -0,0 +1,60 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRecordConfigVersions(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+
+	record := func(hash string) bool {
+		t.Helper()
+		recorded, err := db.ConfigVersions.Record(ctx, &ConfigVersion{
+			Hash:      hash,
+			Contents:  "pages: " + hash,
+			Files:     map[string]string{"/config/glance.yml": "pages: " + hash},
+			CreatedAt: time.Now(),
+		}, 3)
+		if err != nil {
+			t.Fatalf("Failed to record version: %v", err)
+		}
+		return recorded
+	}
+
+	if !record("a") {
+		t.Fatal("Expected the first version to be recorded")
+	}
+
+	if record("a") {
+		t.Error("Expected a version with the same hash as the latest one to be skipped")
+	}
+
+	for i := range 4 {
+		record(fmt.Sprint(i))
+	}
+
+	versions, err := db.ConfigVersions.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list versions: %v", err)
+	}
+
+	if len(versions) != 3 || versions[0].Hash != "3" || versions[2].Hash != "1" {
+		t.Fatalf("Expected the newest 3 versions to be kept, got %+v", versions)
+	}
+
+	version, err := db.ConfigVersions.Get(ctx, versions[0].ID)
+	if err != nil || version == nil {
+		t.Fatalf("Failed to get version: %v", err)
+	}
+
+	if version.Files["/config/glance.yml"] != "pages: 3" || version.Contents != "pages: 3" {
+		t.Errorf("Unexpected version %+v", version)
+	}
+
+	if missing, _ := db.ConfigVersions.Get(ctx, 1); missing != nil {
+		t.Errorf("Expected the oldest version to be deleted, got %+v", missing)
+	}
+}
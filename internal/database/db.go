@@ -1,26 +1,59 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"embed"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
-	"strings"
 
 	_ "modernc.org/sqlite"
 )
 
-// Embed migration files - note: this must be relative to the package directory
-//go:embed migrations/*.sql
-var migrationsFS embed.FS
+// ErrNotFound is returned when changing something that doesn't exist
+var ErrNotFound = errors.New("not found")
 
+// DB is a connection to the database, the data in it is accessed through
+// the repositories which each cover the tables of one part of Glance
 type DB struct {
 	conn *sql.DB
+
+	WidgetData *WidgetDataRepository
+	Snapshots  *SnapshotRepository
+	History    *HistoryRepository
+	Activity   *ActivityRepository
+	Alerts     *AlertRepository
+	Profiles   *ProfileRepository
+	Sessions   *SessionRepository
+
+	ConfigVersions *ConfigVersionRepository
 }
 
 // New creates a new database connection and runs migrations
 func New(path string) (*DB, error) {
+	db, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.Migrate()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("running migrations: %w", err)
+	}
+
+	for _, migration := range applied {
+		log.Printf("Applied migration: %s", migration.Name)
+	}
+
+	log.Println("Database initialized successfully")
+	return db, nil
+}
+
+// Open creates a new database connection without running migrations
+func Open(path string) (*DB, error) {
 	// Ensure path directory exists
 	dir := filepath.Dir(path)
 	if dir != "." && dir != "" {
@@ -29,8 +62,13 @@ func New(path string) (*DB, error) {
 		}
 	}
 
-	// Open connection
-	connStr := fmt.Sprintf("file:%s?cache=shared&mode=rwc&_journal_mode=WAL", path)
+	// Open connection, pragmas are passed through the DSN so that they
+	// apply to every connection in the pool and not just the first one.
+	// auto_vacuum only has an effect on databases that are being created.
+	connStr := fmt.Sprintf(
+		"file:%s?_pragma=auto_vacuum(incremental)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_time_format=sqlite",
+		path,
+	)
 	conn, err := sql.Open("sqlite", connStr)
 	if err != nil {
 		return nil, fmt.Errorf("opening sqlite database: %w", err)
@@ -38,6 +76,7 @@ func New(path string) (*DB, error) {
 
 	// Test connection
 	if err := conn.Ping(); err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("pinging database: %w", err)
 	}
 
@@ -47,11 +86,8 @@ func New(path string) (*DB, error) {
 
 	// Set pragmas for performance
 	pragmas := []string{
-		"PRAGMA synchronous=NORMAL",
 		"PRAGMA cache_size=-64000", // 64MB cache
-		"PRAGMA busy_timeout=5000",
 		"PRAGMA temp_store=MEMORY",
-		"PRAGMA journal_mode=WAL",
 	}
 
 	for _, pragma := range pragmas {
@@ -61,16 +97,18 @@ func New(path string) (*DB, error) {
 		}
 	}
 
-	db := &DB{conn: conn}
-
-	// Run migrations
-	if err := db.runMigrations(); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("running migrations: %w", err)
-	}
-
-	log.Println("Database initialized successfully")
-	return db, nil
+	return &DB{
+		conn:       conn,
+		WidgetData: &WidgetDataRepository{conn: conn},
+		Snapshots:  &SnapshotRepository{conn: conn},
+		History:    &HistoryRepository{conn: conn},
+		Activity:   &ActivityRepository{conn: conn},
+		Alerts:     &AlertRepository{conn: conn},
+		Profiles:   &ProfileRepository{conn: conn},
+		Sessions:   &SessionRepository{conn: conn},
+
+		ConfigVersions: &ConfigVersionRepository{conn: conn},
+	}, nil
 }
 
 // Close closes the database connection
@@ -106,119 +144,37 @@ func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
 	return db.conn.QueryRow(query, args...)
 }
 
-// CreateMigrationTables creates the migrations tracking table
-func (db *DB) createMigrationTable() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS schema_migrations (
-		version INTEGER PRIMARY KEY,
-		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	)
-	`
-	_, err := db.conn.Exec(query)
-	return err
-}
-
-// GetAppliedMigrationVersion returns the current migration version
-func (db *DB) getAppliedMigrationVersion() (int, error) {
-	var version int
-	err := db.conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+// execCountingRows executes a query and returns the number of rows it affected
+func execCountingRows(ctx context.Context, conn *sql.DB, query string, args ...any) (int64, error) {
+	result, err := conn.ExecContext(ctx, query, args...)
 	if err != nil {
 		return 0, err
 	}
-	return version, nil
-}
 
-// RecordMigration records that a migration has been applied
-func (db *DB) recordMigration(version int) error {
-	_, err := db.conn.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version)
-	return err
+	return result.RowsAffected()
 }
 
-// runMigrations runs all pending migrations
-func (db *DB) runMigrations() error {
-	// Create migrations table
-	if err := db.createMigrationTable(); err != nil {
-		return fmt.Errorf("creating migration table: %w", err)
-	}
-
-	// Get current version
-	currentVersion, err := db.getAppliedMigrationVersion()
+// inTransaction runs fn within a transaction which is committed if fn succeeds and rolled back otherwise
+func inTransaction(ctx context.Context, conn *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("getting current migration version: %w", err)
+		return err
 	}
 
-	// Read migration files
-	entries, err := migrationsFS.ReadDir("migrations")
-	if err != nil {
-		// If migrations directory doesn't exist yet, return (will be created later)
-		if strings.Contains(err.Error(), "no such file or directory") {
-			return nil
-		}
-		return fmt.Errorf("reading migrations directory: %w", err)
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	// Run migrations in order
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		filename := entry.Name()
-		if !strings.HasSuffix(filename, ".sql") {
-			continue
-		}
-
-		// Parse version from filename (e.g., "001_initial_schema.sql" -> 1)
-		parts := strings.Split(filename, "_")
-		if len(parts) == 0 {
-			continue
-		}
-
-		var version int
-		_, err := fmt.Sscanf(parts[0], "%d", &version)
-		if err != nil {
-			log.Printf("Skipping migration file %s: invalid version", filename)
-			continue
-		}
-
-		// Skip already applied migrations
-		if version <= currentVersion {
-			continue
-		}
-
-		// Read and execute migration
-		content, err := migrationsFS.ReadFile(filepath.Join("migrations", filename))
-		if err != nil {
-			return fmt.Errorf("reading migration file %s: %w", filename, err)
-		}
-
-		tx, err := db.conn.Begin()
-		if err != nil {
-			return fmt.Errorf("beginning transaction for migration %s: %w", filename, err)
-		}
-
-		if _, err := tx.Exec(string(content)); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("executing migration %s: %w", filename, err)
-		}
-
-		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("recording migration %s: %w", filename, err)
-		}
-
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("committing migration %s: %w", filename, err)
-		}
-
-		log.Printf("Applied migration: %s", filename)
-	}
-
-	return nil
+	return tx.Commit()
 }
 
 // createDirIfNotExists creates a directory if it doesn't exist
 func createDirIfNotExists(dir string) error {
-	// This is simplified - in production would use os package
-	return nil
+	return os.MkdirAll(dir, 0o755)
+}
+
+// Satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
 }
@@ -1,9 +1,25 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
 	"time"
 )
 
+// Resolutions that raw history gets rolled up into, each one is computed from the one before it
+const (
+	ResolutionFiveMinutes = 5 * time.Minute
+	ResolutionHourly      = time.Hour
+)
+
+// HistoryRepository stores the numeric values recorded by widgets along with their rollups
+type HistoryRepository struct {
+	conn *sql.DB
+}
+
 type HistoricalDataPoint struct {
 	ID         int64
 	WidgetID   string
@@ -13,23 +29,58 @@ type HistoricalDataPoint struct {
 	RecordedAt time.Time
 }
 
-func (db *DB) RecordMetric(widgetID, widgetType, metricName string, value float64) error {
-	query := `
+// MetricSample is a single value of a metric recorded by a widget
+type MetricSample struct {
+	Name  string
+	Value float64
+}
+
+// HistoryRetention is how long each tier of history is kept for
+type HistoryRetention struct {
+	Raw        time.Duration
+	FiveMinute time.Duration
+	Hourly     time.Duration
+}
+
+// Record records all of the samples of a single widget update at once
+func (r *HistoryRepository) Record(ctx context.Context, widgetID, widgetType string, samples []MetricSample, recordedAt time.Time) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
 		INSERT INTO widget_history (widget_id, widget_type, metric_name, metric_value, recorded_at)
-		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
-	`
-	_, err := db.conn.Exec(query, widgetID, widgetType, metricName, value)
-	return err
+		VALUES (?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, sample := range samples {
+		if _, err := stmt.ExecContext(ctx, widgetID, widgetType, sample.Name, sample.Value, recordedAt.UTC()); err != nil {
+			return fmt.Errorf("recording %s: %w", sample.Name, err)
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (db *DB) GetHistory(widgetID, metricName string, since time.Time) ([]HistoricalDataPoint, error) {
+// Points returns the raw points of a metric recorded since the given time, oldest first
+func (r *HistoryRepository) Points(ctx context.Context, widgetID, metricName string, since time.Time) ([]HistoricalDataPoint, error) {
 	query := `
 		SELECT id, widget_id, widget_type, metric_name, metric_value, recorded_at
 		FROM widget_history
 		WHERE widget_id = ? AND metric_name = ? AND recorded_at >= ?
 		ORDER BY recorded_at ASC
 	`
-	rows, err := db.conn.Query(query, widgetID, metricName, since)
+	rows, err := r.conn.QueryContext(ctx, query, widgetID, metricName, since.UTC())
 	if err != nil {
 		return nil, err
 	}
@@ -47,11 +98,450 @@ func (db *DB) GetHistory(widgetID, metricName string, since time.Time) ([]Histor
 	return points, rows.Err()
 }
 
-func (db *DB) CleanupOldHistory(retentionDays int) error {
+// HistoryQuery selects the values of a metric to group into buckets of Step, which
+// must be a whole number of seconds. From is aligned down to the start of its bucket
+// and To is exclusive.
+type HistoryQuery struct {
+	WidgetID   string
+	MetricName string
+	From       time.Time
+	To         time.Time
+	Step       time.Duration
+}
+
+// HistoryBucket holds the aggregates of the values recorded within a bucket
+type HistoryBucket struct {
+	Start time.Time
+	Min   float64
+	Max   float64
+	Sum   float64
+	Count int64
+	Last  float64
+}
+
+func (b *HistoryBucket) Avg() float64 {
+	return b.Sum / float64(b.Count)
+}
+
+// Query returns the buckets of the query that have values in them, oldest
+// first. When the step is a multiple of a rolled up resolution, the rolled up buckets
+// are used for as far as they go so that the query also covers values whose raw points
+// have already been deleted. The rest comes from the raw points.
+func (r *HistoryRepository) Query(ctx context.Context, q HistoryQuery) ([]HistoryBucket, error) {
+	step := int64(q.Step.Seconds())
+	if step <= 0 {
+		return nil, errors.New("step must be at least 1 second")
+	}
+
+	from := alignToResolution(q.From, q.Step)
+	to := q.To.Unix()
+
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	buckets := make(map[rollupKey]*rollupBucket)
+	bucketKey := func(start int64) rollupKey {
+		return rollupKey{q.WidgetID, q.MetricName, start / step * step}
+	}
+
+	cursor := from
+	for _, resolution := range []time.Duration{ResolutionHourly, ResolutionFiveMinutes} {
+		if step%int64(resolution.Seconds()) != 0 {
+			continue
+		}
+
+		rolledUntil, _, err := getRolledUntil(ctx, tx, resolution)
+		if err != nil {
+			return nil, err
+		}
+
+		// A rolled up bucket that ends after the query would include values from after it,
+		// so the rest of the query comes from the next resolution or the raw points instead
+		resolutionSeconds := int64(resolution.Seconds())
+		until := min(rolledUntil, to/resolutionSeconds*resolutionSeconds)
+		if until <= cursor {
+			continue
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			SELECT bucket_start, min_value, max_value, sum_value, sample_count, last_value
+			FROM widget_history_rollups
+			WHERE widget_id = ? AND metric_name = ? AND resolution = ? AND bucket_start >= ? AND bucket_start < ?
+			ORDER BY bucket_start ASC
+		`, q.WidgetID, q.MetricName, resolutionSeconds, cursor, until)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var start, count int64
+			var min, max, sum, last float64
+
+			if err := rows.Scan(&start, &min, &max, &sum, &count, &last); err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			getRollupBucket(buckets, bucketKey(start), "").add(min, max, sum, count, last)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		cursor = until
+	}
+
+	if cursor < to {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT metric_value, recorded_at
+			FROM widget_history
+			WHERE widget_id = ? AND metric_name = ? AND recorded_at >= ? AND recorded_at < ?
+			ORDER BY recorded_at ASC, id ASC
+		`, q.WidgetID, q.MetricName, time.Unix(cursor, 0).UTC(), time.Unix(to, 0).UTC())
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var value float64
+			var recordedAt time.Time
+
+			if err := rows.Scan(&value, &recordedAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			getRollupBucket(buckets, bucketKey(recordedAt.Unix()), "").add(value, value, value, 1, value)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]HistoryBucket, 0, len(buckets))
+	for key, bucket := range buckets {
+		result = append(result, HistoryBucket{
+			Start: time.Unix(key.start, 0).UTC(),
+			Min:   bucket.min,
+			Max:   bucket.max,
+			Sum:   bucket.sum,
+			Count: bucket.count,
+			Last:  bucket.last,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+
+	return result, nil
+}
+
+type rollupKey struct {
+	widgetID   string
+	metricName string
+	start      int64
+}
+
+type rollupBucket struct {
+	widgetType string
+	min        float64
+	max        float64
+	sum        float64
+	count      int64
+	last       float64
+}
+
+// Values have to be added in the order they were recorded for last to be correct
+func (b *rollupBucket) add(min, max, sum float64, count int64, last float64) {
+	if b.count == 0 || min < b.min {
+		b.min = min
+	}
+	if b.count == 0 || max > b.max {
+		b.max = max
+	}
+
+	b.sum += sum
+	b.count += count
+	b.last = last
+}
+
+// Rollup folds every complete bucket up to now into the five minute
+// and then the hourly resolution. Each bucket is only computed once, so it's
+// fine to call this as often as needed.
+func (r *HistoryRepository) Rollup(ctx context.Context, now time.Time) error {
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := rollupRawHistory(ctx, tx, alignToResolution(now, ResolutionFiveMinutes)); err != nil {
+		return fmt.Errorf("rolling up raw history: %w", err)
+	}
+
+	if err := rollupFiveMinuteHistory(ctx, tx, alignToResolution(now, ResolutionHourly)); err != nil {
+		return fmt.Errorf("rolling up five minute history: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func rollupRawHistory(ctx context.Context, tx *sql.Tx, until int64) error {
+	from, hasState, err := getRolledUntil(ctx, tx, ResolutionFiveMinutes)
+	if err != nil {
+		return err
+	}
+
+	if hasState && from >= until {
+		return nil
+	}
+
+	query := `
+		SELECT widget_id, widget_type, metric_name, metric_value, recorded_at
+		FROM widget_history
+		WHERE recorded_at >= ? AND recorded_at < ?
+		ORDER BY recorded_at ASC, id ASC
+	`
+
+	rows, err := tx.QueryContext(ctx, query, time.Unix(from, 0).UTC(), time.Unix(until, 0).UTC())
+	if err != nil {
+		return err
+	}
+
+	buckets := make(map[rollupKey]*rollupBucket)
+	for rows.Next() {
+		var widgetID, widgetType, metricName string
+		var value float64
+		var recordedAt time.Time
+
+		if err := rows.Scan(&widgetID, &widgetType, &metricName, &value, &recordedAt); err != nil {
+			rows.Close()
+			return err
+		}
+
+		bucket := getRollupBucket(buckets, rollupKey{widgetID, metricName, alignToResolution(recordedAt, ResolutionFiveMinutes)}, widgetType)
+		bucket.add(value, value, value, 1, value)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := saveRollupBuckets(ctx, tx, ResolutionFiveMinutes, buckets); err != nil {
+		return err
+	}
+
+	return setRolledUntil(ctx, tx, ResolutionFiveMinutes, until)
+}
+
+func rollupFiveMinuteHistory(ctx context.Context, tx *sql.Tx, until int64) error {
+	from, hasState, err := getRolledUntil(ctx, tx, ResolutionHourly)
+	if err != nil {
+		return err
+	}
+
+	if hasState && from >= until {
+		return nil
+	}
+
 	query := `
-		DELETE FROM widget_history
-		WHERE recorded_at < datetime('now', ? || ' days')
+		SELECT widget_id, widget_type, metric_name, bucket_start, min_value, max_value, sum_value, sample_count, last_value
+		FROM widget_history_rollups
+		WHERE resolution = ? AND bucket_start >= ? AND bucket_start < ?
+		ORDER BY bucket_start ASC
 	`
-	_, err := db.conn.Exec(query, -retentionDays)
+
+	rows, err := tx.QueryContext(ctx, query, int64(ResolutionFiveMinutes.Seconds()), from, until)
+	if err != nil {
+		return err
+	}
+
+	buckets := make(map[rollupKey]*rollupBucket)
+	for rows.Next() {
+		var widgetID, widgetType, metricName string
+		var start, count int64
+		var min, max, sum, last float64
+
+		if err := rows.Scan(&widgetID, &widgetType, &metricName, &start, &min, &max, &sum, &count, &last); err != nil {
+			rows.Close()
+			return err
+		}
+
+		bucket := getRollupBucket(buckets, rollupKey{widgetID, metricName, alignToResolution(time.Unix(start, 0), ResolutionHourly)}, widgetType)
+		bucket.add(min, max, sum, count, last)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := saveRollupBuckets(ctx, tx, ResolutionHourly, buckets); err != nil {
+		return err
+	}
+
+	return setRolledUntil(ctx, tx, ResolutionHourly, until)
+}
+
+func getRollupBucket(buckets map[rollupKey]*rollupBucket, key rollupKey, widgetType string) *rollupBucket {
+	bucket, exists := buckets[key]
+	if !exists {
+		bucket = &rollupBucket{widgetType: widgetType}
+		buckets[key] = bucket
+	}
+
+	return bucket
+}
+
+// Buckets that already exist are merged with rather than replaced, which
+// only happens if points were recorded with a time in the past
+func saveRollupBuckets(ctx context.Context, tx *sql.Tx, resolution time.Duration, buckets map[rollupKey]*rollupBucket) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO widget_history_rollups (widget_id, widget_type, metric_name, resolution, bucket_start, min_value, max_value, sum_value, sample_count, last_value)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(widget_id, metric_name, resolution, bucket_start)
+		DO UPDATE SET
+			widget_type=excluded.widget_type,
+			min_value=MIN(min_value, excluded.min_value),
+			max_value=MAX(max_value, excluded.max_value),
+			sum_value=sum_value + excluded.sum_value,
+			sample_count=sample_count + excluded.sample_count,
+			last_value=excluded.last_value
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	seconds := int64(resolution.Seconds())
+	for key, bucket := range buckets {
+		_, err := stmt.ExecContext(
+			ctx,
+			key.widgetID,
+			bucket.widgetType,
+			key.metricName,
+			seconds,
+			key.start,
+			bucket.min,
+			bucket.max,
+			bucket.sum,
+			bucket.count,
+			bucket.last,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns false if the resolution has never been rolled up
+func getRolledUntil(ctx context.Context, tx *sql.Tx, resolution time.Duration) (int64, bool, error) {
+	var until int64
+	err := tx.QueryRowContext(
+		ctx,
+		"SELECT rolled_until FROM widget_history_rollup_state WHERE resolution = ?",
+		int64(resolution.Seconds()),
+	).Scan(&until)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+
+	return until, err == nil, err
+}
+
+func setRolledUntil(ctx context.Context, tx *sql.Tx, resolution time.Duration, until int64) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO widget_history_rollup_state (resolution, rolled_until) VALUES (?, ?)
+		ON CONFLICT(resolution) DO UPDATE SET rolled_until=excluded.rolled_until
+	`, int64(resolution.Seconds()), until)
 	return err
 }
+
+// Returns the unix timestamp of the start of the bucket the time falls in
+func alignToResolution(t time.Time, resolution time.Duration) int64 {
+	seconds := int64(resolution.Seconds())
+	return t.Unix() / seconds * seconds
+}
+
+// DeleteOlderThanRetention removes the history of each tier that's past its retention
+// and returns how many rows were removed. Raw points and five minute buckets that haven't
+// been rolled up yet are kept.
+func (r *HistoryRepository) DeleteOlderThanRetention(ctx context.Context, retention HistoryRetention, now time.Time) (int64, error) {
+	rawCutoff := now.Add(-retention.Raw).Unix()
+	fiveMinuteCutoff := now.Add(-retention.FiveMinute).Unix()
+	hourlyCutoff := now.Add(-retention.Hourly).Unix()
+
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rawRolledUntil, _, err := getRolledUntil(ctx, tx, ResolutionFiveMinutes)
+	if err != nil {
+		return 0, err
+	}
+
+	fiveMinuteRolledUntil, _, err := getRolledUntil(ctx, tx, ResolutionHourly)
+	if err != nil {
+		return 0, err
+	}
+
+	deletes := []struct {
+		tier  string
+		query string
+		args  []any
+	}{
+		{
+			"raw",
+			"DELETE FROM widget_history WHERE recorded_at < ?",
+			[]any{time.Unix(min(rawCutoff, rawRolledUntil), 0).UTC()},
+		},
+		{
+			"five minute",
+			"DELETE FROM widget_history_rollups WHERE resolution = ? AND bucket_start < ?",
+			[]any{int64(ResolutionFiveMinutes.Seconds()), min(fiveMinuteCutoff, fiveMinuteRolledUntil)},
+		},
+		{
+			"hourly",
+			"DELETE FROM widget_history_rollups WHERE resolution = ? AND bucket_start < ?",
+			[]any{int64(ResolutionHourly.Seconds()), hourlyCutoff},
+		},
+	}
+
+	var deleted int64
+	for _, d := range deletes {
+		result, err := tx.ExecContext(ctx, d.query, d.args...)
+		if err != nil {
+			return 0, fmt.Errorf("deleting %s history: %w", d.tier, err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += affected
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
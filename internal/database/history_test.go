@@ -0,0 +1,208 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollupHistory(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+
+	base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	points := []struct {
+		offset time.Duration
+		value  float64
+	}{
+		{1 * time.Minute, 40},
+		{3 * time.Minute, 20},
+		{7 * time.Minute, 30},
+		{62 * time.Minute, 50},
+	}
+
+	for _, point := range points {
+		samples := []MetricSample{{Name: "response_time_ms:site", Value: point.value}}
+		if err := db.History.Record(ctx, "monitor-1", "monitor", samples, base.Add(point.offset)); err != nil {
+			t.Fatalf("Failed to record metrics: %v", err)
+		}
+	}
+
+	now := base.Add(66 * time.Minute)
+
+	// Rolling up twice must not count the same points again
+	for range 2 {
+		if err := db.History.Rollup(ctx, now); err != nil {
+			t.Fatalf("Failed to roll up history: %v", err)
+		}
+	}
+
+	type bucket struct {
+		min, max, sum, last float64
+		count               int64
+	}
+
+	getBucket := func(resolution time.Duration, start time.Time) *bucket {
+		var b bucket
+		err := db.QueryRow(`
+			SELECT min_value, max_value, sum_value, last_value, sample_count
+			FROM widget_history_rollups
+			WHERE widget_id = ? AND resolution = ? AND bucket_start = ?
+		`, "monitor-1", int64(resolution.Seconds()), start.Unix()).Scan(&b.min, &b.max, &b.sum, &b.last, &b.count)
+		if err != nil {
+			return nil
+		}
+
+		return &b
+	}
+
+	if b := getBucket(ResolutionFiveMinutes, base); b == nil || *b != (bucket{min: 20, max: 40, sum: 60, last: 20, count: 2}) {
+		t.Errorf("Unexpected first five minute bucket: %+v", b)
+	}
+
+	if b := getBucket(ResolutionFiveMinutes, base.Add(time.Hour)); b == nil || b.count != 1 {
+		t.Errorf("Expected the point from the last complete five minutes to be rolled up, got %+v", b)
+	}
+
+	if b := getBucket(ResolutionHourly, base); b == nil || *b != (bucket{min: 20, max: 40, sum: 90, last: 30, count: 3}) {
+		t.Errorf("Unexpected hourly bucket: %+v", b)
+	}
+
+	if b := getBucket(ResolutionHourly, base.Add(time.Hour)); b != nil {
+		t.Errorf("Expected the incomplete hour to not be rolled up, got %+v", b)
+	}
+
+	retention := HistoryRetention{Raw: 2 * time.Minute, FiveMinute: time.Hour, Hourly: 24 * time.Hour}
+	if _, err := db.History.DeleteOlderThanRetention(ctx, retention, now); err != nil {
+		t.Fatalf("Failed to delete history: %v", err)
+	}
+
+	var rawCount int
+	if err := db.QueryRow("SELECT COUNT(*) FROM widget_history").Scan(&rawCount); err != nil {
+		t.Fatalf("Failed to count raw history: %v", err)
+	}
+
+	if rawCount != 0 {
+		t.Errorf("Expected all rolled up raw points past their retention to be deleted, %d remain", rawCount)
+	}
+
+	if getBucket(ResolutionFiveMinutes, base) != nil {
+		t.Error("Expected the first five minute bucket to be deleted")
+	}
+
+	if getBucket(ResolutionHourly, base) == nil {
+		t.Error("Expected the hourly bucket to be kept")
+	}
+}
+
+func TestQueryHistoryCombinesResolutions(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+
+	base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	points := []struct {
+		offset time.Duration
+		value  float64
+	}{
+		{1 * time.Minute, 40},
+		{3 * time.Minute, 20},
+		{7 * time.Minute, 30},
+		{62 * time.Minute, 50},
+		{66 * time.Minute, 10},
+	}
+
+	for _, point := range points {
+		samples := []MetricSample{{Name: "price:AAPL", Value: point.value}}
+		if err := db.History.Record(ctx, "markets", "markets", samples, base.Add(point.offset)); err != nil {
+			t.Fatalf("Failed to record metrics: %v", err)
+		}
+	}
+
+	now := base.Add(68 * time.Minute)
+	if err := db.History.Rollup(ctx, now); err != nil {
+		t.Fatalf("Failed to roll up history: %v", err)
+	}
+
+	// Leaves only the point that hasn't been rolled up yet
+	if _, err := db.Exec("DELETE FROM widget_history WHERE recorded_at < ?", base.Add(65*time.Minute)); err != nil {
+		t.Fatalf("Failed to delete raw history: %v", err)
+	}
+
+	buckets, err := db.History.Query(ctx, HistoryQuery{
+		WidgetID:   "markets",
+		MetricName: "price:AAPL",
+		From:       base.Add(30 * time.Minute),
+		To:         now,
+		Step:       time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to query history: %v", err)
+	}
+
+	expected := []HistoryBucket{
+		{Start: base, Min: 20, Max: 40, Sum: 90, Count: 3, Last: 30},
+		{Start: base.Add(time.Hour), Min: 10, Max: 50, Sum: 60, Count: 2, Last: 10},
+	}
+
+	if len(buckets) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %+v", len(expected), buckets)
+	}
+
+	for i := range expected {
+		if !buckets[i].Start.Equal(expected[i].Start) || buckets[i].Min != expected[i].Min ||
+			buckets[i].Max != expected[i].Max || buckets[i].Sum != expected[i].Sum ||
+			buckets[i].Count != expected[i].Count || buckets[i].Last != expected[i].Last {
+			t.Errorf("Expected bucket %d to be %+v, got %+v", i, expected[i], buckets[i])
+		}
+	}
+
+	// Steps that aren't a multiple of a rolled up resolution can only use raw points
+	buckets, err = db.History.Query(ctx, HistoryQuery{
+		WidgetID:   "markets",
+		MetricName: "price:AAPL",
+		From:       base,
+		To:         now,
+		Step:       time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to query history: %v", err)
+	}
+
+	if len(buckets) != 1 || buckets[0].Last != 10 {
+		t.Errorf("Expected only the remaining raw point, got %+v", buckets)
+	}
+}
+
+func TestQueryHistoryExcludesValuesAfterTheEnd(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+
+	base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	for offset, value := range map[time.Duration]float64{1 * time.Minute: 40, 3 * time.Minute: 20, 7 * time.Minute: 30} {
+		samples := []MetricSample{{Name: "price:AAPL", Value: value}}
+		if err := db.History.Record(ctx, "markets", "markets", samples, base.Add(offset)); err != nil {
+			t.Fatalf("Failed to record metrics: %v", err)
+		}
+	}
+
+	if err := db.History.Rollup(ctx, base.Add(2*time.Hour)); err != nil {
+		t.Fatalf("Failed to roll up history: %v", err)
+	}
+
+	// Both end partway through the rolled up bucket that the last point is in
+	for _, step := range []time.Duration{5 * time.Minute, time.Hour} {
+		buckets, err := db.History.Query(ctx, HistoryQuery{
+			WidgetID:   "markets",
+			MetricName: "price:AAPL",
+			From:       base,
+			To:         base.Add(6 * time.Minute),
+			Step:       step,
+		})
+		if err != nil {
+			t.Fatalf("Failed to query history: %v", err)
+		}
+
+		if len(buckets) != 1 || buckets[0].Count != 2 || buckets[0].Max != 40 || buckets[0].Last != 20 {
+			t.Errorf("Expected only the points before the end with a step of %s, got %+v", step, buckets)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package database
+
+// Optimize lets SQLite update the statistics its query planner uses where it thinks they're outdated
+func (db *DB) Optimize() error {
+	_, err := db.conn.Exec("PRAGMA optimize")
+	return err
+}
+
+// IncrementalVacuumEnabled reports whether the pages freed by deleted rows can be returned
+// to the file system by Vacuum, which isn't the case for databases created before it was enabled
+func (db *DB) IncrementalVacuumEnabled() (bool, error) {
+	var autoVacuum int
+	if err := db.conn.QueryRow("PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		return false, err
+	}
+
+	// 2 is incremental
+	return autoVacuum == 2, nil
+}
+
+// EnableIncrementalVacuum switches the database over to incremental vacuuming, which
+// requires a full vacuum that locks the database for as long as it takes to rewrite it
+func (db *DB) EnableIncrementalVacuum() error {
+	if _, err := db.conn.Exec("PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+		return err
+	}
+
+	_, err := db.conn.Exec("VACUUM")
+	return err
+}
+
+// Vacuum returns the pages freed by deleted rows to the file system and reports how
+// many bytes were freed, nothing is freed unless incremental vacuuming is enabled
+func (db *DB) Vacuum() (int64, error) {
+	sizeBefore, err := db.fileSize()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := db.conn.Exec("PRAGMA incremental_vacuum"); err != nil {
+		return 0, err
+	}
+
+	sizeAfter, err := db.fileSize()
+	if err != nil {
+		return 0, err
+	}
+
+	return sizeBefore - sizeAfter, nil
+}
+
+func (db *DB) fileSize() (int64, error) {
+	var pageCount, pageSize int64
+
+	if err := db.conn.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, err
+	}
+
+	if err := db.conn.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+
+	return pageCount * pageSize, nil
+}
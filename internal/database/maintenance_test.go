@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeleteOrphanedWidgetData(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+
+	for _, id := range []string{"todo-kept", "todo-removed"} {
+		if err := db.WidgetData.Save(ctx, id, "to-do", "items", []string{"a"}); err != nil {
+			t.Fatalf("Failed to save widget data: %v", err)
+		}
+	}
+
+	deleted, err := db.WidgetData.DeleteOrphaned(ctx, []string{"todo-kept"}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to delete orphaned widget data: %v", err)
+	}
+
+	if deleted != 1 {
+		t.Errorf("Expected 1 row to be deleted, got %d", deleted)
+	}
+
+	if data, _ := db.WidgetData.Get(ctx, "todo-kept", "items"); data == nil {
+		t.Error("Expected the data of the widget that's still in the config to be kept")
+	}
+}
+
+func TestVacuumFreesDeletedPages(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+
+	value := strings.Repeat("x", 4096)
+	for i := range 200 {
+		if err := db.Activity.Log(ctx, "test", "", "", "", map[string]interface{}{"i": i, "value": value}); err != nil {
+			t.Fatalf("Failed to log activity: %v", err)
+		}
+	}
+
+	if _, err := db.Activity.DeleteOlderThan(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to delete activity: %v", err)
+	}
+
+	freed, err := db.Vacuum()
+	if err != nil {
+		t.Fatalf("Failed to vacuum: %v", err)
+	}
+
+	if freed <= 0 {
+		t.Errorf("Expected vacuuming to free space, freed %d bytes", freed)
+	}
+
+	var autoVacuum int
+	if err := db.QueryRow("PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		t.Fatalf("Failed to query auto_vacuum: %v", err)
+	}
+
+	if autoVacuum != 2 {
+		t.Errorf("Expected new databases to use incremental vacuuming, got mode %d", autoVacuum)
+	}
+}
+
+func TestEnableIncrementalVacuumOnOlderDatabases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if _, err := conn.Exec("CREATE TABLE leftover (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	conn.Close()
+
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if enabled, err := db.IncrementalVacuumEnabled(); err != nil || enabled {
+		t.Fatalf("Expected a database created without it not to use incremental vacuuming, got %v, %v", enabled, err)
+	}
+
+	if _, err := db.Vacuum(); err != nil {
+		t.Fatalf("Expected vacuuming to be a no-op until incremental vacuuming is enabled, got %v", err)
+	}
+
+	if err := db.EnableIncrementalVacuum(); err != nil {
+		t.Fatalf("Failed to enable incremental vacuuming: %v", err)
+	}
+
+	if enabled, err := db.IncrementalVacuumEnabled(); err != nil || !enabled {
+		t.Errorf("Expected incremental vacuuming to be enabled, got %v, %v", enabled, err)
+	}
+}
@@ -0,0 +1,546 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Embed migration files - note: this must be relative to the package directory
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// Migrations are named NNN_name.sql with an optional NNN_name.down.sql that reverts them
+const downMigrationSuffix = ".down.sql"
+
+// ErrSchemaTooNew is returned when the database has migrations applied
+// to it that this version of Glance doesn't know about
+var ErrSchemaTooNew = errors.New("database was migrated by a newer version of Glance")
+
+// Migration is a change to the schema shipped with Glance
+type Migration struct {
+	Version int
+	// File name without the extension, empty for migrations that have been applied
+	// to the database by a newer version of Glance that this one doesn't know about
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Whether the migration was changed after it had been applied
+	Modified   bool
+	Reversible bool
+}
+
+type migrationFile struct {
+	version  int
+	name     string
+	contents string
+	// Empty if the migration can't be reverted
+	down     string
+	checksum string
+}
+
+type appliedMigration struct {
+	appliedAt time.Time
+	// Empty for migrations applied before checksums were recorded
+	checksum string
+}
+
+// Returns the embedded migrations, ordered by version
+func loadMigrations() ([]migrationFile, error) {
+	entries, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations directory: %w", err)
+	}
+
+	byVersion := make(map[int]*migrationFile, len(entries))
+	downs := make(map[int]string)
+
+	for _, entry := range entries {
+		filename := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(filename, ".sql") {
+			continue
+		}
+
+		// Parse version from filename (e.g., "001_initial_schema.sql" -> 1)
+		var version int
+		if _, err := fmt.Sscanf(strings.SplitN(filename, "_", 2)[0], "%d", &version); err != nil {
+			return nil, fmt.Errorf("migration file %s has an invalid version", filename)
+		}
+
+		contents, err := migrationsFS.ReadFile(path.Join("migrations", filename))
+		if err != nil {
+			return nil, fmt.Errorf("reading migration file %s: %w", filename, err)
+		}
+
+		if strings.HasSuffix(filename, downMigrationSuffix) {
+			downs[version] = string(contents)
+			continue
+		}
+
+		if _, exists := byVersion[version]; exists {
+			return nil, fmt.Errorf("there are multiple migrations with version %d", version)
+		}
+
+		checksum := sha256.Sum256(contents)
+		byVersion[version] = &migrationFile{
+			version:  version,
+			name:     strings.TrimSuffix(filename, ".sql"),
+			contents: string(contents),
+			checksum: hex.EncodeToString(checksum[:]),
+		}
+	}
+
+	migrations := make([]migrationFile, 0, len(byVersion))
+	for version, file := range byVersion {
+		file.down = downs[version]
+		delete(downs, version)
+		migrations = append(migrations, *file)
+	}
+
+	for version := range downs {
+		return nil, fmt.Errorf("down migration with version %d has no matching migration", version)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+// LatestSchemaVersion returns the version of the last migration known to this version of Glance
+func LatestSchemaVersion() (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+
+	return migrations[len(migrations)-1].version, nil
+}
+
+func (db *DB) createMigrationTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		checksum TEXT NOT NULL DEFAULT ''
+	)
+	`
+	if _, err := db.conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Tables created before checksums were recorded
+	var hasChecksum bool
+	err := db.conn.QueryRow(
+		"SELECT COUNT(*) > 0 FROM pragma_table_info('schema_migrations') WHERE name = 'checksum'",
+	).Scan(&hasChecksum)
+	if err != nil {
+		return err
+	}
+
+	if !hasChecksum {
+		_, err = db.conn.Exec("ALTER TABLE schema_migrations ADD COLUMN checksum TEXT NOT NULL DEFAULT ''")
+	}
+
+	return err
+}
+
+// SchemaVersion returns the version of the last migration applied to the database
+func (db *DB) SchemaVersion() (int, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for appliedVersion := range applied {
+		version = max(version, appliedVersion)
+	}
+
+	return version, nil
+}
+
+func schemaVersion(conn *sql.DB) (int, error) {
+	var version int
+	err := conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Only reads from the database so that its status can be checked without changing it,
+// migrations applied before checksums were recorded are returned without one
+func (db *DB) appliedMigrations() (map[int]appliedMigration, error) {
+	var hasTable, hasChecksum bool
+	err := db.conn.QueryRow(
+		"SELECT COUNT(*) > 0, COUNT(CASE WHEN name = 'checksum' THEN 1 END) > 0 FROM pragma_table_info('schema_migrations')",
+	).Scan(&hasTable, &hasChecksum)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]appliedMigration)
+	if !hasTable {
+		return applied, nil
+	}
+
+	query := "SELECT version, applied_at, checksum FROM schema_migrations"
+	if !hasChecksum {
+		query = "SELECT version, applied_at, '' FROM schema_migrations"
+	}
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var migration appliedMigration
+		if err := rows.Scan(&version, &migration.appliedAt, &migration.checksum); err != nil {
+			return nil, err
+		}
+		applied[version] = migration
+	}
+
+	return applied, rows.Err()
+}
+
+// MigrationStatus returns every migration known to this version of Glance along with
+// any that have been applied by a newer one, ordered by version
+func (db *DB) MigrationStatus() ([]Migration, error) {
+	files, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	for _, file := range files {
+		migration := Migration{Version: file.version, Name: file.name, Reversible: file.down != ""}
+
+		if record, ok := applied[file.version]; ok {
+			migration.Applied = true
+			migration.AppliedAt = record.appliedAt
+			migration.Modified = record.checksum != "" && record.checksum != file.checksum
+			delete(applied, file.version)
+		}
+
+		migrations = append(migrations, migration)
+	}
+
+	for version, record := range applied {
+		migrations = append(migrations, Migration{Version: version, Applied: true, AppliedAt: record.appliedAt})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Makes sure that the migrations applied to the database are the ones this version of Glance
+// ships with, unchanged and without gaps, recording the checksums of migrations that were
+// applied before checksums were recorded along the way
+func (db *DB) verifyMigrations(files []migrationFile, applied map[int]appliedMigration) error {
+	known := make(map[int]bool, len(files))
+	for _, file := range files {
+		known[file.version] = true
+	}
+
+	latestApplied := 0
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("%w, it has migration %d applied which this version doesn't know about", ErrSchemaTooNew, version)
+		}
+		latestApplied = max(latestApplied, version)
+	}
+
+	for _, file := range files {
+		record, ok := applied[file.version]
+		if !ok {
+			if file.version < latestApplied {
+				return fmt.Errorf("migration %s was never applied even though later ones were", file.name)
+			}
+			continue
+		}
+
+		if record.checksum == "" {
+			_, err := db.conn.Exec("UPDATE schema_migrations SET checksum = ? WHERE version = ?", file.checksum, file.version)
+			if err != nil {
+				return fmt.Errorf("recording checksum of migration %s: %w", file.name, err)
+			}
+			continue
+		}
+
+		if record.checksum != file.checksum {
+			return fmt.Errorf("migration %s was changed after it had been applied", file.name)
+		}
+	}
+
+	return nil
+}
+
+// Migrate applies every pending migration, each within its own transaction, and returns
+// the ones that were applied. Nothing is applied if the migrations that have already
+// been applied don't match the ones this version of Glance ships with.
+func (db *DB) Migrate() ([]Migration, error) {
+	files, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.createMigrationTable(); err != nil {
+		return nil, fmt.Errorf("creating migration table: %w", err)
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.verifyMigrations(files, applied); err != nil {
+		return nil, err
+	}
+
+	var migrated []Migration
+	for _, file := range files {
+		if _, ok := applied[file.version]; ok {
+			continue
+		}
+
+		err := inTransaction(context.Background(), db.conn, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(file.contents); err != nil {
+				return fmt.Errorf("executing migration %s: %w", file.name, err)
+			}
+
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, checksum) VALUES (?, ?)", file.version, file.checksum)
+			if err != nil {
+				return fmt.Errorf("recording migration %s: %w", file.name, err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return migrated, err
+		}
+
+		migrated = append(migrated, Migration{
+			Version:    file.version,
+			Name:       file.name,
+			Applied:    true,
+			AppliedAt:  time.Now(),
+			Reversible: file.down != "",
+		})
+	}
+
+	return migrated, nil
+}
+
+// MigrateDown reverts every applied migration newer than the target version, newest
+// first, and returns the ones that were reverted. Nothing is reverted if any of them
+// can't be.
+func (db *DB) MigrateDown(target int) ([]Migration, error) {
+	files, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.createMigrationTable(); err != nil {
+		return nil, fmt.Errorf("creating migration table: %w", err)
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.verifyMigrations(files, applied); err != nil {
+		return nil, err
+	}
+
+	var toRevert []migrationFile
+	for i := len(files) - 1; i >= 0; i-- {
+		file := files[i]
+		if _, ok := applied[file.version]; !ok || file.version <= target {
+			continue
+		}
+
+		if file.down == "" {
+			return nil, fmt.Errorf("migration %s can't be reverted", file.name)
+		}
+
+		toRevert = append(toRevert, file)
+	}
+
+	var reverted []Migration
+	for _, file := range toRevert {
+		err := inTransaction(context.Background(), db.conn, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(file.down); err != nil {
+				return fmt.Errorf("reverting migration %s: %w", file.name, err)
+			}
+
+			if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", file.version); err != nil {
+				return fmt.Errorf("removing record of migration %s: %w", file.name, err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return reverted, err
+		}
+
+		reverted = append(reverted, Migration{Version: file.version, Name: file.name, Reversible: true})
+	}
+
+	return reverted, nil
+}
+
+// Backup writes a consistent copy of the database to the given path while it's
+// in use. The copy is written to a temporary file first so that a failed backup
+// doesn't leave a partial one behind, and existing files are never overwritten.
+func (db *DB) Backup(destination string) error {
+	if _, err := os.Stat(destination); err == nil {
+		return fmt.Errorf("%s already exists", destination)
+	}
+
+	temporary := destination + ".tmp"
+	os.Remove(temporary)
+
+	if _, err := db.conn.Exec("VACUUM INTO ?", temporary); err != nil {
+		os.Remove(temporary)
+		return err
+	}
+
+	return os.Rename(temporary, destination)
+}
+
+// ErrInUse is returned when restoring over a database that's open in another process
+var ErrInUse = errors.New("database is in use, stop Glance before restoring it")
+
+// Glance keeps connections to the database open for as long as it's running, and in
+// WAL mode each of them holds a shared lock that stops the database from being
+// locked exclusively
+func checkNotInUse(path string) error {
+	conn, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=locking_mode(EXCLUSIVE)&_pragma=busy_timeout(0)", path))
+	if err != nil {
+		return fmt.Errorf("opening the current database: %w", err)
+	}
+	defer conn.Close()
+
+	var tables int
+	err = conn.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(&tables)
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_BUSY {
+		return ErrInUse
+	}
+
+	if err != nil {
+		return fmt.Errorf("checking whether the current database is in use: %w", err)
+	}
+
+	return nil
+}
+
+// Restore replaces the database at the given path with a backup after checking that
+// the backup is intact and that it wasn't made by a newer version of Glance. Glance
+// must not be running while restoring, ErrInUse is returned if it is. The database
+// that got replaced is moved next to it and its path is returned, or an empty string
+// if there wasn't one.
+//
+// The restored database is left at the schema version of the backup, opening it with
+// New migrates it to the latest one.
+func Restore(backup, destination string) (string, error) {
+	if _, err := os.Stat(backup); err != nil {
+		return "", err
+	}
+
+	conn, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro&_time_format=sqlite", backup))
+	if err != nil {
+		return "", fmt.Errorf("opening backup: %w", err)
+	}
+	defer conn.Close()
+
+	var integrity string
+	if err := conn.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return "", fmt.Errorf("checking backup integrity: %w", err)
+	}
+
+	if integrity != "ok" {
+		return "", fmt.Errorf("backup is corrupted: %s", integrity)
+	}
+
+	backupVersion, err := schemaVersion(conn)
+	if err != nil {
+		return "", errors.New("backup is not a Glance database")
+	}
+
+	latestVersion, err := LatestSchemaVersion()
+	if err != nil {
+		return "", err
+	}
+
+	if backupVersion > latestVersion {
+		return "", fmt.Errorf(
+			"backup has schema version %d which is newer than the latest one this version of Glance supports (%d)",
+			backupVersion, latestVersion,
+		)
+	}
+
+	temporary := destination + ".tmp"
+	os.Remove(temporary)
+
+	if _, err := conn.Exec("VACUUM INTO ?", temporary); err != nil {
+		os.Remove(temporary)
+		return "", fmt.Errorf("copying backup: %w", err)
+	}
+
+	var previous string
+	if _, err := os.Stat(destination); err == nil {
+		if err := checkNotInUse(destination); err != nil {
+			os.Remove(temporary)
+			return "", err
+		}
+
+		previous = destination + ".before-restore"
+
+		// The WAL and shared memory files belong to the database being replaced
+		// and would corrupt the restored one if they were left in place
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(previous + suffix)
+			if err := os.Rename(destination+suffix, previous+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				os.Remove(temporary)
+				return "", fmt.Errorf("moving the current database: %w", err)
+			}
+		}
+	}
+
+	if err := os.Rename(temporary, destination); err != nil {
+		return previous, fmt.Errorf("moving the restored database in place: %w", err)
+	}
+
+	return previous, nil
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "glance.db")
+	backup := filepath.Join(dir, "backup.db")
+	ctx := t.Context()
+
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	if err := db.WidgetData.Save(ctx, "todo", "to-do", "items", []string{"a"}); err != nil {
+		t.Fatalf("Failed to save widget data: %v", err)
+	}
+
+	if err := db.Backup(backup); err != nil {
+		t.Fatalf("Failed to back up database: %v", err)
+	}
+
+	if err := db.Backup(backup); err == nil {
+		t.Error("Expected backing up to an existing file to fail")
+	}
+
+	if err := db.WidgetData.DeleteAll(ctx, "todo"); err != nil {
+		t.Fatalf("Failed to delete widget data: %v", err)
+	}
+	db.Close()
+
+	previous, err := Restore(backup, path)
+	if err != nil {
+		t.Fatalf("Failed to restore database: %v", err)
+	}
+
+	if _, err := os.Stat(previous); err != nil {
+		t.Errorf("Expected the replaced database to be kept: %v", err)
+	}
+
+	db, err = New(path)
+	if err != nil {
+		t.Fatalf("Failed to open restored database: %v", err)
+	}
+	defer db.Close()
+
+	if data, _ := db.WidgetData.Get(ctx, "todo", "items"); data == nil {
+		t.Error("Expected the widget data from the backup to be restored")
+	}
+}
+
+func TestRestoreRefusesNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "backup.db")
+
+	db, err := New(backup)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	if _, err := db.Exec("INSERT INTO schema_migrations (version) VALUES (999)"); err != nil {
+		t.Fatalf("Failed to record migration: %v", err)
+	}
+	db.Close()
+
+	_, err = Restore(backup, filepath.Join(dir, "glance.db"))
+	if err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("Expected restoring a backup with a newer schema to fail, got %v", err)
+	}
+}
+
+func TestRestoreRefusesDatabaseInUse(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "glance.db")
+	backup := filepath.Join(dir, "backup.db")
+
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	if err := db.Backup(backup); err != nil {
+		t.Fatalf("Failed to back up database: %v", err)
+	}
+
+	if _, err := Restore(backup, path); !errors.Is(err, ErrInUse) {
+		t.Errorf("Expected ErrInUse while the database is open, got %v", err)
+	}
+
+	if _, err := os.Stat(path + ".before-restore"); err == nil {
+		t.Error("Expected the database in use not to be moved")
+	}
+	db.Close()
+
+	if _, err := Restore(backup, path); err != nil {
+		t.Errorf("Expected restoring to succeed once the database was closed, got %v", err)
+	}
+}
+
+func TestMigrationStatusDoesNotChangeDatabase(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	migrations, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("Failed to get migration status: %v", err)
+	}
+
+	for _, migration := range migrations {
+		if migration.Applied {
+			t.Errorf("Expected %s to be pending", migration.Name)
+		}
+	}
+
+	if version, err := db.SchemaVersion(); err != nil || version != 0 {
+		t.Errorf("Expected schema version 0, got %d (%v)", version, err)
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(&tables); err != nil {
+		t.Fatalf("Failed to count tables: %v", err)
+	}
+
+	if tables != 0 {
+		t.Errorf("Expected checking the status not to create any tables, found %d", tables)
+	}
+}
+
+func TestMigrateDetectsDrift(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.Exec("UPDATE schema_migrations SET checksum = 'edited' WHERE version = 3"); err != nil {
+		t.Fatalf("Failed to change checksum: %v", err)
+	}
+
+	if _, err := db.Migrate(); err == nil || !strings.Contains(err.Error(), "003_widget_snapshots") {
+		t.Errorf("Expected a changed migration to be detected, got %v", err)
+	}
+
+	// Migrations applied before checksums were recorded are trusted
+	if _, err := db.Exec("UPDATE schema_migrations SET checksum = ''"); err != nil {
+		t.Fatalf("Failed to clear checksums: %v", err)
+	}
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("Expected migrations without a checksum to be accepted, got %v", err)
+	}
+
+	var missing int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE checksum = ''").Scan(&missing); err != nil {
+		t.Fatalf("Failed to count checksums: %v", err)
+	}
+
+	if missing != 0 {
+		t.Errorf("Expected missing checksums to be recorded, %d are still missing", missing)
+	}
+
+	if _, err := db.Exec("DELETE FROM schema_migrations WHERE version = 2"); err != nil {
+		t.Fatalf("Failed to delete migration: %v", err)
+	}
+
+	if _, err := db.Migrate(); err == nil || !strings.Contains(err.Error(), "never applied") {
+		t.Errorf("Expected a gap to be detected, got %v", err)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.Exec("INSERT INTO schema_migrations (version) VALUES (999)"); err != nil {
+		t.Fatalf("Failed to record migration: %v", err)
+	}
+
+	if _, err := db.Migrate(); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	db := newTestDB(t)
+
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to get latest schema version: %v", err)
+	}
+
+	reverted, err := db.MigrateDown(0)
+	if err != nil {
+		t.Fatalf("Failed to migrate down: %v", err)
+	}
+
+	if len(reverted) != latest || reverted[0].Version != latest {
+		t.Fatalf("Expected every migration to be reverted newest first, got %+v", reverted)
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')").Scan(&tables); err != nil {
+		t.Fatalf("Failed to count tables: %v", err)
+	}
+
+	if tables != 0 {
+		t.Errorf("Expected every table to be dropped, %d remain", tables)
+	}
+
+	applied, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("Failed to migrate up again: %v", err)
+	}
+
+	if len(applied) != latest {
+		t.Errorf("Expected every migration to be applied again, got %+v", applied)
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS rate_limits;
+DROP TABLE IF EXISTS dashboard_profiles;
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS activity_log;
+DROP TABLE IF EXISTS widget_history;
+DROP TABLE IF EXISTS widget_data;
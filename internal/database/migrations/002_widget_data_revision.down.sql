@@ -0,0 +1 @@
+ALTER TABLE widget_data DROP COLUMN revision;
@@ -0,0 +1,3 @@
+-- Revision counter used for optimistic concurrency when multiple
+-- clients write to the same widget data key
+ALTER TABLE widget_data ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,13 @@
+-- Data from the last successful update of widgets, used to show
+-- content right away after a restart instead of refetching it
+CREATE TABLE IF NOT EXISTS widget_snapshots (
+    widget_id TEXT PRIMARY KEY,
+    widget_type TEXT NOT NULL,
+    config_hash TEXT NOT NULL,
+    glance_version TEXT NOT NULL,
+    data TEXT NOT NULL,
+    next_update TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_widget_snapshots_updated ON widget_snapshots(updated_at);
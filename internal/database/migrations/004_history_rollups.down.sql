@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS widget_history_rollup_state;
+DROP TABLE IF EXISTS widget_history_rollups;
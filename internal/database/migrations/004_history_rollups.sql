@@ -0,0 +1,26 @@
+-- Recorded history downsampled into fixed size buckets so that it can be
+-- kept for much longer than the raw points it was computed from
+CREATE TABLE IF NOT EXISTS widget_history_rollups (
+    widget_id TEXT NOT NULL,
+    widget_type TEXT NOT NULL,
+    metric_name TEXT NOT NULL,
+    -- Size of the bucket in seconds
+    resolution INTEGER NOT NULL,
+    -- Unix timestamp of the start of the bucket
+    bucket_start INTEGER NOT NULL,
+    min_value REAL NOT NULL,
+    max_value REAL NOT NULL,
+    sum_value REAL NOT NULL,
+    sample_count INTEGER NOT NULL,
+    last_value REAL NOT NULL,
+    PRIMARY KEY (widget_id, metric_name, resolution, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_history_rollups_cleanup ON widget_history_rollups(resolution, bucket_start);
+
+-- How far each resolution has been rolled up, everything before
+-- this has already been folded into its buckets
+CREATE TABLE IF NOT EXISTS widget_history_rollup_state (
+    resolution INTEGER PRIMARY KEY,
+    rolled_until INTEGER NOT NULL
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS alert_states;
+DROP INDEX IF EXISTS idx_alerts_name;
+ALTER TABLE alerts DROP COLUMN source;
+ALTER TABLE alerts DROP COLUMN name;
@@ -0,0 +1,21 @@
+-- Alert rules are looked up by their name and either come from the config
+-- file, in which case they're replaced on every reload, or from the API
+ALTER TABLE alerts ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE alerts ADD COLUMN source TEXT NOT NULL DEFAULT 'api';
+UPDATE alerts SET name = 'alert-' || id WHERE name = '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_name ON alerts(name);
+
+-- Where each subject of an alert rule is at, such as every site of a monitor
+-- widget, kept so that firing alerts aren't forgotten when Glance restarts
+CREATE TABLE IF NOT EXISTS alert_states (
+    alert_id INTEGER NOT NULL,
+    subject TEXT NOT NULL,
+    status TEXT NOT NULL,
+    changed_at TIMESTAMP NOT NULL,
+    fired_at TIMESTAMP,
+    last_notified TIMESTAMP,
+    notified BOOLEAN NOT NULL DEFAULT 0,
+    detail TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (alert_id, subject)
+);
@@ -0,0 +1,6 @@
+-- Profiles are switched between by their name so it has to be unique, any
+-- duplicates from before this was enforced get the ID appended to their name
+UPDATE dashboard_profiles SET name = name || '-' || id
+WHERE id NOT IN (SELECT MIN(id) FROM dashboard_profiles GROUP BY name);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_profiles_name ON dashboard_profiles(name);
@@ -0,0 +1,9 @@
+-- Every config that Glance accepted, the merged contents being what was parsed
+-- and the files being what each of the config files contained at the time
+CREATE TABLE IF NOT EXISTS config_versions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    hash TEXT NOT NULL,
+    contents TEXT NOT NULL,
+    files_json TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,7 @@
+-- Sessions are stored under the hash of their token along with where they were
+-- used from, last_seen_at being updated at most about once a minute
+ALTER TABLE sessions ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN last_seen_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ProfileRepository stores dashboard profiles, of which at most one is active at a time
+type ProfileRepository struct {
+	conn *sql.DB
+}
+
+type Profile struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	ConfigJSON  string    `json:"config"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ErrProfileNameTaken is returned when saving a profile with the name of another one
+var ErrProfileNameTaken = errors.New("a profile with that name already exists")
+
+const profileColumns = "id, name, COALESCE(description, ''), config_json, is_active, created_at, updated_at"
+
+// Create stores a new, inactive profile and sets its ID
+func (r *ProfileRepository) Create(ctx context.Context, profile *Profile) error {
+	query := `
+	INSERT INTO dashboard_profiles (name, description, config_json)
+	VALUES (?, ?, ?)
+	`
+
+	result, err := r.conn.ExecContext(ctx, query, profile.Name, profile.Description, profile.ConfigJSON)
+	if err != nil {
+		return convertProfileError(err)
+	}
+
+	profile.ID, err = result.LastInsertId()
+	return err
+}
+
+// Get returns a profile or nil if it doesn't exist
+func (r *ProfileRepository) Get(ctx context.Context, id int64) (*Profile, error) {
+	return r.get(ctx, "SELECT "+profileColumns+" FROM dashboard_profiles WHERE id = ?", id)
+}
+
+// GetByName returns a profile or nil if it doesn't exist
+func (r *ProfileRepository) GetByName(ctx context.Context, name string) (*Profile, error) {
+	return r.get(ctx, "SELECT "+profileColumns+" FROM dashboard_profiles WHERE name = ?", name)
+}
+
+// Active returns the active profile or nil if none is
+func (r *ProfileRepository) Active(ctx context.Context) (*Profile, error) {
+	return r.get(ctx, "SELECT "+profileColumns+" FROM dashboard_profiles WHERE is_active = 1 LIMIT 1")
+}
+
+func (r *ProfileRepository) get(ctx context.Context, query string, args ...any) (*Profile, error) {
+	profile, err := scanProfile(r.conn.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return profile, err
+}
+
+// List returns all profiles ordered by name
+func (r *ProfileRepository) List(ctx context.Context) ([]Profile, error) {
+	rows, err := r.conn.QueryContext(ctx, "SELECT "+profileColumns+" FROM dashboard_profiles ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]Profile, 0)
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *profile)
+	}
+
+	return profiles, rows.Err()
+}
+
+// Update replaces the name, description and config of a profile
+func (r *ProfileRepository) Update(ctx context.Context, profile *Profile) error {
+	query := `
+	UPDATE dashboard_profiles
+	SET name = ?, description = ?, config_json = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+
+	_, err := r.conn.ExecContext(ctx, query, profile.Name, profile.Description, profile.ConfigJSON, profile.ID)
+	return convertProfileError(err)
+}
+
+// Activate makes a profile the active one, deactivating any other
+func (r *ProfileRepository) Activate(ctx context.Context, id int64) error {
+	return inTransaction(ctx, r.conn, func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM dashboard_profiles WHERE id = ?)", id).Scan(&exists); err != nil {
+			return err
+		}
+
+		if !exists {
+			return ErrNotFound
+		}
+
+		_, err := tx.ExecContext(ctx, "UPDATE dashboard_profiles SET is_active = (id = ?)", id)
+		return err
+	})
+}
+
+// Deactivate makes no profile the active one
+func (r *ProfileRepository) Deactivate(ctx context.Context) error {
+	_, err := r.conn.ExecContext(ctx, "UPDATE dashboard_profiles SET is_active = 0 WHERE is_active = 1")
+	return err
+}
+
+// Delete removes a profile
+func (r *ProfileRepository) Delete(ctx context.Context, id int64) error {
+	_, err := r.conn.ExecContext(ctx, "DELETE FROM dashboard_profiles WHERE id = ?", id)
+	return err
+}
+
+func convertProfileError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: dashboard_profiles.name") {
+		return ErrProfileNameTaken
+	}
+
+	return err
+}
+
+func scanProfile(row rowScanner) (*Profile, error) {
+	var profile Profile
+	if err := row.Scan(
+		&profile.ID,
+		&profile.Name,
+		&profile.Description,
+		&profile.ConfigJSON,
+		&profile.Active,
+		&profile.CreatedAt,
+		&profile.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestActivateProfile(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+
+	home := Profile{Name: "Home", ConfigJSON: "{}"}
+	work := Profile{Name: "Work", ConfigJSON: "{}"}
+
+	for _, profile := range []*Profile{&home, &work} {
+		if err := db.Profiles.Create(ctx, profile); err != nil {
+			t.Fatalf("Failed to create profile: %v", err)
+		}
+	}
+
+	if active, _ := db.Profiles.Active(ctx); active != nil {
+		t.Errorf("Expected no profile to be active, got %+v", active)
+	}
+
+	for _, profile := range []Profile{home, work} {
+		if err := db.Profiles.Activate(ctx, profile.ID); err != nil {
+			t.Fatalf("Failed to activate profile: %v", err)
+		}
+
+		active, err := db.Profiles.Active(ctx)
+		if err != nil || active == nil || active.ID != profile.ID {
+			t.Errorf("Expected %s to be the active profile, got %+v", profile.Name, active)
+		}
+	}
+
+	if err := db.Profiles.Activate(ctx, work.ID+1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected activating a missing profile to fail with ErrNotFound, got %v", err)
+	}
+
+	if active, _ := db.Profiles.Active(ctx); active == nil || active.ID != work.ID {
+		t.Errorf("Expected the active profile to be unchanged, got %+v", active)
+	}
+
+	if err := db.Profiles.Create(ctx, &Profile{Name: "Home", ConfigJSON: "{}"}); !errors.Is(err, ErrProfileNameTaken) {
+		t.Errorf("Expected creating a profile with a taken name to fail with ErrProfileNameTaken, got %v", err)
+	}
+
+	if err := db.Profiles.Deactivate(ctx); err != nil {
+		t.Fatalf("Failed to deactivate profiles: %v", err)
+	}
+
+	if active, _ := db.Profiles.Active(ctx); active != nil {
+		t.Errorf("Expected no profile to be active after deactivating, got %+v", active)
+	}
+}
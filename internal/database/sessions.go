@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SessionRepository stores the server side sessions of logged in users
+type SessionRepository struct {
+	conn *sql.DB
+}
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Data       string    `json:"data,omitempty"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+const sessionColumns = `
+	id, COALESCE(user_id, ''), COALESCE(data, ''), ip_address, user_agent,
+	expires_at, created_at, last_seen_at
+`
+
+// Create stores a new session
+func (r *SessionRepository) Create(ctx context.Context, session *Session) error {
+	query := `
+	INSERT INTO sessions (id, user_id, data, ip_address, user_agent, expires_at, created_at, last_seen_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+
+	if session.LastSeenAt.IsZero() {
+		session.LastSeenAt = session.CreatedAt
+	}
+
+	_, err := r.conn.ExecContext(
+		ctx, query,
+		session.ID, session.UserID, session.Data, session.IPAddress, session.UserAgent,
+		session.ExpiresAt.UTC(), session.CreatedAt.UTC(), session.LastSeenAt.UTC(),
+	)
+	return err
+}
+
+// Get returns a session or nil if it doesn't exist or has expired
+func (r *SessionRepository) Get(ctx context.Context, id string, now time.Time) (*Session, error) {
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE id = ? AND expires_at >= ?"
+
+	session, err := scanSession(r.conn.QueryRowContext(ctx, query, id, now.UTC()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return session, err
+}
+
+// ListForUser returns the sessions of a user that haven't expired, most recently used first
+func (r *SessionRepository) ListForUser(ctx context.Context, userID string, now time.Time) ([]Session, error) {
+	query := "SELECT " + sessionColumns + `
+	FROM sessions
+	WHERE user_id = ? AND expires_at >= ?
+	ORDER BY COALESCE(last_seen_at, created_at) DESC
+	`
+
+	rows, err := r.conn.QueryContext(ctx, query, userID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Touch records that a session was just used and from where, pushing back when it expires
+func (r *SessionRepository) Touch(ctx context.Context, id string, ipAddress string, lastSeen, expiresAt time.Time) error {
+	query := `
+	UPDATE sessions
+	SET last_seen_at = ?, expires_at = ?, ip_address = ?
+	WHERE id = ?
+	`
+
+	_, err := r.conn.ExecContext(ctx, query, lastSeen.UTC(), expiresAt.UTC(), ipAddress, id)
+	return err
+}
+
+// Delete removes a session
+func (r *SessionRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.conn.ExecContext(ctx, "DELETE FROM sessions WHERE id = ?", id)
+	return err
+}
+
+// DeleteForUser removes all sessions of a user and returns how many there were
+func (r *SessionRepository) DeleteForUser(ctx context.Context, userID string) (int64, error) {
+	return execCountingRows(ctx, r.conn, "DELETE FROM sessions WHERE user_id = ?", userID)
+}
+
+// DeleteExpired removes sessions that expired before the given time
+func (r *SessionRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	return execCountingRows(ctx, r.conn, "DELETE FROM sessions WHERE expires_at < ?", now.UTC())
+}
+
+func scanSession(row rowScanner) (*Session, error) {
+	var session Session
+	var lastSeen sql.NullTime
+
+	if err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Data,
+		&session.IPAddress,
+		&session.UserAgent,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+		&lastSeen,
+	); err != nil {
+		return nil, err
+	}
+
+	session.LastSeenAt = lastSeen.Time
+	// Sessions created before this was recorded haven't been seen since
+	if !lastSeen.Valid {
+		session.LastSeenAt = session.CreatedAt
+	}
+
+	return &session, nil
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionsExpireUnlessTouched(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+	now := time.Now()
+
+	for _, session := range []*Session{
+		{ID: "laptop", UserID: "admin", IPAddress: "10.0.0.2", UserAgent: "Firefox", ExpiresAt: now.Add(time.Hour), CreatedAt: now.Add(-time.Hour)},
+		{ID: "phone", UserID: "admin", ExpiresAt: now.Add(time.Hour), CreatedAt: now},
+		{ID: "other", UserID: "guest", ExpiresAt: now.Add(time.Hour), CreatedAt: now},
+	} {
+		if err := db.Sessions.Create(ctx, session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+
+	later := now.Add(90 * time.Minute)
+	if err := db.Sessions.Touch(ctx, "laptop", "10.0.0.3", now.Add(30*time.Minute), later.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to touch session: %v", err)
+	}
+
+	sessions, err := db.Sessions.ListForUser(ctx, "admin", later)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+
+	if len(sessions) != 1 || sessions[0].ID != "laptop" {
+		t.Fatalf("Expected only the touched session to still be active, got %+v", sessions)
+	}
+
+	if sessions[0].IPAddress != "10.0.0.3" || sessions[0].UserAgent != "Firefox" || !sessions[0].LastSeenAt.Equal(now.Add(30*time.Minute)) {
+		t.Errorf("Unexpected session %+v", sessions[0])
+	}
+
+	if session, _ := db.Sessions.Get(ctx, "phone", later); session != nil {
+		t.Errorf("Expected expired sessions not to be returned, got %+v", session)
+	}
+
+	deleted, err := db.Sessions.DeleteForUser(ctx, "admin")
+	if err != nil || deleted != 2 {
+		t.Fatalf("Expected both sessions of the user to be deleted, got %d (%v)", deleted, err)
+	}
+
+	if session, _ := db.Sessions.Get(ctx, "other", now); session == nil {
+		t.Error("Expected the sessions of other users to be kept")
+	}
+}
@@ -1,11 +1,24 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
+// WidgetDataRepository stores arbitrary data of widgets by key, such as the tasks of to-do lists
+type WidgetDataRepository struct {
+	conn *sql.DB
+}
+
+// ErrRevisionConflict is returned when a conditional save is attempted
+// against a revision that is no longer the current one
+var ErrRevisionConflict = errors.New("widget data revision conflict")
+
 // WidgetData represents persisted widget data
 type WidgetData struct {
 	ID        int64       `json:"id"`
@@ -13,12 +26,13 @@ type WidgetData struct {
 	Type      string      `json:"type"`
 	DataKey   string      `json:"key"`
 	DataValue interface{} `json:"value"`
+	Revision  int64       `json:"revision"`
 	UpdatedAt time.Time   `json:"updated_at"`
 }
 
-// SaveWidgetData saves or updates widget data
-func (db *DB) SaveWidgetData(widgetID, widgetType, key string, value interface{}) error {
-	if db.conn == nil {
+// Save saves or updates widget data
+func (r *WidgetDataRepository) Save(ctx context.Context, widgetID, widgetType, key string, value interface{}) error {
+	if r.conn == nil {
 		return fmt.Errorf("database connection not initialized")
 	}
 
@@ -30,22 +44,66 @@ func (db *DB) SaveWidgetData(widgetID, widgetType, key string, value interface{}
 	query := `
 	INSERT INTO widget_data (widget_id, widget_type, data_key, data_value, updated_at)
 	VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
-	ON CONFLICT(widget_id, data_key) 
-	DO UPDATE SET data_value=excluded.data_value, updated_at=CURRENT_TIMESTAMP
+	ON CONFLICT(widget_id, data_key)
+	DO UPDATE SET data_value=excluded.data_value, revision=revision+1, updated_at=CURRENT_TIMESTAMP
 	`
 
-	_, err = db.conn.Exec(query, widgetID, widgetType, key, string(jsonValue))
+	_, err = r.conn.ExecContext(ctx, query, widgetID, widgetType, key, string(jsonValue))
 	return err
 }
 
-// GetWidgetData retrieves a specific piece of widget data
-func (db *DB) GetWidgetData(widgetID, key string) (*WidgetData, error) {
-	if db.conn == nil {
+// SaveIfRevision saves widget data only if the currently stored revision
+// matches expectedRevision, where a revision of 0 means that the key must not exist yet.
+// Returns the new revision or ErrRevisionConflict if the data was changed in the meantime.
+func (r *WidgetDataRepository) SaveIfRevision(ctx context.Context, widgetID, widgetType, key string, value interface{}, expectedRevision int64) (int64, error) {
+	if r.conn == nil {
+		return 0, fmt.Errorf("database connection not initialized")
+	}
+
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling value: %w", err)
+	}
+
+	var result sql.Result
+	if expectedRevision == 0 {
+		result, err = r.conn.ExecContext(ctx, `
+		INSERT INTO widget_data (widget_id, widget_type, data_key, data_value, revision, updated_at)
+		VALUES (?, ?, ?, ?, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT(widget_id, data_key) DO NOTHING
+		`, widgetID, widgetType, key, string(jsonValue))
+	} else {
+		result, err = r.conn.ExecContext(ctx, `
+		UPDATE widget_data
+		SET data_value = ?, widget_type = ?, revision = revision + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE widget_id = ? AND data_key = ? AND revision = ?
+		`, string(jsonValue), widgetType, widgetID, key, expectedRevision)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if affected == 0 {
+		return 0, ErrRevisionConflict
+	}
+
+	return expectedRevision + 1, nil
+}
+
+// Get retrieves a specific piece of widget data
+func (r *WidgetDataRepository) Get(ctx context.Context, widgetID, key string) (*WidgetData, error) {
+	if r.conn == nil {
 		return nil, fmt.Errorf("database connection not initialized")
 	}
 
 	query := `
-	SELECT id, widget_id, widget_type, data_key, data_value, updated_at
+	SELECT id, widget_id, widget_type, data_key, data_value, revision, updated_at
 	FROM widget_data
 	WHERE widget_id = ? AND data_key = ?
 	`
@@ -53,8 +111,8 @@ func (db *DB) GetWidgetData(widgetID, key string) (*WidgetData, error) {
 	var wd WidgetData
 	var jsonValue string
 
-	err := db.conn.QueryRow(query, widgetID, key).Scan(
-		&wd.ID, &wd.WidgetID, &wd.Type, &wd.DataKey, &jsonValue, &wd.UpdatedAt,
+	err := r.conn.QueryRowContext(ctx, query, widgetID, key).Scan(
+		&wd.ID, &wd.WidgetID, &wd.Type, &wd.DataKey, &jsonValue, &wd.Revision, &wd.UpdatedAt,
 	)
 
 	if err != nil {
@@ -68,20 +126,20 @@ func (db *DB) GetWidgetData(widgetID, key string) (*WidgetData, error) {
 	return &wd, nil
 }
 
-// GetAllWidgetData retrieves all data for a widget
-func (db *DB) GetAllWidgetData(widgetID string) ([]WidgetData, error) {
-	if db.conn == nil {
+// List retrieves all data for a widget
+func (r *WidgetDataRepository) List(ctx context.Context, widgetID string) ([]WidgetData, error) {
+	if r.conn == nil {
 		return nil, fmt.Errorf("database connection not initialized")
 	}
 
 	query := `
-	SELECT id, widget_id, widget_type, data_key, data_value, updated_at
+	SELECT id, widget_id, widget_type, data_key, data_value, revision, updated_at
 	FROM widget_data
 	WHERE widget_id = ?
 	ORDER BY data_key
 	`
 
-	rows, err := db.conn.Query(query, widgetID)
+	rows, err := r.conn.QueryContext(ctx, query, widgetID)
 	if err != nil {
 		return nil, fmt.Errorf("querying widget data: %w", err)
 	}
@@ -92,7 +150,7 @@ func (db *DB) GetAllWidgetData(widgetID string) ([]WidgetData, error) {
 		var wd WidgetData
 		var jsonValue string
 
-		if err := rows.Scan(&wd.ID, &wd.WidgetID, &wd.Type, &wd.DataKey, &jsonValue, &wd.UpdatedAt); err != nil {
+		if err := rows.Scan(&wd.ID, &wd.WidgetID, &wd.Type, &wd.DataKey, &jsonValue, &wd.Revision, &wd.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scanning widget data: %w", err)
 		}
 
@@ -110,24 +168,41 @@ func (db *DB) GetAllWidgetData(widgetID string) ([]WidgetData, error) {
 	return results, nil
 }
 
-// DeleteWidgetData deletes a piece of widget data
-func (db *DB) DeleteWidgetData(widgetID, key string) error {
-	if db.conn == nil {
+// Delete deletes a piece of widget data
+func (r *WidgetDataRepository) Delete(ctx context.Context, widgetID, key string) error {
+	if r.conn == nil {
 		return fmt.Errorf("database connection not initialized")
 	}
 
 	query := `DELETE FROM widget_data WHERE widget_id = ? AND data_key = ?`
-	_, err := db.conn.Exec(query, widgetID, key)
+	_, err := r.conn.ExecContext(ctx, query, widgetID, key)
 	return err
 }
 
-// DeleteAllWidgetData deletes all data for a widget
-func (db *DB) DeleteAllWidgetData(widgetID string) error {
-	if db.conn == nil {
+// DeleteAll deletes all data for a widget
+func (r *WidgetDataRepository) DeleteAll(ctx context.Context, widgetID string) error {
+	if r.conn == nil {
 		return fmt.Errorf("database connection not initialized")
 	}
 
 	query := `DELETE FROM widget_data WHERE widget_id = ?`
-	_, err := db.conn.Exec(query, widgetID)
+	_, err := r.conn.ExecContext(ctx, query, widgetID)
 	return err
 }
+
+// DeleteOrphaned removes the data of widgets that aren't in keepWidgetIDs and that
+// hasn't been changed since the given time, which is usually left behind by widgets
+// that have been removed from the config
+func (r *WidgetDataRepository) DeleteOrphaned(ctx context.Context, keepWidgetIDs []string, before time.Time) (int64, error) {
+	query := "DELETE FROM widget_data WHERE updated_at < ?"
+	args := []any{before.UTC()}
+
+	if len(keepWidgetIDs) > 0 {
+		query += " AND widget_id NOT IN (" + strings.TrimSuffix(strings.Repeat("?,", len(keepWidgetIDs)), ",") + ")"
+		for _, id := range keepWidgetIDs {
+			args = append(args, id)
+		}
+	}
+
+	return execCountingRows(ctx, r.conn, query, args...)
+}
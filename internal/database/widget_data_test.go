@@ -0,0 +1,63 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestSaveWidgetDataIfRevision(t *testing.T) {
+	db := newTestDB(t)
+	ctx := t.Context()
+
+	revision, err := db.WidgetData.SaveIfRevision(ctx, "todo", "to-do", "items", []string{"a"}, 0)
+	if err != nil {
+		t.Fatalf("Initial save failed: %v", err)
+	}
+
+	if revision != 1 {
+		t.Fatalf("Expected revision 1 after initial save, got %d", revision)
+	}
+
+	if _, err := db.WidgetData.SaveIfRevision(ctx, "todo", "to-do", "items", []string{"b"}, 0); !errors.Is(err, ErrRevisionConflict) {
+		t.Fatalf("Expected conflict when creating an existing key, got %v", err)
+	}
+
+	revision, err = db.WidgetData.SaveIfRevision(ctx, "todo", "to-do", "items", []string{"a", "b"}, 1)
+	if err != nil {
+		t.Fatalf("Save with current revision failed: %v", err)
+	}
+
+	if revision != 2 {
+		t.Fatalf("Expected revision 2, got %d", revision)
+	}
+
+	if _, err := db.WidgetData.SaveIfRevision(ctx, "todo", "to-do", "items", []string{"c"}, 1); !errors.Is(err, ErrRevisionConflict) {
+		t.Fatalf("Expected conflict when saving with a stale revision, got %v", err)
+	}
+
+	if err := db.WidgetData.Save(ctx, "todo", "to-do", "items", []string{"d"}); err != nil {
+		t.Fatalf("Unconditional save failed: %v", err)
+	}
+
+	data, err := db.WidgetData.Get(ctx, "todo", "items")
+	if err != nil {
+		t.Fatalf("Failed to get widget data: %v", err)
+	}
+
+	if data.Revision != 3 {
+		t.Fatalf("Expected unconditional save to bump the revision to 3, got %d", data.Revision)
+	}
+}
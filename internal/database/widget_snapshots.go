@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SnapshotRepository stores the data from the last successful update of widgets
+type SnapshotRepository struct {
+	conn *sql.DB
+}
+
+// WidgetSnapshot holds the data from the last successful update of a widget
+type WidgetSnapshot struct {
+	WidgetID   string
+	WidgetType string
+	// Hash of the widget's config at the time the snapshot was taken
+	ConfigHash string
+	// Version of Glance that took the snapshot
+	Version    string
+	Data       []byte
+	NextUpdate time.Time
+	UpdatedAt  time.Time
+}
+
+// Save saves a snapshot, replacing any previous one of the same widget
+func (r *SnapshotRepository) Save(ctx context.Context, snapshot *WidgetSnapshot) error {
+	query := `
+	INSERT INTO widget_snapshots (widget_id, widget_type, config_hash, glance_version, data, next_update, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(widget_id)
+	DO UPDATE SET
+		widget_type=excluded.widget_type,
+		config_hash=excluded.config_hash,
+		glance_version=excluded.glance_version,
+		data=excluded.data,
+		next_update=excluded.next_update,
+		updated_at=CURRENT_TIMESTAMP
+	`
+
+	_, err := r.conn.ExecContext(
+		ctx,
+		query,
+		snapshot.WidgetID,
+		snapshot.WidgetType,
+		snapshot.ConfigHash,
+		snapshot.Version,
+		string(snapshot.Data),
+		snapshot.NextUpdate.UTC(),
+	)
+
+	return err
+}
+
+// Get returns the snapshot of a widget or nil if it doesn't have one
+func (r *SnapshotRepository) Get(ctx context.Context, widgetID string) (*WidgetSnapshot, error) {
+	query := `
+	SELECT widget_id, widget_type, config_hash, glance_version, data, next_update, updated_at
+	FROM widget_snapshots
+	WHERE widget_id = ?
+	`
+
+	var snapshot WidgetSnapshot
+	var data string
+
+	err := r.conn.QueryRowContext(ctx, query, widgetID).Scan(
+		&snapshot.WidgetID,
+		&snapshot.WidgetType,
+		&snapshot.ConfigHash,
+		&snapshot.Version,
+		&data,
+		&snapshot.NextUpdate,
+		&snapshot.UpdatedAt,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("querying widget snapshot: %w", err)
+	}
+
+	snapshot.Data = []byte(data)
+
+	return &snapshot, nil
+}
+
+// DeleteOlderThan removes snapshots that haven't been updated since the given time,
+// which are usually left behind by widgets that have been removed from the config
+func (r *SnapshotRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	return execCountingRows(ctx, r.conn, "DELETE FROM widget_snapshots WHERE updated_at < ?", before.UTC())
+}
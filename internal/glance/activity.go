@@ -0,0 +1,83 @@
+package glance
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+const (
+	activityWidgetUpdateFailed    = "widget_update_failed"
+	activityWidgetUpdateRecovered = "widget_update_recovered"
+	activityConfigReloaded        = "config_reloaded"
+	activityConfigError           = "config_error"
+	activityLogin                 = "login"
+	activityLoginFailed           = "login_failed"
+	activitySessionsRevoked       = "sessions_revoked"
+	activityMonitorStatusChanged  = "monitor_status_changed"
+	activityContainerStateChanged = "container_state_changed"
+	activityAlertTriggered        = "alert_triggered"
+	activityAlertResolved         = "alert_resolved"
+	activityNotificationFailed    = "notification_failed"
+)
+
+const (
+	activityLevelInfo    = "info"
+	activityLevelSuccess = "success"
+	activityLevelWarning = "warning"
+	activityLevelError   = "error"
+)
+
+type activityEvent struct {
+	Type      string
+	Level     string
+	Message   string
+	WidgetID  string
+	User      string
+	IPAddress string
+	// Additional details stored alongside the message and level
+	Details map[string]any
+}
+
+// Does nothing if the database isn't enabled since there's nowhere to keep the log
+func recordActivity(db *database.DB, event activityEvent) {
+	if db == nil {
+		return
+	}
+
+	details := make(map[string]any, len(event.Details)+2)
+	for key, value := range event.Details {
+		details[key] = value
+	}
+
+	details["message"] = event.Message
+	details["level"] = ternary(event.Level == "", activityLevelInfo, event.Level)
+
+	err := db.Activity.Log(context.Background(), event.Type, event.WidgetID, event.User, event.IPAddress, details)
+	if err != nil {
+		slog.Error("Failed to record activity", "type", event.Type, "error", err)
+	}
+}
+
+// Only records the update if the widget went from working to failing or
+// the other way around so that a widget which keeps failing doesn't flood the log
+func recordWidgetUpdateActivity(db *database.DB, widget widget, previousErr error) {
+	err := widget.getError()
+
+	if err != nil && previousErr == nil {
+		recordActivity(db, activityEvent{
+			Type:     activityWidgetUpdateFailed,
+			Level:    activityLevelError,
+			Message:  "Failed to update " + widget.GetType() + " widget: " + err.Error(),
+			WidgetID: widget.GetID(),
+		})
+	} else if err == nil && previousErr != nil {
+		recordActivity(db, activityEvent{
+			Type:     activityWidgetUpdateRecovered,
+			Level:    activityLevelSuccess,
+			Message:  "The " + widget.GetType() + " widget is updating successfully again",
+			WidgetID: widget.GetID(),
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package glance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+const maxAlertRequestBodySize = 64 * 1024
+
+type alertResponse struct {
+	*alertRule
+	States []alertStateResponse `json:"states"`
+}
+
+type alertStateResponse struct {
+	Subject string    `json:"subject"`
+	Status  string    `json:"status"`
+	Since   time.Time `json:"since"`
+	FiredAt time.Time `json:"fired_at,omitzero"`
+}
+
+func (a *application) registerAlertRoutes() {
+	a.apiServer.Handle("GET /api/v1/alerts", http.HandlerFunc(a.handleListAlerts))
+	a.apiServer.Handle("POST /api/v1/alerts", http.HandlerFunc(a.handleCreateAlert))
+	a.apiServer.Handle("GET /api/v1/alerts/{id}", http.HandlerFunc(a.handleGetAlert))
+	a.apiServer.Handle("PUT /api/v1/alerts/{id}", http.HandlerFunc(a.handleUpdateAlert))
+	a.apiServer.Handle("DELETE /api/v1/alerts/{id}", http.HandlerFunc(a.handleDeleteAlert))
+}
+
+func (a *application) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAlerts(w) {
+		return
+	}
+
+	alerts, err := a.services.db.Alerts.List(r.Context(), r.URL.Query().Get("widget"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve alerts: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]alertResponse, 0, len(alerts))
+	for i := range alerts {
+		rule, err := alertRuleFromDatabase(&alerts[i])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response = append(response, a.newAlertResponse(rule))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *application) handleGetAlert(w http.ResponseWriter, r *http.Request) {
+	rule, ok := a.alertRuleOfRequest(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.newAlertResponse(rule))
+}
+
+func (a *application) handleCreateAlert(w http.ResponseWriter, r *http.Request) {
+	if !a.requireAlerts(w) {
+		return
+	}
+
+	rule, ok := a.decodeAlertRule(w, r)
+	if !ok {
+		return
+	}
+
+	alert, err := rule.toDatabase()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.services.db.Alerts.Create(r.Context(), alert); err != nil {
+		a.writeAlertSaveError(w, err)
+		return
+	}
+	rule.ID = alert.ID
+
+	a.reloadAlerts(r)
+	writeJSON(w, http.StatusCreated, a.newAlertResponse(rule))
+}
+
+func (a *application) handleUpdateAlert(w http.ResponseWriter, r *http.Request) {
+	existing, ok := a.alertRuleOfRequest(w, r)
+	if !ok || !requireAPIAlert(w, existing) {
+		return
+	}
+
+	rule, ok := a.decodeAlertRule(w, r)
+	if !ok {
+		return
+	}
+	rule.ID = existing.ID
+	rule.LastTriggered = existing.LastTriggered
+
+	alert, err := rule.toDatabase()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.services.db.Alerts.Update(r.Context(), alert); err != nil {
+		a.writeAlertSaveError(w, err)
+		return
+	}
+
+	a.reloadAlerts(r)
+	writeJSON(w, http.StatusOK, a.newAlertResponse(rule))
+}
+
+func (a *application) handleDeleteAlert(w http.ResponseWriter, r *http.Request) {
+	rule, ok := a.alertRuleOfRequest(w, r)
+	if !ok || !requireAPIAlert(w, rule) {
+		return
+	}
+
+	if err := a.services.db.Alerts.Delete(r.Context(), rule.ID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete alert: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	a.reloadAlerts(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *application) requireAlerts(w http.ResponseWriter) bool {
+	if a.services.alerts == nil {
+		http.Error(w, "Database is not enabled", http.StatusServiceUnavailable)
+		return false
+	}
+
+	return true
+}
+
+// Alerts from the config file get replaced on every reload so changing them through the API would be pointless
+func requireAPIAlert(w http.ResponseWriter, rule *alertRule) bool {
+	if rule.Source != database.AlertSourceAPI {
+		http.Error(w, "Alerts defined in the config file can only be changed there", http.StatusConflict)
+		return false
+	}
+
+	return true
+}
+
+func (a *application) alertRuleOfRequest(w http.ResponseWriter, r *http.Request) (*alertRule, bool) {
+	if !a.requireAlerts(w) {
+		return nil, false
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid alert ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	alert, err := a.services.db.Alerts.Get(r.Context(), id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve alert: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if alert == nil {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	rule, err := alertRuleFromDatabase(alert)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return rule, true
+}
+
+// Alerts are enabled unless the request says otherwise
+func (a *application) decodeAlertRule(w http.ResponseWriter, r *http.Request) (*alertRule, bool) {
+	rule := &alertRule{Enabled: true}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAlertRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(rule); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if err := rule.validate(a.widgetByID, a.Config.Notifications); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid alert: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	rule.ID = 0
+	rule.Source = database.AlertSourceAPI
+	rule.LastTriggered = time.Time{}
+	if rule.Notify == nil {
+		rule.Notify = make([]string, 0)
+	}
+
+	return rule, true
+}
+
+func (a *application) writeAlertSaveError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrAlertNameTaken) {
+		http.Error(w, "An alert with that name already exists", http.StatusConflict)
+		return
+	}
+
+	http.Error(w, fmt.Sprintf("Failed to save alert: %v", err), http.StatusInternalServerError)
+}
+
+// The change has already been saved at this point so failing to
+// reload only means that it applies on the next config reload
+func (a *application) reloadAlerts(r *http.Request) {
+	if err := a.services.alerts.reload(r.Context()); err != nil {
+		slog.Error("Failed to reload alerts", "error", err)
+	}
+}
+
+func (a *application) newAlertResponse(rule *alertRule) alertResponse {
+	response := alertResponse{alertRule: rule, States: make([]alertStateResponse, 0)}
+
+	for _, state := range a.services.alerts.statesOf(rule.ID) {
+		response.States = append(response.States, alertStateResponse{
+			Subject: state.Subject,
+			Status:  state.Status,
+			Since:   state.ChangedAt,
+			FiredAt: state.FiredAt,
+		})
+	}
+
+	return response
+}
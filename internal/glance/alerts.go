@@ -0,0 +1,816 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+const (
+	alertStatusOK      = "ok"
+	alertStatusPending = "pending"
+	alertStatusFiring  = "firing"
+	// Was firing and stopped holding but hasn't been clear for long enough to resolve yet
+	alertStatusResolving = "resolving"
+)
+
+// Stored in the notification_type column, the names of the channels are in notification_target
+const alertNotificationChannels = "channels"
+
+// An alert rule, defined either in the config file or through the API, which
+// gets evaluated against the data of a widget after every one of its updates
+type alertRule struct {
+	ID              int64  `yaml:"-" json:"id"`
+	Name            string `yaml:"name" json:"name"`
+	WidgetID        string `yaml:"widget" json:"widget"`
+	Condition       string `yaml:"condition" json:"condition"`
+	alertRuleParams `yaml:",inline"`
+	// Names of the channels notifications get sent to
+	Notify        []string  `yaml:"notify" json:"notify"`
+	Enabled       bool      `yaml:"-" json:"enabled"`
+	Source        string    `yaml:"-" json:"source"`
+	LastTriggered time.Time `yaml:"-" json:"last_triggered,omitzero"`
+}
+
+// Stored as JSON in the condition_value column
+type alertRuleParams struct {
+	// Limits the rule to the subjects matching it, such as the title of a
+	// site or the name of a container, * matches any number of characters
+	Subject string `yaml:"subject" json:"subject,omitempty"`
+	// Name of the history metric, used by metric-above and metric-below
+	Metric         string   `yaml:"metric" json:"metric,omitempty"`
+	Threshold      *float64 `yaml:"threshold" json:"threshold,omitempty"`
+	ClearThreshold *float64 `yaml:"clear-threshold" json:"clear_threshold,omitempty"`
+	// How long the condition must keep holding before the alert fires
+	For durationField `yaml:"for" json:"for,omitempty"`
+	// How long the condition must stop holding before the alert resolves
+	ResolveAfter durationField `yaml:"resolve-after" json:"resolve_after,omitempty"`
+	// The least amount of time between two notifications for the same subject
+	Cooldown durationField `yaml:"cooldown" json:"cooldown,omitempty"`
+}
+
+type alertObservation struct {
+	subject string
+	// Whether the condition holds, ignored by threshold conditions
+	holds bool
+	value float64
+	// Shown in the notification, and compared against the previous one by event conditions
+	detail string
+}
+
+type alertCondition struct {
+	// Types of widgets the condition can be used with, any widget when empty
+	widgetTypes []string
+	// Compares the observed values against the threshold of the rule
+	threshold bool
+	// Whether the value has to go below the threshold rather than above it
+	below bool
+	// Requires the rule to specify a metric from the history of the widget
+	metric bool
+	// Fires whenever the detail of a subject changes and never resolves
+	event bool
+	// Subjects that are no longer observed are treated as no longer holding,
+	// otherwise they're left as they are since the data may just be missing
+	resolveMissing bool
+	// Also evaluated when the widget failed to update
+	evaluateOnError bool
+	observe         func(rule *alertRule, widget widget) []alertObservation
+	describe        func(rule *alertRule, observation *alertObservation) string
+}
+
+var alertConditions = map[string]*alertCondition{
+	"site-down": {
+		widgetTypes: []string{"monitor"},
+		observe:     observeSitesDown,
+		describe: func(_ *alertRule, o *alertObservation) string {
+			return fmt.Sprintf("%s is down (%s)", o.subject, o.detail)
+		},
+	},
+	"container-exited": {
+		widgetTypes:    []string{"docker-containers"},
+		resolveMissing: true,
+		observe:        observeExitedContainers,
+		describe: func(_ *alertRule, o *alertObservation) string {
+			return fmt.Sprintf("Container %s is %s", o.subject, o.detail)
+		},
+	},
+	"disk-usage-above": {
+		widgetTypes: []string{"server-stats"},
+		threshold:   true,
+		observe:     observeDiskUsage,
+		describe: func(r *alertRule, o *alertObservation) string {
+			return fmt.Sprintf("Disk usage of %s is %g%%, above %g%%", o.subject, o.value, *r.Threshold)
+		},
+	},
+	"metric-above": {
+		threshold: true,
+		metric:    true,
+		observe:   observeMetric,
+		describe: func(r *alertRule, o *alertObservation) string {
+			return fmt.Sprintf("%s is %g, above %g", o.subject, o.value, *r.Threshold)
+		},
+	},
+	"metric-below": {
+		threshold: true,
+		below:     true,
+		metric:    true,
+		observe:   observeMetric,
+		describe: func(r *alertRule, o *alertObservation) string {
+			return fmt.Sprintf("%s is %g, below %g", o.subject, o.value, *r.Threshold)
+		},
+	},
+	"release-available": {
+		widgetTypes: []string{"releases"},
+		event:       true,
+		observe:     observeReleases,
+		describe: func(_ *alertRule, o *alertObservation) string {
+			return fmt.Sprintf("%s %s is available", o.subject, o.detail)
+		},
+	},
+	"dns-blocking-disabled": {
+		widgetTypes: []string{"dns-stats"},
+		observe:     observeDNSBlocking,
+		describe: func(_ *alertRule, _ *alertObservation) string {
+			return "DNS blocking is disabled"
+		},
+	},
+	"widget-error": {
+		evaluateOnError: true,
+		observe: func(_ *alertRule, widget widget) []alertObservation {
+			err := widget.getError()
+			return []alertObservation{{holds: err != nil, detail: ternary(err != nil, fmt.Sprint(err), "")}}
+		},
+		describe: func(_ *alertRule, o *alertObservation) string {
+			return "Failed to update: " + o.detail
+		},
+	},
+}
+
+func observeSitesDown(_ *alertRule, widget widget) []alertObservation {
+	monitor := widget.(*monitorWidget)
+	observations := make([]alertObservation, 0, len(monitor.Sites))
+
+	for i := range monitor.Sites {
+		site := &monitor.Sites[i]
+		if site.Status == nil {
+			continue
+		}
+
+		observations = append(observations, alertObservation{
+			subject: site.Title,
+			holds:   siteStatusIsFailing(site.Status, site.AltStatusCodes),
+			detail:  site.StatusText,
+		})
+	}
+
+	return observations
+}
+
+func observeExitedContainers(_ *alertRule, widget widget) []alertObservation {
+	containers := widget.(*dockerContainersWidget).Containers.flatten()
+	observations := make([]alertObservation, 0, len(containers))
+
+	for i := range containers {
+		observations = append(observations, alertObservation{
+			subject: containers[i].Name,
+			holds:   containers[i].State == "exited" || containers[i].State == "dead",
+			detail:  containers[i].State,
+		})
+	}
+
+	return observations
+}
+
+func observeDiskUsage(_ *alertRule, widget widget) []alertObservation {
+	const prefix = "disk_used_percent:"
+	observations := make([]alertObservation, 0)
+
+	for _, sample := range widget.(historyRecorder).historySamples() {
+		if subject, found := strings.CutPrefix(sample.Name, prefix); found {
+			observations = append(observations, alertObservation{subject: subject, value: sample.Value})
+		}
+	}
+
+	return observations
+}
+
+func observeMetric(rule *alertRule, widget widget) []alertObservation {
+	observations := make([]alertObservation, 0)
+
+	for _, sample := range widget.(historyRecorder).historySamples() {
+		if matchesAlertPattern(rule.Metric, sample.Name) {
+			observations = append(observations, alertObservation{subject: sample.Name, value: sample.Value})
+		}
+	}
+
+	return observations
+}
+
+func observeReleases(_ *alertRule, widget widget) []alertObservation {
+	releases := widget.(*releasesWidget).Releases
+	observations := make([]alertObservation, 0, len(releases))
+
+	for i := range releases {
+		observations = append(observations, alertObservation{subject: releases[i].Name, detail: releases[i].Version})
+	}
+
+	return observations
+}
+
+func observeDNSBlocking(_ *alertRule, widget widget) []alertObservation {
+	stats := widget.(*dnsStatsWidget).Stats
+	if stats == nil || stats.BlockingStatus == "" {
+		return nil
+	}
+
+	return []alertObservation{{holds: stats.BlockingStatus == dnsBlockingDisabled}}
+}
+
+// Only * is special and matches any number of characters, including none
+func matchesAlertPattern(pattern, value string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == value
+	}
+
+	expression := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	matched, _ := regexp.MatchString(expression, value)
+	return matched
+}
+
+// Checks the rule on its own as well as against the widget it targets and the channels it notifies
+func (rule *alertRule) validate(widgetByID map[string]widget, channels map[string]*notificationChannel) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+
+	condition, ok := alertConditions[rule.Condition]
+	if !ok {
+		names := make([]string, 0, len(alertConditions))
+		for name := range alertConditions {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		return fmt.Errorf("condition must be one of %s", strings.Join(names, ", "))
+	}
+
+	if rule.WidgetID == "" {
+		return errors.New("widget is required")
+	}
+
+	target, ok := widgetByID[rule.WidgetID]
+	if !ok {
+		return fmt.Errorf("no widget with the id %s, widgets that alerts are set on must have an id set in the config", rule.WidgetID)
+	}
+
+	// Derived IDs change when the widget is moved, which would silently leave the alert without a widget
+	if configured, ok := target.(interface{ HasConfiguredID() bool }); ok && !configured.HasConfiguredID() {
+		return fmt.Errorf("widget %s has no id set in the config, widgets that alerts are set on must have one", rule.WidgetID)
+	}
+
+	if _, isContainer := target.(widgetWithChildren); isContainer {
+		return fmt.Errorf("widget %s contains other widgets, alerts must be set on the widgets within it", rule.WidgetID)
+	}
+
+	if len(condition.widgetTypes) > 0 && !slices.Contains(condition.widgetTypes, target.GetType()) {
+		return fmt.Errorf("condition %s can only be used with %s widgets", rule.Condition, strings.Join(condition.widgetTypes, ", "))
+	}
+
+	if _, records := target.(historyRecorder); condition.metric && !records {
+		return fmt.Errorf("condition %s can't be used with %s widgets since they don't record any metrics", rule.Condition, target.GetType())
+	}
+
+	if condition.metric && rule.Metric == "" {
+		return fmt.Errorf("metric is required by the %s condition", rule.Condition)
+	}
+
+	if condition.threshold {
+		if rule.Threshold == nil {
+			return fmt.Errorf("threshold is required by the %s condition", rule.Condition)
+		}
+
+		if rule.ClearThreshold != nil {
+			if condition.below && *rule.ClearThreshold < *rule.Threshold {
+				return errors.New("clear-threshold must not be lower than threshold")
+			}
+
+			if !condition.below && *rule.ClearThreshold > *rule.Threshold {
+				return errors.New("clear-threshold must not be higher than threshold")
+			}
+		}
+	} else if rule.Threshold != nil || rule.ClearThreshold != nil {
+		return fmt.Errorf("condition %s doesn't use a threshold", rule.Condition)
+	}
+
+	if condition.event && (rule.For > 0 || rule.ResolveAfter > 0) {
+		return fmt.Errorf("condition %s fires right away and never resolves, for and resolve-after can't be used with it", rule.Condition)
+	}
+
+	if rule.For < 0 || rule.ResolveAfter < 0 || rule.Cooldown < 0 {
+		return errors.New("durations must not be negative")
+	}
+
+	for _, name := range rule.Notify {
+		if _, ok := channels[name]; !ok {
+			return fmt.Errorf("no notification channel named %s", name)
+		}
+	}
+
+	return nil
+}
+
+// Checks the rules from the config, which must have unique names and require the database
+func validateAlertRules(config *config) error {
+	if len(config.Alerts) == 0 {
+		return nil
+	}
+
+	if !config.Database.Enabled {
+		return errors.New("alerts require the database to be enabled")
+	}
+
+	widgetByID := make(map[string]widget)
+	for p := range config.Pages {
+		config.Pages[p].walkWidgets(func(w widget) {
+			widgetByID[w.GetID()] = w
+		})
+	}
+
+	names := make(map[string]struct{}, len(config.Alerts))
+	for i := range config.Alerts {
+		rule := &config.Alerts[i]
+
+		if err := rule.validate(widgetByID, config.Notifications); err != nil {
+			return fmt.Errorf("alert #%d: %v", i+1, err)
+		}
+
+		if _, exists := names[rule.Name]; exists {
+			return fmt.Errorf("alert #%d: name %s is used by more than one alert", i+1, rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+func (rule *alertRule) toDatabase() (*database.Alert, error) {
+	params, err := json.Marshal(&rule.alertRuleParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.Alert{
+		ID:                 rule.ID,
+		Name:               rule.Name,
+		Source:             rule.Source,
+		WidgetID:           rule.WidgetID,
+		ConditionType:      rule.Condition,
+		ConditionValue:     string(params),
+		NotificationType:   alertNotificationChannels,
+		NotificationTarget: strings.Join(rule.Notify, ","),
+		Enabled:            rule.Enabled,
+	}, nil
+}
+
+func alertRuleFromDatabase(alert *database.Alert) (*alertRule, error) {
+	rule := &alertRule{
+		ID:            alert.ID,
+		Name:          alert.Name,
+		WidgetID:      alert.WidgetID,
+		Condition:     alert.ConditionType,
+		Notify:        make([]string, 0),
+		Enabled:       alert.Enabled,
+		Source:        alert.Source,
+		LastTriggered: alert.LastTriggered,
+	}
+
+	if alert.ConditionValue != "" {
+		if err := json.Unmarshal([]byte(alert.ConditionValue), &rule.alertRuleParams); err != nil {
+			return nil, fmt.Errorf("parsing condition of alert %s: %v", alert.Name, err)
+		}
+	}
+
+	if alert.NotificationTarget != "" {
+		rule.Notify = strings.Split(alert.NotificationTarget, ",")
+	}
+
+	return rule, nil
+}
+
+func (rule *alertRule) matchesSubject(subject string) bool {
+	return rule.Subject == "" || matchesAlertPattern(rule.Subject, subject)
+}
+
+// While the alert is active the value has to cross the clear threshold, if
+// one is set, for the condition to stop holding so that values hovering around
+// the threshold don't make the alert fire and resolve over and over
+func (rule *alertRule) crossesThreshold(value float64, active, below bool) bool {
+	threshold := *rule.Threshold
+	if active && rule.ClearThreshold != nil {
+		threshold = *rule.ClearThreshold
+	}
+
+	return ternary(below, value < threshold, value > threshold)
+}
+
+type alertStateKey struct {
+	alertID int64
+	subject string
+}
+
+type alertEvent struct {
+	rule     *alertRule
+	subject  string
+	resolved bool
+	message  string
+}
+
+// Evaluates the enabled alert rules against widgets after they update and keeps track of
+// the state of every subject of every rule, which is persisted so that restarts don't
+// make alerts that are already firing fire again or never resolve
+type alertManager struct {
+	db *database.DB
+
+	mu            sync.Mutex
+	rulesByWidget map[string][]*alertRule
+	states        map[alertStateKey]*database.AlertState
+	channels      map[string]*notificationChannel
+}
+
+func newAlertManager(db *database.DB) *alertManager {
+	return &alertManager{
+		db:            db,
+		rulesByWidget: make(map[string][]*alertRule),
+		states:        make(map[alertStateKey]*database.AlertState),
+	}
+}
+
+// Replaces the rules and notification channels from the previous config with the ones of the application
+func (m *alertManager) configure(app *application) {
+	ctx := context.Background()
+
+	m.mu.Lock()
+	m.channels = app.Config.Notifications
+	m.mu.Unlock()
+	alerts := make([]database.Alert, 0, len(app.Config.Alerts))
+
+	for i := range app.Config.Alerts {
+		rule := app.Config.Alerts[i]
+		rule.Source = database.AlertSourceConfig
+		rule.Enabled = true
+
+		alert, err := rule.toDatabase()
+		if err != nil {
+			slog.Error("Failed to prepare alert", "alert", rule.Name, "error", err)
+			continue
+		}
+		alerts = append(alerts, *alert)
+	}
+
+	if err := m.db.Alerts.ReplaceConfigAlerts(ctx, alerts); err != nil {
+		slog.Error("Failed to save alerts from the config", "error", err)
+	}
+
+	if err := m.reload(ctx); err != nil {
+		slog.Error("Failed to load alerts", "error", err)
+	}
+}
+
+// Loads the enabled rules and their states from the database, needs
+// to be called whenever the rules in the database are changed
+func (m *alertManager) reload(ctx context.Context) error {
+	alerts, err := m.db.Alerts.ListEnabled(ctx)
+	if err != nil {
+		return err
+	}
+
+	rulesByWidget := make(map[string][]*alertRule)
+	for i := range alerts {
+		rule, err := alertRuleFromDatabase(&alerts[i])
+		if err != nil {
+			slog.Error("Skipping alert", "error", err)
+			continue
+		}
+
+		if _, ok := alertConditions[rule.Condition]; !ok {
+			slog.Error("Skipping alert with unknown condition", "alert", rule.Name, "condition", rule.Condition)
+			continue
+		}
+
+		rulesByWidget[rule.WidgetID] = append(rulesByWidget[rule.WidgetID], rule)
+	}
+
+	storedStates, err := m.db.Alerts.ListStates(ctx)
+	if err != nil {
+		return err
+	}
+
+	states := make(map[alertStateKey]*database.AlertState, len(storedStates))
+	for i := range storedStates {
+		state := &storedStates[i]
+		states[alertStateKey{state.AlertID, state.Subject}] = state
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rulesByWidget = rulesByWidget
+	m.states = states
+
+	return nil
+}
+
+// Returns the states of the subjects of a rule, ordered by subject
+func (m *alertManager) statesOf(alertID int64) []database.AlertState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	states := make([]database.AlertState, 0)
+	for key, state := range m.states {
+		if key.alertID == alertID {
+			states = append(states, *state)
+		}
+	}
+
+	slices.SortFunc(states, func(a, b database.AlertState) int {
+		return strings.Compare(a.Subject, b.Subject)
+	})
+
+	return states
+}
+
+// Must be called with the widget locked
+func (m *alertManager) evaluate(widget widget) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rules := m.rulesByWidget[widget.GetID()]
+	if len(rules) == 0 {
+		return
+	}
+
+	failed := widget.getError() != nil
+	now := time.Now()
+
+	for _, rule := range rules {
+		condition := alertConditions[rule.Condition]
+		if failed && !condition.evaluateOnError {
+			continue
+		}
+
+		// Rules created through the API may be set on a widget that has since changed its type
+		if len(condition.widgetTypes) > 0 && !slices.Contains(condition.widgetTypes, widget.GetType()) {
+			continue
+		}
+
+		if _, records := widget.(historyRecorder); condition.metric && !records {
+			continue
+		}
+
+		observed := make(map[string]struct{})
+		observations := condition.observe(rule, widget)
+
+		for i := range observations {
+			observation := &observations[i]
+			if !rule.matchesSubject(observation.subject) {
+				continue
+			}
+
+			observed[observation.subject] = struct{}{}
+
+			if condition.event {
+				m.applyEvent(rule, condition, observation, now)
+			} else {
+				m.apply(rule, condition, observation, now)
+			}
+		}
+
+		if !condition.resolveMissing {
+			continue
+		}
+
+		for key, state := range m.states {
+			if key.alertID != rule.ID || state.Status == alertStatusOK {
+				continue
+			}
+
+			if _, ok := observed[key.subject]; !ok {
+				m.apply(rule, condition, &alertObservation{subject: key.subject}, now)
+			}
+		}
+	}
+}
+
+func (m *alertManager) apply(rule *alertRule, condition *alertCondition, observation *alertObservation, now time.Time) {
+	key := alertStateKey{rule.ID, observation.subject}
+	state := m.states[key]
+	// Only once the alert has fired, a pending one goes back to ok as soon as the threshold isn't crossed
+	active := state != nil && (state.Status == alertStatusFiring || state.Status == alertStatusResolving)
+
+	holds := observation.holds
+	if condition.threshold {
+		holds = rule.crossesThreshold(observation.value, active, condition.below)
+	}
+
+	if state == nil {
+		if !holds {
+			return
+		}
+
+		state = &database.AlertState{AlertID: rule.ID, Subject: observation.subject, Status: alertStatusOK}
+		m.states[key] = state
+	}
+
+	setStatus := func(status string) {
+		state.Status = status
+		state.ChangedAt = now
+	}
+
+	switch {
+	case holds && state.Status == alertStatusOK:
+		if rule.For > 0 {
+			setStatus(alertStatusPending)
+		} else {
+			m.fire(rule, condition, state, observation, now)
+		}
+	case holds && state.Status == alertStatusPending:
+		if now.Sub(state.ChangedAt) < time.Duration(rule.For) {
+			return
+		}
+		m.fire(rule, condition, state, observation, now)
+	case holds && state.Status == alertStatusResolving:
+		setStatus(alertStatusFiring)
+	case !holds && state.Status == alertStatusPending:
+		setStatus(alertStatusOK)
+	case !holds && state.Status == alertStatusFiring:
+		if rule.ResolveAfter > 0 {
+			setStatus(alertStatusResolving)
+		} else {
+			m.resolve(rule, state, now)
+		}
+	case !holds && state.Status == alertStatusResolving:
+		if now.Sub(state.ChangedAt) < time.Duration(rule.ResolveAfter) {
+			return
+		}
+		m.resolve(rule, state, now)
+	default:
+		return
+	}
+
+	m.saveState(state)
+}
+
+// The first time a subject is seen only its detail is remembered,
+// after that the alert fires every time the detail changes
+func (m *alertManager) applyEvent(rule *alertRule, condition *alertCondition, observation *alertObservation, now time.Time) {
+	key := alertStateKey{rule.ID, observation.subject}
+	state := m.states[key]
+
+	if state == nil {
+		state = &database.AlertState{
+			AlertID:   rule.ID,
+			Subject:   observation.subject,
+			Status:    alertStatusOK,
+			ChangedAt: now,
+			Detail:    observation.detail,
+		}
+		m.states[key] = state
+		m.saveState(state)
+		return
+	}
+
+	if state.Detail == observation.detail {
+		return
+	}
+
+	m.fire(rule, condition, state, observation, now)
+	state.Status = alertStatusOK
+	m.saveState(state)
+}
+
+func (m *alertManager) fire(rule *alertRule, condition *alertCondition, state *database.AlertState, observation *alertObservation, now time.Time) {
+	state.Status = alertStatusFiring
+	state.ChangedAt = now
+	state.FiredAt = now
+	state.Detail = observation.detail
+
+	// Firing again while cooling down still makes the alert active
+	// but neither it nor its resolution get sent out
+	coolingDown := rule.Cooldown > 0 && !state.LastNotified.IsZero() && now.Sub(state.LastNotified) < time.Duration(rule.Cooldown)
+	state.Notified = !coolingDown
+
+	if coolingDown {
+		slog.Debug("Alert fired while cooling down", "alert", rule.Name, "subject", state.Subject)
+		return
+	}
+
+	state.LastNotified = now
+	if err := m.db.Alerts.MarkTriggered(context.Background(), rule.ID, now); err != nil {
+		slog.Error("Failed to record alert trigger", "alert", rule.Name, "error", err)
+	}
+	rule.LastTriggered = now
+
+	m.notify(alertEvent{
+		rule:    rule,
+		subject: state.Subject,
+		message: rule.Name + ": " + condition.describe(rule, observation),
+	})
+}
+
+func (m *alertManager) resolve(rule *alertRule, state *database.AlertState, now time.Time) {
+	state.Status = alertStatusOK
+	state.ChangedAt = now
+
+	if !state.Notified {
+		return
+	}
+	state.Notified = false
+
+	label := rule.Name
+	if state.Subject != "" {
+		label += ": " + state.Subject
+	}
+
+	m.notify(alertEvent{
+		rule:     rule,
+		subject:  state.Subject,
+		resolved: true,
+		message:  fmt.Sprintf("%s resolved after %s", label, now.Sub(state.FiredAt).Round(time.Second)),
+	})
+}
+
+func (m *alertManager) notify(event alertEvent) {
+	slog.Info(
+		ternary(event.resolved, "Alert resolved", "Alert triggered"),
+		"alert", event.rule.Name,
+		"subject", event.subject,
+		"message", event.message,
+	)
+
+	recordActivity(m.db, activityEvent{
+		Type:     ternary(event.resolved, activityAlertResolved, activityAlertTriggered),
+		Level:    ternary(event.resolved, activityLevelSuccess, activityLevelWarning),
+		Message:  event.message,
+		WidgetID: event.rule.WidgetID,
+		Details: map[string]any{
+			"alert":   event.rule.Name,
+			"subject": event.subject,
+			"notify":  event.rule.Notify,
+		},
+	})
+
+	n := &notification{
+		Title:    ternary(event.resolved, "Resolved: ", "Alert: ") + event.rule.Name,
+		Message:  event.message,
+		Resolved: event.resolved,
+		Alert:    event.rule.Name,
+		Subject:  event.subject,
+		WidgetID: event.rule.WidgetID,
+		Time:     time.Now(),
+	}
+
+	for _, name := range event.rule.Notify {
+		channel, ok := m.channels[name]
+		if !ok {
+			slog.Warn("Alert notifies a channel that doesn't exist", "alert", event.rule.Name, "channel", name)
+			continue
+		}
+
+		// Sending can take a while when it has to be retried and this is called with the widget locked
+		go m.deliver(channel, n)
+	}
+}
+
+func (m *alertManager) deliver(channel *notificationChannel, n *notification) {
+	err := channel.send(context.Background(), n)
+	if err == nil {
+		return
+	}
+
+	slog.Error("Failed to send notification", "channel", channel.name, "alert", n.Alert, "error", err)
+	recordActivity(m.db, activityEvent{
+		Type:     activityNotificationFailed,
+		Level:    activityLevelError,
+		Message:  fmt.Sprintf("Failed to send notification through %s: %v", channel.name, err),
+		WidgetID: n.WidgetID,
+		Details: map[string]any{
+			"alert":   n.Alert,
+			"channel": channel.name,
+		},
+	})
+}
+
+func (m *alertManager) saveState(state *database.AlertState) {
+	if err := m.db.Alerts.SaveState(context.Background(), state); err != nil {
+		slog.Error("Failed to save alert state", "alert", state.AlertID, "subject", state.Subject, "error", err)
+	}
+}
@@ -0,0 +1,137 @@
+package glance
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+func TestAlertManagerStateTransitions(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	threshold, clearThreshold := 90.0, 80.0
+	rule := &alertRule{
+		Name:      "disk",
+		WidgetID:  "stats",
+		Condition: "disk-usage-above",
+		alertRuleParams: alertRuleParams{
+			Threshold:      &threshold,
+			ClearThreshold: &clearThreshold,
+			For:            durationField(5 * time.Minute),
+			Cooldown:       durationField(time.Hour),
+		},
+		Enabled: true,
+		Source:  database.AlertSourceAPI,
+	}
+
+	alert, _ := rule.toDatabase()
+	if err := db.Alerts.Create(t.Context(), alert); err != nil {
+		t.Fatalf("Failed to create alert: %v", err)
+	}
+	rule.ID = alert.ID
+
+	manager := newAlertManager(db)
+	condition := alertConditions[rule.Condition]
+	start := time.Now()
+
+	observe := func(minutes int, value float64, expectedStatus string) {
+		t.Helper()
+		manager.apply(rule, condition, &alertObservation{subject: "/", value: value}, start.Add(time.Duration(minutes)*time.Minute))
+
+		status := alertStatusOK
+		if state := manager.states[alertStateKey{rule.ID, "/"}]; state != nil {
+			status = state.Status
+		}
+
+		if status != expectedStatus {
+			t.Fatalf("Expected status %s after observing %g at minute %d, got %s", expectedStatus, value, minutes, status)
+		}
+	}
+
+	notifications := func() int {
+		t.Helper()
+		logs, err := db.Activity.List(t.Context(), database.ActivityFilter{
+			EventTypes: []string{activityAlertTriggered, activityAlertResolved},
+		})
+		if err != nil {
+			t.Fatalf("Failed to list activity: %v", err)
+		}
+		return len(logs)
+	}
+
+	observe(0, 50, alertStatusOK)
+	observe(1, 95, alertStatusPending)
+	observe(3, 85, alertStatusOK)
+	observe(4, 95, alertStatusPending)
+	observe(8, 95, alertStatusPending)
+	observe(9, 95, alertStatusFiring)
+	// Below the threshold but still above the clear threshold
+	observe(10, 85, alertStatusFiring)
+	observe(11, 75, alertStatusOK)
+
+	if count := notifications(); count != 2 {
+		t.Fatalf("Expected a trigger and a resolve notification, got %d", count)
+	}
+
+	stored, _ := db.Alerts.Get(t.Context(), rule.ID)
+	if !stored.LastTriggered.Equal(start.Add(9 * time.Minute)) {
+		t.Errorf("Expected last triggered to be recorded, got %v", stored.LastTriggered)
+	}
+
+	// Fires again within the cooldown so neither the trigger nor the resolve get sent out
+	observe(20, 95, alertStatusPending)
+	observe(25, 95, alertStatusFiring)
+	observe(26, 50, alertStatusOK)
+
+	if count := notifications(); count != 2 {
+		t.Fatalf("Expected no notifications while cooling down, got %d in total", count)
+	}
+
+	observe(80, 95, alertStatusPending)
+	observe(85, 95, alertStatusFiring)
+
+	if count := notifications(); count != 3 {
+		t.Fatalf("Expected a notification once the cooldown has passed, got %d in total", count)
+	}
+
+	if err := manager.reload(t.Context()); err != nil {
+		t.Fatalf("Failed to reload alerts: %v", err)
+	}
+
+	if states := manager.statesOf(rule.ID); len(states) != 1 || states[0].Status != alertStatusFiring {
+		t.Errorf("Expected the firing state to be persisted, got %v", states)
+	}
+}
+
+func TestAlertManagerEventsFireOnChange(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rule := &alertRule{ID: 1, Name: "releases", WidgetID: "releases", Condition: "release-available"}
+	condition := alertConditions[rule.Condition]
+	manager := newAlertManager(db)
+	now := time.Now()
+
+	fired := 0
+	for _, version := range []string{"v1.0.0", "v1.0.0", "v1.1.0", "v1.1.0", "v1.2.0"} {
+		manager.applyEvent(rule, condition, &alertObservation{subject: "glance", detail: version}, now)
+
+		if state := manager.states[alertStateKey{rule.ID, "glance"}]; state.FiredAt.Equal(now) && state.Detail == version {
+			fired++
+		}
+		now = now.Add(time.Minute)
+	}
+
+	if fired != 2 {
+		t.Errorf("Expected the alert to fire for the two new versions but not the first one seen, fired %d times", fired)
+	}
+}
@@ -37,6 +37,12 @@ const AUTH_TOKEN_REGEN_BEFORE = 7 * 24 * time.Hour // 7 days
 
 var loginPageTemplate = mustParseTemplate("login.html", "document.html", "footer.html")
 
+// Passed to the login page through the query string when logging in through the OpenID provider fails
+const (
+	loginErrorSSOFailed = "sso-failed"
+	loginErrorSSODenied = "sso-denied"
+)
+
 type doWhenUnauthorized int
 
 const (
@@ -200,6 +206,18 @@ func (a *application) handleAuthenticationAttempt(w http.ResponseWriter, r *http
 			"Failed login attempt for user '%s' from %s",
 			creds.Username, ip,
 		)
+
+		if a.services.metrics != nil {
+			a.services.metrics.RecordAuthFailure()
+		}
+
+		recordActivity(a.services.db, activityEvent{
+			Type:      activityLoginFailed,
+			Level:     activityLevelWarning,
+			Message:   fmt.Sprintf("Failed login attempt for user '%s'", creds.Username),
+			User:      creds.Username,
+			IPAddress: ip,
+		})
 	}
 
 	if len(creds.Username) == 0 || len(creds.Password) == 0 {
@@ -230,15 +248,32 @@ func (a *application) handleAuthenticationAttempt(w http.ResponseWriter, r *http
 		return
 	}
 
-	token, err := generateSessionToken(creds.Username, a.authSecretKey, time.Now())
-	if err != nil {
-		log.Printf("Could not compute session token during login attempt: %v", err)
-		time.Sleep(waitOnFailure)
-		w.WriteHeader(http.StatusUnauthorized)
-		return
+	if a.StoresSessions() {
+		if _, err := a.createStoredSession(w, r, creds.Username, ""); err != nil {
+			log.Printf("Could not store session during login attempt: %v", err)
+			time.Sleep(waitOnFailure)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	} else {
+		token, err := generateSessionToken(creds.Username, a.authSecretKey, time.Now())
+		if err != nil {
+			log.Printf("Could not compute session token during login attempt: %v", err)
+			time.Sleep(waitOnFailure)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		a.setAuthSessionCookie(w, r, token, time.Now().Add(AUTH_TOKEN_VALID_PERIOD))
 	}
 
-	a.setAuthSessionCookie(w, r, token, time.Now().Add(AUTH_TOKEN_VALID_PERIOD))
+	recordActivity(a.services.db, activityEvent{
+		Type:      activityLogin,
+		Level:     activityLevelSuccess,
+		Message:   fmt.Sprintf("User '%s' logged in", creds.Username),
+		User:      creds.Username,
+		IPAddress: ip,
+	})
 
 	a.authAttemptsMu.Lock()
 	delete(a.failedAuthAttempts, ip)
@@ -252,23 +287,17 @@ func (a *application) isAuthorized(w http.ResponseWriter, r *http.Request) bool
 		return true
 	}
 
-	token, err := r.Cookie(AUTH_SESSION_COOKIE_NAME)
-	if err != nil || token.Value == "" {
-		return false
+	if a.StoresSessions() {
+		return a.storedSessionOfRequest(w, r) != nil
 	}
 
-	usernameHash, shouldRegenerate, err := verifySessionToken(token.Value, a.authSecretKey, time.Now())
-	if err != nil {
-		return false
-	}
-
-	username, exists := a.usernameHashToUsername[string(usernameHash)]
-	if !exists {
+	token, err := r.Cookie(AUTH_SESSION_COOKIE_NAME)
+	if err != nil || token.Value == "" {
 		return false
 	}
 
-	_, exists = a.Config.Auth.Users[username]
-	if !exists {
+	username, shouldRegenerate, ok := a.usernameOfStatelessToken(token.Value, time.Now())
+	if !ok {
 		return false
 	}
 
@@ -285,6 +314,25 @@ func (a *application) isAuthorized(w http.ResponseWriter, r *http.Request) bool
 	return true
 }
 
+// Returns the user a token from generateSessionToken belongs to and whether it should be regenerated
+func (a *application) usernameOfStatelessToken(token string, now time.Time) (string, bool, bool) {
+	usernameHash, shouldRegenerate, err := verifySessionToken(token, a.authSecretKey, now)
+	if err != nil {
+		return "", false, false
+	}
+
+	username, exists := a.usernameHashToUsername[string(usernameHash)]
+	if !exists {
+		return "", false, false
+	}
+
+	if _, exists = a.Config.Auth.Users[username]; !exists {
+		return "", false, false
+	}
+
+	return username, shouldRegenerate, true
+}
+
 // Handles sending the appropriate response for an unauthorized request and returns true if the request was unauthorized
 func (a *application) handleUnauthorizedResponse(w http.ResponseWriter, r *http.Request, fallback doWhenUnauthorized) bool {
 	if a.isAuthorized(w, r) {
@@ -302,8 +350,24 @@ func (a *application) handleUnauthorizedResponse(w http.ResponseWriter, r *http.
 	return true
 }
 
+// Wraps a handler so that unauthorized requests get a JSON error instead of reaching it,
+// preflight requests are let through since browsers never send credentials with them
+func (a *application) requireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions && a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Maybe this should be a POST request instead?
 func (a *application) handleLogoutRequest(w http.ResponseWriter, r *http.Request) {
+	if a.StoresSessions() {
+		a.deleteSessionOfRequest(r)
+	}
+
 	a.setAuthSessionCookie(w, r, "", time.Now().Add(-1*time.Hour))
 	http.Redirect(w, r, a.Config.Server.BaseURL+"/login", http.StatusSeeOther)
 }
@@ -320,17 +384,31 @@ func (a *application) setAuthSessionCookie(w http.ResponseWriter, r *http.Reques
 	})
 }
 
+type loginPageData struct {
+	templateData
+	Error string
+}
+
 func (a *application) handleLoginPageRequest(w http.ResponseWriter, r *http.Request) {
 	if a.isAuthorized(w, r) {
 		http.Redirect(w, r, a.Config.Server.BaseURL+"/", http.StatusSeeOther)
 		return
 	}
 
-	data := &templateData{
-		App: a,
+	data := &loginPageData{
+		templateData: templateData{App: a},
 	}
 	a.populateTemplateRequestData(&data.Request, r)
 
+	if a.Config.Auth.OIDC != nil {
+		switch r.URL.Query().Get("error") {
+		case loginErrorSSOFailed:
+			data.Error = fmt.Sprintf("Could not log in through %s, please try again", a.Config.Auth.OIDC.Name)
+		case loginErrorSSODenied:
+			data.Error = "Your account is not allowed to access this dashboard"
+		}
+	}
+
 	var responseBytes bytes.Buffer
 	err := loginPageTemplate.Execute(&responseBytes, data)
 	if err != nil {
@@ -3,8 +3,15 @@ package glance
 import (
 	"bytes"
 	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+	"github.com/glanceapp/glance/internal/websocket"
 )
 
 func TestAuthTokenGenerationAndVerification(t *testing.T) {
@@ -83,3 +90,77 @@ func TestAuthTokenGenerationAndVerification(t *testing.T) {
 		}
 	}
 }
+
+func TestMountedAPIRequiresAuthentication(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	secret, _ := makeAuthSecretKey(AUTH_SECRET_KEY_LENGTH)
+	config, err := newConfigFromYAML([]byte(`
+auth:
+  secret-key: ` + secret + `
+  users:
+    admin:
+      password: hunter22
+database:
+  enabled: true
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: hello
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	services := &sharedServices{db: db, wsHub: websocket.NewHub(), scheduler: newWidgetScheduler()}
+	app, err := newApplication(config, services, nil)
+	if err != nil {
+		t.Fatalf("Failed to create application: %v", err)
+	}
+	handler := app.handler()
+
+	request := func(method, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	const data = `{"key":"tasks","value":["water the plants"],"type":"todo"}`
+
+	for _, path := range []string{"/api/v1/widgets/todo/data", "/api/ws"} {
+		if response := request("GET", path, "", nil); response.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s not to be public when authentication is set up, got %d", path, response.Code)
+		}
+	}
+
+	if response := request("POST", "/api/v1/widgets/todo/data", data, nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected saving widget data to require authentication, got %d", response.Code)
+	}
+
+	login := request("POST", "/api/authenticate", `{"username":"admin","password":"hunter22"}`, nil)
+	cookie := login.Result().Cookies()[0]
+
+	if response := request("POST", "/api/v1/widgets/todo/data", data, cookie); response.Code != http.StatusCreated {
+		t.Fatalf("Expected logged in users to be able to save widget data, got %d: %s", response.Code, response.Body.String())
+	}
+
+	response := request("GET", "/api/v1/widgets/todo/data/tasks", "", cookie)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), "water the plants") {
+		t.Errorf("Expected the saved widget data to be returned, got %d: %s", response.Code, response.Body.String())
+	}
+}
@@ -1,13 +1,20 @@
 package glance
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/glanceapp/glance/internal/database"
 	"github.com/shirou/gopsutil/v4/disk"
 	"github.com/shirou/gopsutil/v4/sensors"
+	"gopkg.in/yaml.v3"
 )
 
 type cliIntent uint8
@@ -22,6 +29,19 @@ const (
 	cliIntentMountpointInfo
 	cliIntentSecretMake
 	cliIntentPasswordHash
+	cliIntentDatabaseStatus
+	cliIntentDatabaseMigrate
+	cliIntentDatabaseBackup
+	cliIntentDatabaseRestore
+	cliIntentDatabaseRollback
+	cliIntentNotifyTest
+	cliIntentProfileList
+	cliIntentProfileSave
+	cliIntentProfileActivate
+	cliIntentProfileDeactivate
+	cliIntentConfigHistory
+	cliIntentConfigDiff
+	cliIntentConfigRollback
 )
 
 type cliOptions struct {
@@ -50,11 +70,24 @@ func parseCliOptions() (*cliOptions, error) {
 		fmt.Println("\nCommands:")
 		fmt.Println("  config:validate       Validate the config file")
 		fmt.Println("  config:print          Print the parsed config file with embedded includes")
+		fmt.Println("  config:history        List the versions of the config that Glance has used")
+		fmt.Println("  config:diff <a> <b>   Show what changed between two versions of the config, either of which can be \"current\"")
+		fmt.Println("  config:rollback <version> Restore the config files to a version of the config")
 		fmt.Println("  password:hash <pwd>   Hash a password")
 		fmt.Println("  secret:make           Generate a random secret key")
 		fmt.Println("  sensors:print         List all sensors")
 		fmt.Println("  mountpoint:info       Print information about a given mountpoint path")
 		fmt.Println("  diagnose              Run diagnostic checks")
+		fmt.Println("  db:status             List applied and pending database migrations")
+		fmt.Println("  db:migrate            Apply pending database migrations")
+		fmt.Println("  db:rollback <version> Revert database migrations newer than the given version")
+		fmt.Println("  db:backup <file>      Write a copy of the database to a file, safe to run while Glance is running")
+		fmt.Println("  db:restore <file>     Replace the database with a backup, Glance must be stopped first")
+		fmt.Println("  notify:test <channel> Send a test notification through a channel from the config")
+		fmt.Println("  profile:list          List the saved dashboard profiles")
+		fmt.Println("  profile:save <name>   Save the pages and theme from the config file as a profile, replacing it if it exists")
+		fmt.Println("  profile:activate <name> Use the pages and theme of a profile instead of the ones from the config file")
+		fmt.Println("  profile:deactivate    Go back to using the pages and theme from the config file")
 	}
 
 	configPath := flags.String("config", "glance.yml", "Set config path")
@@ -74,24 +107,50 @@ func parseCliOptions() (*cliOptions, error) {
 			intent = cliIntentConfigValidate
 		} else if args[0] == "config:print" {
 			intent = cliIntentConfigPrint
+		} else if args[0] == "config:history" {
+			intent = cliIntentConfigHistory
 		} else if args[0] == "sensors:print" {
 			intent = cliIntentSensorsPrint
 		} else if args[0] == "diagnose" {
 			intent = cliIntentDiagnose
 		} else if args[0] == "secret:make" {
 			intent = cliIntentSecretMake
+		} else if args[0] == "db:status" {
+			intent = cliIntentDatabaseStatus
+		} else if args[0] == "db:migrate" {
+			intent = cliIntentDatabaseMigrate
+		} else if args[0] == "profile:list" {
+			intent = cliIntentProfileList
+		} else if args[0] == "profile:deactivate" {
+			intent = cliIntentProfileDeactivate
 		} else {
 			return nil, unknownCommandErr
 		}
 	} else if len(args) == 2 {
 		if args[0] == "password:hash" {
 			intent = cliIntentPasswordHash
+		} else if args[0] == "mountpoint:info" {
+			intent = cliIntentMountpointInfo
+		} else if args[0] == "db:backup" {
+			intent = cliIntentDatabaseBackup
+		} else if args[0] == "db:restore" {
+			intent = cliIntentDatabaseRestore
+		} else if args[0] == "db:rollback" {
+			intent = cliIntentDatabaseRollback
+		} else if args[0] == "notify:test" {
+			intent = cliIntentNotifyTest
+		} else if args[0] == "profile:save" {
+			intent = cliIntentProfileSave
+		} else if args[0] == "profile:activate" {
+			intent = cliIntentProfileActivate
+		} else if args[0] == "config:rollback" {
+			intent = cliIntentConfigRollback
 		} else {
 			return nil, unknownCommandErr
 		}
-	} else if len(args) == 2 {
-		if args[0] == "mountpoint:info" {
-			intent = cliIntentMountpointInfo
+	} else if len(args) == 3 {
+		if args[0] == "config:diff" {
+			intent = cliIntentConfigDiff
 		} else {
 			return nil, unknownCommandErr
 		}
@@ -153,3 +212,628 @@ func cliMountpointInfo(requestedPath string) int {
 
 	return 0
 }
+
+// Returns the path of the database from the config, regardless of whether it's enabled
+func cliDatabasePath(configPath string) (string, error) {
+	contents, _, err := parseYAMLIncludes(configPath)
+	if err != nil {
+		return "", fmt.Errorf("could not parse config file: %v", err)
+	}
+
+	config, err := newConfigFromYAML(contents)
+	if err != nil {
+		return "", fmt.Errorf("config file is invalid: %v", err)
+	}
+
+	return resolveDatabasePath(configPath, config.Database.Path), nil
+}
+
+// Opens the database without applying pending migrations
+func cliOpenDatabase(configPath string) (*database.DB, string, error) {
+	path, err := cliDatabasePath(configPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, "", fmt.Errorf("could not find a database at %s", path)
+	}
+
+	db, err := database.Open(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not open database at %s: %v", path, err)
+	}
+
+	return db, path, nil
+}
+
+// Opens the database for commands that use its tables rather than manage it, which
+// need every migration to have been applied
+func cliOpenMigratedDatabase(configPath string) (*database.DB, error) {
+	db, path, err := cliOpenDatabase(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cliCheckMigrated(db, path); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func cliCheckMigrated(db *database.DB, path string) error {
+	currentVersion, err := db.SchemaVersion()
+	if err != nil {
+		return fmt.Errorf("could not get the schema version of the database at %s: %v", path, err)
+	}
+
+	latestVersion, err := database.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if currentVersion < latestVersion {
+		return fmt.Errorf("the database at %s has pending migrations, run db:migrate or start Glance to apply them first", path)
+	}
+
+	return nil
+}
+
+func cliDatabaseStatus(configPath string) int {
+	db, path, err := cliOpenDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	migrations, err := db.MigrationStatus()
+	if err != nil {
+		fmt.Printf("Failed to get migration status: %v\n", err)
+		return 1
+	}
+
+	currentVersion, _ := db.SchemaVersion()
+	latestVersion, _ := database.LatestSchemaVersion()
+	pending := 0
+
+	fmt.Println("Database:", path)
+	fmt.Printf("Schema version: %d (latest: %d)\n\n", currentVersion, latestVersion)
+
+	modified := 0
+	for _, migration := range migrations {
+		name := ternary(migration.Name == "", fmt.Sprintf("%03d (unknown to this version of Glance)", migration.Version), migration.Name)
+		notes := ternary(migration.Reversible || migration.Name == "", "", " (irreversible)")
+
+		if migration.Modified {
+			notes += " (changed after it was applied)"
+			modified++
+		}
+
+		if migration.Applied {
+			fmt.Printf(" applied  %-40s %s%s\n", name, migration.AppliedAt.Local().Format("2006-01-02 15:04:05"), notes)
+		} else {
+			fmt.Printf(" pending  %s%s\n", name, notes)
+			pending++
+		}
+	}
+
+	if currentVersion > latestVersion {
+		fmt.Println("\nThe database was migrated by a newer version of Glance, which this version can't run against")
+	}
+
+	if modified > 0 {
+		fmt.Printf("\n%d migration(s) changed after they were applied, Glance will refuse to start until this is resolved\n", modified)
+	}
+
+	if pending > 0 {
+		fmt.Printf("\n%d pending migration(s), they will be applied when Glance starts or by running db:migrate\n", pending)
+	}
+
+	return 0
+}
+
+func cliDatabaseMigrate(configPath string) int {
+	db, _, err := cliOpenDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	applied, err := db.Migrate()
+	for _, migration := range applied {
+		fmt.Println("Applied", migration.Name)
+	}
+
+	if err != nil {
+		fmt.Printf("Failed to migrate database: %v\n", err)
+		return 1
+	}
+
+	if len(applied) == 0 {
+		fmt.Println("Database is already up to date")
+	}
+
+	return 0
+}
+
+func cliDatabaseBackup(configPath, destination string) int {
+	db, path, err := cliOpenDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := db.Backup(destination); err != nil {
+		fmt.Printf("Failed to back up database: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Backed up %s to %s\n", path, destination)
+	return 0
+}
+
+func cliDatabaseRestore(configPath, backup string) int {
+	path, err := cliDatabasePath(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	previous, err := database.Restore(backup, path)
+	if err != nil {
+		fmt.Printf("Failed to restore database: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Restored %s from %s\n", path, backup)
+	if previous != "" {
+		fmt.Printf("The database that was replaced has been moved to %s\n", previous)
+	}
+
+	return 0
+}
+
+func cliDatabaseRollback(configPath, versionStr string) int {
+	target, err := strconv.Atoi(versionStr)
+	if err != nil || target < 0 {
+		fmt.Println("Version must be a positive number or 0 to revert every migration")
+		return 1
+	}
+
+	db, _, err := cliOpenDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	reverted, err := db.MigrateDown(target)
+	for _, migration := range reverted {
+		fmt.Println("Reverted", migration.Name)
+	}
+
+	if err != nil {
+		fmt.Printf("Failed to roll back database: %v\n", err)
+		return 1
+	}
+
+	if len(reverted) == 0 {
+		fmt.Printf("Database is already at or below version %d\n", target)
+	} else {
+		fmt.Println("Glance applies pending migrations when it starts, use a version of Glance that doesn't include them to keep the database at this version")
+	}
+
+	return 0
+}
+
+func cliNotifyTest(configPath, channelName string) int {
+	contents, _, err := parseYAMLIncludes(configPath)
+	if err != nil {
+		fmt.Printf("Could not parse config file: %v\n", err)
+		return 1
+	}
+
+	config, err := newConfigFromYAML(contents)
+	if err != nil {
+		fmt.Printf("Config file is invalid: %v\n", err)
+		return 1
+	}
+
+	channel, ok := config.Notifications[channelName]
+	if !ok {
+		names := slices.Sorted(maps.Keys(config.Notifications))
+		if len(names) == 0 {
+			fmt.Println("No notification channels are configured")
+		} else {
+			fmt.Printf("No notification channel named %s, available channels: %s\n", channelName, strings.Join(names, ", "))
+		}
+
+		return 1
+	}
+
+	err = channel.send(context.Background(), &notification{
+		Title:   "Test notification from Glance",
+		Message: "If you can see this, notifications sent through " + channelName + " are working",
+		Alert:   "test",
+		Time:    time.Now(),
+	})
+	if err != nil {
+		fmt.Printf("Failed to send notification through %s: %v\n", channelName, err)
+		return 1
+	}
+
+	fmt.Printf("Sent a test notification through %s\n", channelName)
+	return 0
+}
+
+func cliProfileList(configPath string) int {
+	db, err := cliOpenMigratedDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	profiles, err := db.Profiles.List(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to list profiles: %v\n", err)
+		return 1
+	}
+
+	if len(profiles) == 0 {
+		fmt.Println("No profiles have been saved")
+		return 0
+	}
+
+	for _, profile := range profiles {
+		fmt.Printf(
+			" %s %-30s updated %s  %s\n",
+			ternary(profile.Active, "*", " "),
+			profile.Name,
+			profile.UpdatedAt.Local().Format("2006-01-02 15:04:05"),
+			profile.Description,
+		)
+	}
+
+	return 0
+}
+
+// Returns the contents of the config files, which must be valid
+func cliReadConfigContents(configPath string) ([]byte, error) {
+	contents, _, err := parseYAMLIncludes(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config file: %v", err)
+	}
+
+	if _, err := newConfigFromYAML(contents); err != nil {
+		return nil, fmt.Errorf("config file is invalid: %v", err)
+	}
+
+	return contents, nil
+}
+
+func cliProfileSave(configPath, name string) int {
+	contents, err := cliReadConfigContents(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	configJSON, err := snapshotProfileConfig(contents)
+	if err != nil {
+		fmt.Printf("Failed to save profile: %v\n", err)
+		return 1
+	}
+
+	db, err := cliOpenMigratedDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	profile, err := db.Profiles.GetByName(ctx, name)
+	if err != nil {
+		fmt.Printf("Failed to get profile: %v\n", err)
+		return 1
+	}
+
+	if profile == nil {
+		err = db.Profiles.Create(ctx, &database.Profile{Name: name, ConfigJSON: configJSON})
+	} else {
+		profile.ConfigJSON = configJSON
+		err = db.Profiles.Update(ctx, profile)
+	}
+
+	if err != nil {
+		fmt.Printf("Failed to save profile: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%s profile %s\n", ternary(profile == nil, "Saved", "Replaced"), name)
+	return 0
+}
+
+func cliProfileActivate(configPath, name string) int {
+	contents, err := cliReadConfigContents(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	db, err := cliOpenMigratedDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	profile, err := db.Profiles.GetByName(ctx, name)
+	if err != nil {
+		fmt.Printf("Failed to get profile: %v\n", err)
+		return 1
+	}
+
+	if profile == nil {
+		fmt.Printf("No profile named %s\n", name)
+		return 1
+	}
+
+	if _, err := newConfigWithProfile(contents, profile); err != nil {
+		fmt.Printf("Profile can't be used with the current config: %v\n", err)
+		return 1
+	}
+
+	if err := db.Profiles.Activate(ctx, profile.ID); err != nil {
+		fmt.Printf("Failed to activate profile: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Activated profile %s\n", name)
+	fmt.Println(cliProfileSwitchNote)
+	return 0
+}
+
+func cliProfileDeactivate(configPath string) int {
+	db, err := cliOpenMigratedDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := db.Profiles.Deactivate(context.Background()); err != nil {
+		fmt.Printf("Failed to deactivate profiles: %v\n", err)
+		return 1
+	}
+
+	fmt.Println("The pages and theme from the config file will be used")
+	fmt.Println(cliProfileSwitchNote)
+	return 0
+}
+
+const cliProfileSwitchNote = "If Glance is running, this applies the next time the config changes or Glance restarts, use the API to switch right away"
+
+// The config history is needed the most when the config files are broken, so unlike cliOpenDatabase
+// this falls back to the database path as written in the config, or to the default one
+func cliOpenConfigHistoryDatabase(configPath string) (*database.DB, error) {
+	path, err := cliDatabasePath(configPath)
+	if err != nil {
+		databasePath := "glance.db"
+
+		if contents, _, parseErr := parseYAMLIncludes(configPath); parseErr == nil {
+			var partial struct {
+				Database struct {
+					Path string `yaml:"path"`
+				} `yaml:"database"`
+			}
+
+			// A syntax error anywhere else in the config shouldn't stop the database section from being read
+			if yaml.Unmarshal(contents, &partial) != nil {
+				yaml.Unmarshal(topLevelYAMLSection(contents, "database"), &partial)
+			}
+
+			if partial.Database.Path != "" {
+				databasePath = partial.Database.Path
+			}
+		}
+
+		path = resolveDatabasePath(configPath, databasePath)
+		if _, statErr := os.Stat(path); statErr != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Using the database at %s since the config can't be used (%v)\n\n", path, err)
+	} else if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("could not find a database at %s", path)
+	}
+
+	db, err := database.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open database at %s: %v", path, err)
+	}
+
+	if err := cliCheckMigrated(db, path); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Returns the lines of a top level key along with the indented lines that follow it
+func topLevelYAMLSection(contents []byte, key string) []byte {
+	lines := strings.Split(string(contents), "\n")
+
+	for i, line := range lines {
+		if !strings.HasPrefix(line, key+":") {
+			continue
+		}
+
+		end := i + 1
+		for end < len(lines) && (lines[end] == "" || lines[end][0] == ' ' || lines[end][0] == '\t' || lines[end][0] == '#') {
+			end++
+		}
+
+		return []byte(strings.Join(lines[i:end], "\n"))
+	}
+
+	return nil
+}
+
+func cliConfigHistory(configPath string) int {
+	db, err := cliOpenConfigHistoryDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	versions, err := db.ConfigVersions.List(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to list config versions: %v\n", err)
+		return 1
+	}
+
+	if len(versions) == 0 {
+		fmt.Println("No config versions have been recorded yet, they get recorded when Glance starts or reloads its config")
+		return 0
+	}
+
+	// Can't be marked if the config files currently don't parse, which is fine
+	var currentHash string
+	if contents, _, err := parseYAMLIncludes(configPath); err == nil {
+		currentHash = hashConfigContents(contents)
+	}
+
+	markedCurrent := false
+	for _, version := range versions {
+		current := !markedCurrent && version.Hash == currentHash
+		markedCurrent = markedCurrent || current
+
+		fmt.Printf(
+			" %s %-5d %s  %s\n",
+			ternary(current, "*", " "),
+			version.ID,
+			version.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			version.Hash[:12],
+		)
+	}
+
+	if !markedCurrent {
+		fmt.Println("\nThe config files currently don't match any of these versions")
+	}
+
+	return 0
+}
+
+// Returns the name and contents of a version, or of the config files as they are now
+func cliConfigVersionContents(db *database.DB, configPath, version string) (string, string, error) {
+	if version == "current" {
+		contents, _, err := parseYAMLIncludes(configPath)
+		if err != nil {
+			return "", "", fmt.Errorf("could not parse config file: %v", err)
+		}
+
+		return "current", string(contents), nil
+	}
+
+	id, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid version: %s", version)
+	}
+
+	stored, err := db.ConfigVersions.Get(context.Background(), id)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get version %d: %v", id, err)
+	}
+
+	if stored == nil {
+		return "", "", fmt.Errorf("no version %d, see config:history for the available ones", id)
+	}
+
+	name := fmt.Sprintf("version %d (%s)", id, stored.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	return name, stored.Contents, nil
+}
+
+func cliConfigDiff(configPath, from, to string) int {
+	db, err := cliOpenConfigHistoryDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	fromName, fromContents, err := cliConfigVersionContents(db, configPath, from)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	toName, toContents, err := cliConfigVersionContents(db, configPath, to)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	diff := diffConfigs(fromName, toName, fromContents, toContents)
+	if diff == "" {
+		fmt.Println("No differences")
+		return 0
+	}
+
+	fmt.Print(diff)
+	return 0
+}
+
+func cliConfigRollback(configPath, version string) int {
+	id, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		fmt.Printf("Invalid version: %s\n", version)
+		return 1
+	}
+
+	db, err := cliOpenConfigHistoryDatabase(configPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	stored, err := db.ConfigVersions.Get(context.Background(), id)
+	if err != nil {
+		fmt.Printf("Failed to get version %d: %v\n", id, err)
+		return 1
+	}
+
+	if stored == nil {
+		fmt.Printf("No version %d, see config:history for the available ones\n", id)
+		return 1
+	}
+
+	restored, err := restoreConfigFiles(stored)
+	for _, path := range restored {
+		fmt.Printf("Restored %s\n", path)
+	}
+
+	if err != nil {
+		fmt.Printf("Failed to restore config files: %v\n", err)
+		return 1
+	}
+
+	if len(restored) == 0 {
+		fmt.Printf("The config files already match version %d\n", id)
+		return 0
+	}
+
+	fmt.Println("The files that were replaced have been kept next to them with a .before-rollback suffix")
+	fmt.Println("If Glance is running, it reloads the restored config on its own")
+	return 0
+}
@@ -0,0 +1,54 @@
+package glance
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+func TestCliRefusesDatabaseWithPendingMigrations(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "glance.yml")
+
+	err := os.WriteFile(configPath, []byte(`
+database:
+  path: glance.db
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: hello
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Open(filepath.Join(dir, "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := cliOpenMigratedDatabase(configPath); err == nil || !strings.Contains(err.Error(), "db:migrate") {
+		t.Errorf("Expected profile commands to point to db:migrate, got %v", err)
+	}
+
+	if _, err := cliOpenConfigHistoryDatabase(configPath); err == nil || !strings.Contains(err.Error(), "db:migrate") {
+		t.Errorf("Expected config commands to point to db:migrate, got %v", err)
+	}
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	migrated, err := cliOpenMigratedDatabase(configPath)
+	if err != nil {
+		t.Fatalf("Expected the migrated database to be opened, got %v", err)
+	}
+	migrated.Close()
+}
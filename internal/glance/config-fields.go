@@ -2,6 +2,7 @@ package glance
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -104,6 +105,25 @@ func (d *durationField) UnmarshalYAML(node *yaml.Node) error {
 		return err
 	}
 
+	return d.parse(value)
+}
+
+// Durations in API requests and responses use the same format as the config file
+func (d *durationField) UnmarshalJSON(data []byte) error {
+	var value string
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	return d.parse(value)
+}
+
+func (d durationField) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *durationField) parse(value string) error {
 	matches := durationFieldPattern.FindStringSubmatch(value)
 
 	if len(matches) != 3 {
@@ -129,6 +149,22 @@ func (d *durationField) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+// Formats the duration using the largest unit it's a whole number of
+func (d durationField) String() string {
+	duration := time.Duration(d)
+
+	switch {
+	case duration != 0 && duration%(24*time.Hour) == 0:
+		return strconv.FormatInt(int64(duration/(24*time.Hour)), 10) + "d"
+	case duration != 0 && duration%time.Hour == 0:
+		return strconv.FormatInt(int64(duration/time.Hour), 10) + "h"
+	case duration != 0 && duration%time.Minute == 0:
+		return strconv.FormatInt(int64(duration/time.Minute), 10) + "m"
+	default:
+		return strconv.FormatInt(int64(duration/time.Second), 10) + "s"
+	}
+}
+
 type customIconField struct {
 	URL        template.URL
 	AutoInvert bool
@@ -225,10 +261,10 @@ func (p *proxyOptionsField) UnmarshalYAML(node *yaml.Node) error {
 
 	p.client = &http.Client{
 		Timeout: timeout,
-		Transport: &http.Transport{
+		Transport: newInstrumentedTransport(&http.Transport{
 			Proxy:           http.ProxyURL(parsedUrl),
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: p.AllowInsecure},
-		},
+		}),
 	}
 
 	return nil
@@ -0,0 +1,248 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+const configDiffContextLines = 3
+
+func hashConfigContents(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// Records the config files as they are now as a new version, given that they still result in the
+// contents that were accepted. If they don't, they were changed again and the reload that follows
+// records them instead.
+func recordConfigVersion(db *database.DB, configPath string, contents []byte, keep int) {
+	if db == nil {
+		return
+	}
+
+	current, files, err := parseYAMLIncludesWithFiles(configPath)
+	if err != nil {
+		log.Printf("Failed to read config files for the config history: %v", err)
+		return
+	}
+
+	if !bytes.Equal(current, contents) {
+		return
+	}
+
+	version := &database.ConfigVersion{
+		Hash:      hashConfigContents(contents),
+		Contents:  string(contents),
+		Files:     make(map[string]string, len(files)),
+		CreatedAt: time.Now(),
+	}
+
+	for path, fileContents := range files {
+		version.Files[path] = string(fileContents)
+	}
+
+	if _, err := db.ConfigVersions.Record(context.Background(), version, keep); err != nil {
+		log.Printf("Failed to record config version: %v", err)
+	}
+}
+
+// Writes the files of a version over the current ones, keeping a copy of each file that gets
+// replaced next to it. Returns the paths of the files that were changed.
+func restoreConfigFiles(version *database.ConfigVersion) ([]string, error) {
+	paths := slices.Sorted(maps.Keys(version.Files))
+
+	restored := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		contents := []byte(version.Files[path])
+		mode := fs.FileMode(0o644)
+
+		existing, err := os.ReadFile(path)
+		if err == nil {
+			if bytes.Equal(existing, contents) {
+				continue
+			}
+
+			if info, err := os.Stat(path); err == nil {
+				mode = info.Mode().Perm()
+			}
+
+			if err := os.WriteFile(path+".before-rollback", existing, mode); err != nil {
+				return restored, fmt.Errorf("keeping a copy of %s: %w", path, err)
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return restored, fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		if err := os.WriteFile(path, contents, mode); err != nil {
+			return restored, fmt.Errorf("writing %s: %w", path, err)
+		}
+
+		restored = append(restored, path)
+	}
+
+	return restored, nil
+}
+
+type configDiffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// Returns the difference between two configs in the unified format, or an empty string if they're the same
+func diffConfigs(fromName, toName, from, to string) string {
+	lines := diffConfigLines(splitConfigLines(from), splitConfigLines(to))
+
+	// Number of lines of each side that come before every line of the diff, used for the hunk headers
+	fromPositions := make([]int, len(lines)+1)
+	toPositions := make([]int, len(lines)+1)
+	for i, line := range lines {
+		fromPositions[i+1] = fromPositions[i] + ternary(line.kind != '+', 1, 0)
+		toPositions[i+1] = toPositions[i] + ternary(line.kind != '-', 1, 0)
+	}
+
+	var output strings.Builder
+
+	for i := 0; i < len(lines); {
+		for i < len(lines) && lines[i].kind == ' ' {
+			i++
+		}
+
+		if i == len(lines) {
+			break
+		}
+
+		if output.Len() == 0 {
+			fmt.Fprintf(&output, "--- %s\n+++ %s\n", fromName, toName)
+		}
+
+		start := max(i-configDiffContextLines, 0)
+		end := i
+
+		// Changes that are close enough to share their context lines go in the same hunk
+		for {
+			for end < len(lines) && lines[end].kind != ' ' {
+				end++
+			}
+
+			next := end
+			for next < len(lines) && lines[next].kind == ' ' {
+				next++
+			}
+
+			if next == len(lines) || next-end > 2*configDiffContextLines {
+				break
+			}
+
+			end = next
+		}
+
+		end = min(end+configDiffContextLines, len(lines))
+
+		fromCount := fromPositions[end] - fromPositions[start]
+		toCount := toPositions[end] - toPositions[start]
+		fmt.Fprintf(
+			&output,
+			"@@ -%d,%d +%d,%d @@\n",
+			fromPositions[start]+ternary(fromCount > 0, 1, 0), fromCount,
+			toPositions[start]+ternary(toCount > 0, 1, 0), toCount,
+		)
+
+		for _, line := range lines[start:end] {
+			output.WriteByte(line.kind)
+			output.WriteString(line.text)
+			output.WriteByte('\n')
+		}
+
+		i = end
+	}
+
+	return output.String()
+}
+
+func splitConfigLines(contents string) []string {
+	if contents == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+}
+
+// Edits to a config usually only touch a few lines, so the lines that both sides start and end with
+// are skipped before finding the longest common subsequence of what's left in between
+func diffConfigLines(from, to []string) []configDiffLine {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]configDiffLine, 0, len(from)+len(to))
+	for _, text := range from[:prefix] {
+		lines = append(lines, configDiffLine{' ', text})
+	}
+
+	a, b := from[prefix:len(from)-suffix], to[prefix:len(to)-suffix]
+
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			lines = append(lines, configDiffLine{' ', a[i]})
+			i++
+			j++
+		} else if common[i+1][j] >= common[i][j+1] {
+			lines = append(lines, configDiffLine{'-', a[i]})
+			i++
+		} else {
+			lines = append(lines, configDiffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		lines = append(lines, configDiffLine{'-', a[i]})
+	}
+
+	for ; j < len(b); j++ {
+		lines = append(lines, configDiffLine{'+', b[j]})
+	}
+
+	for _, text := range from[len(from)-suffix:] {
+		lines = append(lines, configDiffLine{' ', text})
+	}
+
+	return lines
+}
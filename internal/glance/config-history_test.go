@@ -0,0 +1,101 @@
+package glance
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	to := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+
+	expected := `--- 1
++++ 2
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+`
+
+	if diff := diffConfigs("1", "2", from, to); diff != expected {
+		t.Errorf("Unexpected diff:\n%s\nexpected:\n%s", diff, expected)
+	}
+
+	if diff := diffConfigs("1", "2", from, from); diff != "" {
+		t.Errorf("Expected no diff for the same config, got:\n%s", diff)
+	}
+
+	if diff := diffConfigs("1", "2", "", "a\n"); diff != "--- 1\n+++ 2\n@@ -0,0 +1,1 @@\n+a\n" {
+		t.Errorf("Unexpected diff against an empty config:\n%s", diff)
+	}
+}
+
+func TestConfigVersionsAreRestored(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "glance.yml")
+	pagesPath := filepath.Join(dir, "pages.yml")
+
+	write := func(path, contents string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(mainPath, "server:\n  port: 8080\npages:\n  - $include: pages.yml\n")
+	write(pagesPath, "name: Home\n")
+
+	db, err := database.New(filepath.Join(dir, "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	contents, _, err := parseYAMLIncludes(mainPath)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	recordConfigVersion(db, mainPath, contents, 10)
+	recordConfigVersion(db, mainPath, []byte("changed since"), 10)
+
+	versions, _ := db.ConfigVersions.List(t.Context())
+	if len(versions) != 1 {
+		t.Fatalf("Expected only the config matching the files to be recorded, got %d versions", len(versions))
+	}
+
+	write(pagesPath, "name: Broken\n  oops\n")
+
+	version, _ := db.ConfigVersions.Get(t.Context(), versions[0].ID)
+	restored, err := restoreConfigFiles(version)
+	if err != nil {
+		t.Fatalf("Failed to restore config files: %v", err)
+	}
+
+	if len(restored) != 1 || restored[0] != pagesPath {
+		t.Errorf("Expected only the changed file to be restored, got %v", restored)
+	}
+
+	if restoredContents, _ := os.ReadFile(pagesPath); string(restoredContents) != "name: Home\n" {
+		t.Errorf("Unexpected contents after restoring: %q", restoredContents)
+	}
+
+	if backup, _ := os.ReadFile(pagesPath + ".before-rollback"); string(backup) != "name: Broken\n  oops\n" {
+		t.Errorf("Expected the replaced file to be kept, got %q", backup)
+	}
+
+	if info, _ := os.Stat(pagesPath); info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the permissions of the file to be kept, got %v", info.Mode().Perm())
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/glanceapp/glance/internal/database"
 	"gopkg.in/yaml.v3"
 )
 
@@ -34,13 +35,45 @@ type config struct {
 		Proxied    bool   `yaml:"proxied"`
 		AssetsPath string `yaml:"assets-path"`
 		BaseURL    string `yaml:"base-url"`
+		// The maximum number of widgets that can be updating at the same time
+		UpdateConcurrency int           `yaml:"update-concurrency"`
+		MaxStaleness      durationField `yaml:"max-staleness"`
 	} `yaml:"server"`
 
 	Auth struct {
-		SecretKey string           `yaml:"secret-key"`
-		Users     map[string]*user `yaml:"users"`
+		SecretKey   string           `yaml:"secret-key"`
+		Users       map[string]*user `yaml:"users"`
+		IdleTimeout durationField    `yaml:"idle-timeout"`
+		MaxLifetime durationField    `yaml:"max-session-lifetime"`
+		OIDC        *oidcProvider    `yaml:"oidc"`
 	} `yaml:"auth"`
 
+	Database struct {
+		Enabled        bool          `yaml:"enabled"`
+		Path           string        `yaml:"path"`
+		Retention      durationField `yaml:"retention"`
+		ConfigVersions int           `yaml:"config-versions"`
+		History        struct {
+			RawRetention        durationField `yaml:"raw-retention"`
+			FiveMinuteRetention durationField `yaml:"five-minute-retention"`
+			HourlyRetention     durationField `yaml:"hourly-retention"`
+		} `yaml:"history"`
+		Maintenance struct {
+			Interval       durationField `yaml:"interval"`
+			VacuumInterval durationField `yaml:"vacuum-interval"`
+		} `yaml:"maintenance"`
+	} `yaml:"database"`
+
+	API struct {
+		RateLimit   int      `yaml:"rate-limit"`
+		CORSOrigins []string `yaml:"cors-origins"`
+	} `yaml:"api"`
+
+	Metrics struct {
+		Enabled bool   `yaml:"enabled"`
+		Token   string `yaml:"token"`
+	} `yaml:"metrics"`
+
 	Document struct {
 		Head template.HTML `yaml:"head"`
 	} `yaml:"document"`
@@ -65,7 +98,16 @@ type config struct {
 		AppBackgroundColor string        `yaml:"app-background-color"`
 	} `yaml:"branding"`
 
+	Notifications map[string]*notificationChannel `yaml:"notifications"`
+	Alerts        []alertRule                     `yaml:"alerts"`
+
 	Pages []page `yaml:"pages"`
+
+	// The contents of the config files the config was parsed from, before variables were replaced
+	// and without the pages and theme of the active profile, used to apply profiles to it
+	contents []byte
+	// The profile whose pages and theme are used instead of the ones from the config files, if any
+	profile *database.Profile
 }
 
 type user struct {
@@ -87,18 +129,28 @@ type page struct {
 		Size    string  `yaml:"size"`
 		Widgets widgets `yaml:"widgets"`
 	} `yaml:"columns"`
-	PrimaryColumnIndex int8       `yaml:"-"`
-	mu                 sync.Mutex `yaml:"-"`
+	PrimaryColumnIndex int8 `yaml:"-"`
 }
 
 func newConfigFromYAML(contents []byte) (*config, error) {
+	original := contents
 	contents, err := parseConfigVariables(contents)
 	if err != nil {
 		return nil, err
 	}
 
-	config := &config{}
+	config := &config{contents: original}
 	config.Server.Port = 8080
+	config.Server.UpdateConcurrency = 10
+	config.Server.MaxStaleness = durationField(10 * time.Minute)
+	config.Database.Path = "glance.db"
+	config.Database.Retention = durationField(30 * 24 * time.Hour)
+	config.Database.ConfigVersions = 50
+	config.Database.History.RawRetention = durationField(2 * 24 * time.Hour)
+	config.Database.History.FiveMinuteRetention = durationField(30 * 24 * time.Hour)
+	config.Database.History.HourlyRetention = durationField(365 * 24 * time.Hour)
+	config.Database.Maintenance.Interval = durationField(time.Hour)
+	config.Database.Maintenance.VacuumInterval = durationField(24 * time.Hour)
 
 	err = yaml.Unmarshal(contents, config)
 	if err != nil {
@@ -109,6 +161,10 @@ func newConfigFromYAML(contents []byte) (*config, error) {
 		return nil, err
 	}
 
+	if err = assignWidgetIDs(config); err != nil {
+		return nil, err
+	}
+
 	for p := range config.Pages {
 		for w := range config.Pages[p].HeadWidgets {
 			if err := config.Pages[p].HeadWidgets[w].initialize(); err != nil {
@@ -125,9 +181,68 @@ func newConfigFromYAML(contents []byte) (*config, error) {
 		}
 	}
 
+	if err = initializeNotificationChannels(config); err != nil {
+		return nil, err
+	}
+
+	if config.Auth.OIDC != nil {
+		if err = config.Auth.OIDC.initialize(); err != nil {
+			return nil, fmt.Errorf("auth oidc: %v", err)
+		}
+	}
+
+	if err = validateAlertRules(config); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
+func assignWidgetIDs(config *config) error {
+	locationOfID := make(map[string]string)
+
+	var assign func(list widgets, location string) error
+	assign = func(list widgets, location string) error {
+		for i, widget := range list {
+			widgetLocation := fmt.Sprintf("%s/%d", location, i)
+			if err := widget.assignID(widgetLocation); err != nil {
+				return fmt.Errorf("%s: %v", widgetLocation, err)
+			}
+
+			if other, exists := locationOfID[widget.GetID()]; exists {
+				return fmt.Errorf("widget id \"%s\" is used by both %s and %s", widget.GetID(), other, widgetLocation)
+			}
+
+			locationOfID[widget.GetID()] = widgetLocation
+
+			if container, ok := widget.(widgetWithChildren); ok {
+				if err := assign(container.childWidgets(), widgetLocation); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	for p := range config.Pages {
+		page := &config.Pages[p]
+		slug := ternary(page.Slug == "", titleToSlug(page.Title), page.Slug)
+
+		if err := assign(page.HeadWidgets, slug+"/head"); err != nil {
+			return err
+		}
+
+		for c := range page.Columns {
+			if err := assign(page.Columns[c].Widgets, fmt.Sprintf("%s/%d", slug, c)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 var envVariableNamePattern = regexp.MustCompile(`^[A-Z0-9_]+$`)
 var configVariablePattern = regexp.MustCompile(`(^|.)\$\{(?:([a-zA-Z]+):)?([a-zA-Z0-9_-]+)\}`)
 
@@ -240,10 +355,27 @@ func formatWidgetInitError(err error, w widget) error {
 var configIncludePattern = regexp.MustCompile(`(?m)^([ \t]*)(?:-[ \t]*)?(?:!|\$)include:[ \t]*(.+)$`)
 
 func parseYAMLIncludes(mainFilePath string) ([]byte, map[string]struct{}, error) {
-	return recursiveParseYAMLIncludes(mainFilePath, nil, 0)
+	return recursiveParseYAMLIncludes(mainFilePath, nil, nil, 0)
 }
 
-func recursiveParseYAMLIncludes(mainFilePath string, includes map[string]struct{}, depth int) ([]byte, map[string]struct{}, error) {
+// Same as parseYAMLIncludes but also returns the contents of each file before includes
+// were resolved, keyed by their absolute path
+func parseYAMLIncludesWithFiles(mainFilePath string) ([]byte, map[string][]byte, error) {
+	files := make(map[string][]byte)
+	contents, _, err := recursiveParseYAMLIncludes(mainFilePath, nil, files, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return contents, files, nil
+}
+
+func recursiveParseYAMLIncludes(
+	mainFilePath string,
+	includes map[string]struct{},
+	files map[string][]byte,
+	depth int,
+) ([]byte, map[string]struct{}, error) {
 	if depth > CONFIG_INCLUDE_RECURSION_DEPTH_LIMIT {
 		return nil, nil, fmt.Errorf("recursion depth limit of %d reached", CONFIG_INCLUDE_RECURSION_DEPTH_LIMIT)
 	}
@@ -259,6 +391,10 @@ func recursiveParseYAMLIncludes(mainFilePath string, includes map[string]struct{
 	}
 	mainFileDir := filepath.Dir(mainFileAbsPath)
 
+	if files != nil {
+		files[mainFileAbsPath] = mainFileContents
+	}
+
 	if includes == nil {
 		includes = make(map[string]struct{})
 	}
@@ -286,7 +422,7 @@ func recursiveParseYAMLIncludes(mainFilePath string, includes map[string]struct{
 
 		includes[includeFilePath] = struct{}{}
 
-		fileContents, includes, err = recursiveParseYAMLIncludes(includeFilePath, includes, depth+1)
+		fileContents, includes, err = recursiveParseYAMLIncludes(includeFilePath, includes, files, depth+1)
 		if err != nil {
 			includesLastErr = err
 			return nil
@@ -453,8 +589,37 @@ func isConfigStateValid(config *config) error {
 		return fmt.Errorf("no pages configured")
 	}
 
-	if len(config.Auth.Users) > 0 && config.Auth.SecretKey == "" {
-		return fmt.Errorf("secret-key must be set when users are configured")
+	if (len(config.Auth.Users) > 0 || config.Auth.OIDC != nil) && config.Auth.SecretKey == "" {
+		return fmt.Errorf("secret-key must be set when users or oidc are configured")
+	}
+
+	// Users of the provider aren't known ahead of time, so only stored sessions can say who they are
+	if config.Auth.OIDC != nil && !config.Database.Enabled {
+		return fmt.Errorf("auth oidc requires the database to be enabled")
+	}
+
+	if config.Auth.IdleTimeout != 0 {
+		if !config.Database.Enabled {
+			return fmt.Errorf("auth idle-timeout requires the database to be enabled")
+		}
+
+		if config.Auth.IdleTimeout < durationField(5*time.Minute) {
+			return fmt.Errorf("auth idle-timeout must be at least 5m")
+		}
+	}
+
+	if config.Auth.MaxLifetime != 0 {
+		if !config.Database.Enabled {
+			return fmt.Errorf("auth max-session-lifetime requires the database to be enabled")
+		}
+
+		if config.Auth.MaxLifetime < durationField(time.Hour) {
+			return fmt.Errorf("auth max-session-lifetime must be at least 1h")
+		}
+
+		if config.Auth.MaxLifetime < config.Auth.IdleTimeout {
+			return fmt.Errorf("auth max-session-lifetime cannot be shorter than idle-timeout")
+		}
 	}
 
 	for username := range config.Auth.Users {
@@ -466,6 +631,10 @@ func isConfigStateValid(config *config) error {
 			return errors.New("usernames must be at least 3 characters")
 		}
 
+		if strings.HasPrefix(username, oidcSessionUserIDPrefix) {
+			return fmt.Errorf("username %s cannot start with %s", username, oidcSessionUserIDPrefix)
+		}
+
 		user := config.Auth.Users[username]
 
 		if user.Password == "" {
@@ -477,6 +646,49 @@ func isConfigStateValid(config *config) error {
 		}
 	}
 
+	if config.Database.Enabled {
+		if config.Database.Path == "" {
+			return fmt.Errorf("database path cannot be empty")
+		}
+
+		if config.Database.Retention < durationField(time.Hour) {
+			return fmt.Errorf("database retention must be at least 1h")
+		}
+
+		if config.Database.ConfigVersions < 1 {
+			return fmt.Errorf("database config-versions must be at least 1")
+		}
+
+		history := &config.Database.History
+		if history.RawRetention < durationField(time.Hour) {
+			return fmt.Errorf("database history raw-retention must be at least 1h")
+		}
+
+		if history.FiveMinuteRetention < durationField(time.Hour) {
+			return fmt.Errorf("database history five-minute-retention must be at least 1h")
+		}
+
+		if history.HourlyRetention < durationField(24*time.Hour) {
+			return fmt.Errorf("database history hourly-retention must be at least 1d")
+		}
+
+		if config.Database.Maintenance.Interval < durationField(maintenanceTickInterval) {
+			return fmt.Errorf("database maintenance interval must be at least 5m")
+		}
+
+		if config.Database.Maintenance.VacuumInterval < durationField(time.Hour) {
+			return fmt.Errorf("database maintenance vacuum-interval must be at least 1h")
+		}
+	}
+
+	if config.API.RateLimit < 0 {
+		return fmt.Errorf("api rate-limit cannot be negative")
+	}
+
+	if config.Server.UpdateConcurrency < 1 {
+		return fmt.Errorf("server update-concurrency must be at least 1")
+	}
+
 	if config.Server.AssetsPath != "" {
 		if _, err := os.Stat(config.Server.AssetsPath); os.IsNotExist(err) {
 			return fmt.Errorf("assets directory does not exist: %s", config.Server.AssetsPath)
@@ -0,0 +1,150 @@
+package glance
+
+import (
+	"strings"
+	"testing"
+)
+
+const widgetIDsTestConfig = `
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: to-do
+            id: tasks
+          - type: html
+            source: hello
+          - type: group
+            widgets:
+              - type: html
+                source: first
+              - type: html
+                source: second
+`
+
+func TestWidgetIDsAreStableAcrossParses(t *testing.T) {
+	collectIDs := func() []string {
+		config, err := newConfigFromYAML([]byte(widgetIDsTestConfig))
+		if err != nil {
+			t.Fatalf("Failed to parse config: %v", err)
+		}
+
+		widgets := config.Pages[0].Columns[0].Widgets
+		ids := []string{widgets[0].GetID(), widgets[1].GetID(), widgets[2].GetID()}
+
+		for _, child := range widgets[2].(widgetWithChildren).childWidgets() {
+			ids = append(ids, child.GetID())
+		}
+
+		return ids
+	}
+
+	first := collectIDs()
+	second := collectIDs()
+
+	if first[0] != "tasks" {
+		t.Errorf("Expected configured ID to be used, got %s", first[0])
+	}
+
+	seen := make(map[string]bool)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("ID at index %d changed between parses: %s != %s", i, first[i], second[i])
+		}
+
+		if seen[first[i]] {
+			t.Errorf("ID %s was assigned more than once", first[i])
+		}
+
+		seen[first[i]] = true
+	}
+}
+
+func TestDuplicateWidgetIDsAcrossPagesAreRejected(t *testing.T) {
+	contents := `
+pages:
+  - name: First
+    columns:
+      - size: full
+        widgets:
+          - type: to-do
+            id: tasks
+  - name: Second
+    columns:
+      - size: full
+        widgets:
+          - type: to-do
+            id: tasks
+`
+
+	_, err := newConfigFromYAML([]byte(contents))
+	if err == nil || !strings.Contains(err.Error(), `"tasks"`) {
+		t.Fatalf("Expected duplicate ID error, got %v", err)
+	}
+}
+
+func TestDerivedWidgetIDsSurviveEdits(t *testing.T) {
+	idOf := func(contents string) string {
+		t.Helper()
+		config, err := newConfigFromYAML([]byte(contents))
+		if err != nil {
+			t.Fatalf("Failed to parse config: %v", err)
+		}
+
+		return config.Pages[0].Columns[0].Widgets[1].GetID()
+	}
+
+	edited := strings.Replace(widgetIDsTestConfig, "source: hello", "source: hello\n            title: Greeting", 1)
+	if before, after := idOf(widgetIDsTestConfig), idOf(edited); before != after {
+		t.Errorf("Expected the ID to stay the same when the properties change, got %s and %s", before, after)
+	}
+}
+
+func TestWidgetIDsWithUnsafeCharactersAreRejected(t *testing.T) {
+	for _, id := range []string{"my tasks", "tasks/../x", `"><script>`} {
+		contents := strings.Replace(widgetIDsTestConfig, "source: hello", "source: hello\n            id: '"+id+"'", 1)
+
+		if _, err := newConfigFromYAML([]byte(contents)); err == nil || !strings.Contains(err.Error(), "can only contain") {
+			t.Errorf("Expected ID %q to be rejected, got %v", id, err)
+		}
+	}
+}
+
+func TestLegacyTodoIDsKeepTheirTasks(t *testing.T) {
+	contents := strings.Replace(widgetIDsTestConfig, "id: tasks", "id: 'my tasks/v1.2'", 1)
+
+	config, err := newConfigFromYAML([]byte(contents))
+	if err != nil {
+		t.Fatalf("Expected a to-do widget with an ID from before they were validated to be accepted, got %v", err)
+	}
+
+	todo := config.Pages[0].Columns[0].Widgets[0].(*todoWidget)
+	if !widgetIDPattern.MatchString(todo.GetID()) || todo.HasConfiguredID() {
+		t.Errorf("Expected the widget to get a derived ID, got %q", todo.GetID())
+	}
+
+	if key := todo.StorageKey(); key != "my tasks/v1.2" {
+		t.Errorf("Expected the tasks to still be stored under the old ID, got %q", key)
+	}
+}
+
+func TestAlertsRequireConfiguredWidgetIDs(t *testing.T) {
+	config, err := newConfigFromYAML([]byte(widgetIDsTestConfig))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	alertOn := func(id string) error {
+		_, err := newConfigFromYAML([]byte("database:\n  enabled: true\nalerts:\n  - name: broken\n    widget: " + id + "\n    condition: widget-error\n" + widgetIDsTestConfig))
+		return err
+	}
+
+	if err := alertOn("tasks"); err != nil {
+		t.Errorf("Expected an alert on a widget with a configured ID to be accepted, got %v", err)
+	}
+
+	if err := alertOn(config.Pages[0].Columns[0].Widgets[1].GetID()); err == nil || !strings.Contains(err.Error(), "has no id set in the config") {
+		t.Errorf("Expected an alert on a widget with a derived ID to be rejected, got %v", err)
+	}
+}
@@ -2,20 +2,24 @@ package glance
 
 import (
 	"bytes"
-	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"path/filepath"
-	"runtime"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/glanceapp/glance/internal/api"
+	"github.com/glanceapp/glance/internal/database"
+	"github.com/glanceapp/glance/internal/metrics"
+	"github.com/glanceapp/glance/internal/websocket"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -27,7 +31,24 @@ var (
 
 const STATIC_ASSETS_CACHE_DURATION = 24 * time.Hour
 
-var reservedPageSlugs = []string{"login", "logout"}
+var reservedPageSlugs = []string{"login", "logout", "sessions"}
+
+// Services that live for the whole lifetime of the process and are shared by
+// every application created when the config gets reloaded
+type sharedServices struct {
+	// May be nil when the database is disabled
+	db        *database.DB
+	wsHub     *websocket.Hub
+	scheduler *widgetScheduler
+	metrics   *metrics.Collector
+	// Budgets of the clients of the API, may be nil in which case they start over on every reload
+	apiRateLimiter *api.RateLimiter
+	// Nil when the database is disabled
+	maintenance *databaseMaintenance
+	alerts      *alertManager
+	// Parses the config files again and switches over to them, nil when they aren't being watched
+	reloadConfig func()
+}
 
 type application struct {
 	Version   string
@@ -37,7 +58,10 @@ type application struct {
 	parsedManifest []byte
 
 	slugToPage map[string]*page
-	widgetByID map[uint64]widget
+	widgetByID map[string]widget
+
+	services  *sharedServices
+	apiServer *api.Server
 
 	RequiresAuth           bool
 	authSecretKey          []byte
@@ -46,13 +70,16 @@ type application struct {
 	failedAuthAttempts     map[string]*failedAuthAttempt
 }
 
-func newApplication(c *config) (*application, error) {
+// The previous application is used to carry over widgets whose config hasn't
+// changed and the state of notification channels, it should be nil if there isn't one
+func newApplication(c *config, services *sharedServices, previous *application) (*application, error) {
 	app := &application{
 		Version:    buildVersion,
 		CreatedAt:  time.Now(),
 		Config:     *c,
 		slugToPage: make(map[string]*page),
-		widgetByID: make(map[uint64]widget),
+		widgetByID: make(map[string]widget),
+		services:   services,
 	}
 	config := &app.Config
 
@@ -60,7 +87,7 @@ func newApplication(c *config) (*application, error) {
 	// Init auth
 	//
 
-	if len(config.Auth.Users) > 0 {
+	if len(config.Auth.Users) > 0 || config.Auth.OIDC != nil {
 		secretBytes, err := base64.StdEncoding.DecodeString(config.Auth.SecretKey)
 		if err != nil {
 			return nil, fmt.Errorf("decoding secret-key: %v", err)
@@ -150,6 +177,8 @@ func newApplication(c *config) (*application, error) {
 
 	providers := &widgetProviders{
 		assetResolver: app.StaticAssetPath,
+		db:            services.db,
+		metrics:       services.metrics,
 	}
 
 	for p := range config.Pages {
@@ -164,6 +193,10 @@ func newApplication(c *config) (*application, error) {
 			return nil, fmt.Errorf("page slug \"%s\" is reserved", page.Slug)
 		}
 
+		if config.Metrics.Enabled && page.Slug == "metrics" {
+			return nil, fmt.Errorf("page slug \"metrics\" is reserved while metrics are enabled")
+		}
+
 		app.slugToPage[page.Slug] = page
 
 		if page.Width == "default" {
@@ -175,9 +208,7 @@ func newApplication(c *config) (*application, error) {
 		}
 
 		for i := range page.HeadWidgets {
-			widget := page.HeadWidgets[i]
-			app.widgetByID[widget.GetID()] = widget
-			widget.setProviders(providers)
+			page.HeadWidgets[i].setProviders(providers)
 		}
 
 		for c := range page.Columns {
@@ -188,9 +219,29 @@ func newApplication(c *config) (*application, error) {
 			}
 
 			for w := range column.Widgets {
-				widget := column.Widgets[w]
-				app.widgetByID[widget.GetID()] = widget
-				widget.setProviders(providers)
+				column.Widgets[w].setProviders(providers)
+			}
+		}
+
+	}
+
+	carried := carryOverUnchangedWidgets(config.Pages, previous, providers)
+	carryOverNotificationLimiters(config.Notifications, previous)
+
+	for p := range config.Pages {
+		page := &config.Pages[p]
+
+		page.walkWidgets(func(widget widget) {
+			app.widgetByID[widget.GetID()] = widget
+		})
+
+		if services.db == nil {
+			continue
+		}
+
+		for _, widget := range page.leafWidgets() {
+			if !carried[widget] {
+				restoreWidgetSnapshot(services.db, widget)
 			}
 		}
 	}
@@ -223,6 +274,31 @@ func newApplication(c *config) (*application, error) {
 		config.Branding.AppBackgroundColor = config.Theme.BackgroundColorAsHex
 	}
 
+	//
+	// Init API
+	//
+
+	// The budgets were handed out for the previous limit
+	if services.apiRateLimiter != nil && previous != nil && previous.Config.API.RateLimit != config.API.RateLimit {
+		services.apiRateLimiter.Cleanup()
+	}
+
+	app.apiServer = api.NewServer(services.db, &api.Config{
+		RateLimitEnabled: config.API.RateLimit > 0,
+		RateLimitRPM:     config.API.RateLimit,
+		CORSEnabled:      len(config.API.CORSOrigins) > 0,
+		CORSOrigins:      config.API.CORSOrigins,
+		ClientAddress:    app.addressOfRequest,
+		RateLimiter:      services.apiRateLimiter,
+	})
+	app.apiServer.SetWebSocketHub(services.wsHub)
+	if services.metrics != nil {
+		app.apiServer.SetMetricsCollector(services.metrics)
+	}
+	app.apiServer.Handle("GET /api/v1/search", http.HandlerFunc(app.handleSearchAPI))
+	app.registerAlertRoutes()
+	app.registerProfileRoutes()
+
 	manifest, err := executeTemplateToString(manifestTemplate, templateData{App: app})
 	if err != nil {
 		return nil, fmt.Errorf("parsing manifest.json: %v", err)
@@ -232,43 +308,69 @@ func newApplication(c *config) (*application, error) {
 	return app, nil
 }
 
-func (p *page) updateOutdatedWidgets() {
-	now := time.Now()
+// Makes the scheduler update the widgets of this application rather than
+// the ones of the application that was used before it
+func (a *application) scheduleWidgets() {
+	leaves := make([]widget, 0)
+	for p := range a.Config.Pages {
+		leaves = append(leaves, a.Config.Pages[p].leafWidgets()...)
+	}
+
+	db := a.services.db
+	collector := a.services.metrics
+	alerts := a.services.alerts
 
-	var wg sync.WaitGroup
-	context := context.Background()
+	if collector != nil {
+		ids := make([]string, len(leaves))
+		for i := range leaves {
+			ids[i] = leaves[i].GetID()
+		}
+		collector.Retain(ids)
+	}
 
-	for w := range p.HeadWidgets {
-		widget := p.HeadWidgets[w]
+	onUpdated := func(widget widget, result widgetUpdateResult) {
+		if collector != nil {
+			recordWidgetUpdateMetrics(collector, widget, result.duration)
+		}
 
-		if !widget.requiresUpdate(&now) {
-			continue
+		if db != nil {
+			saveWidgetSnapshot(db, widget)
+			recordWidgetHistory(db, widget)
+			recordWidgetUpdateActivity(db, widget, result.previousErr)
 		}
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			widget.update(context)
-		}()
+		if alerts != nil {
+			alerts.evaluate(widget)
+		}
 	}
 
-	for c := range p.Columns {
-		for w := range p.Columns[c].Widgets {
-			widget := p.Columns[c].Widgets[w]
+	a.services.scheduler.schedule(
+		leaves,
+		a.Config.Server.UpdateConcurrency,
+		time.Duration(a.Config.Server.MaxStaleness),
+		onUpdated,
+	)
+}
 
-			if !widget.requiresUpdate(&now) {
-				continue
-			}
+// Must be called with the widget locked
+func recordWidgetUpdateMetrics(collector *metrics.Collector, widget widget, duration time.Duration) {
+	update := metrics.Update{
+		WidgetID:   widget.GetID(),
+		WidgetType: widget.GetType(),
+		Duration:   duration,
+		Outcome:    metrics.OutcomeSuccess,
+	}
 
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				widget.update(context)
-			}()
-		}
+	if err := widget.getError(); err != nil {
+		update.Outcome = metrics.OutcomeError
+		update.Err = err
+		update.ErrorClass = classifyUpdateError(err)
+	} else if notice := widget.getNotice(); notice != nil {
+		update.Outcome = metrics.OutcomePartial
+		update.Err = notice
 	}
 
-	wg.Wait()
+	collector.RecordUpdate(update)
 }
 
 func (a *application) resolveUserDefinedAssetPath(path string) string {
@@ -348,17 +450,10 @@ func (a *application) handlePageContentRequest(w http.ResponseWriter, r *http.Re
 		Page: page,
 	}
 
-	var err error
-	var responseBytes bytes.Buffer
-
-	func() {
-		page.mu.Lock()
-		defer page.mu.Unlock()
-
-		page.updateOutdatedWidgets()
-		err = pageContentTemplate.Execute(&responseBytes, pageData)
-	}()
+	a.services.scheduler.refreshOutdated(r.Context(), page.leafWidgets())
 
+	var responseBytes bytes.Buffer
+	err := pageContentTemplate.Execute(&responseBytes, pageData)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
@@ -403,30 +498,6 @@ func (a *application) handleNotFound(w http.ResponseWriter, _ *http.Request) {
 	w.Write([]byte("Page not found"))
 }
 
-func (a *application) handleMetricsAPI(w http.ResponseWriter, r *http.Request) {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	metrics := map[string]interface{}{
-		"timestamp": time.Now().Unix(),
-		"system_metrics": map[string]interface{}{
-			"memory_mb":   m.Alloc / 1024 / 1024,
-			"goroutines":  runtime.NumGoroutine(),
-			"uptime":      fmt.Sprintf("%dh%dm%ds", int(time.Since(a.CreatedAt).Hours()), int(time.Since(a.CreatedAt).Minutes())%60, int(time.Since(a.CreatedAt).Seconds())%60),
-		},
-		"api_metrics": map[string]interface{}{
-			"total_requests":   0,
-			"average_latency_ms": 0,
-			"rate_limited":     0,
-		},
-		"widget_metrics": []interface{}{},
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	json.NewEncoder(w).Encode(metrics)
-}
-
 func (a *application) handleSearchAPI(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	if query == "" {
@@ -437,7 +508,8 @@ func (a *application) handleSearchAPI(w http.ResponseWriter, r *http.Request) {
 	results := []map[string]interface{}{}
 
 	// Search pages
-	for _, page := range a.Config.Pages {
+	for i := range a.Config.Pages {
+		page := &a.Config.Pages[i]
 		if strings.Contains(strings.ToLower(page.Title), strings.ToLower(query)) {
 			results = append(results, map[string]interface{}{
 				"id":    page.Slug,
@@ -454,7 +526,7 @@ func (a *application) handleSearchAPI(w http.ResponseWriter, r *http.Request) {
 		widgetType := widget.GetType()
 		if strings.Contains(strings.ToLower(widgetType), strings.ToLower(query)) {
 			results = append(results, map[string]interface{}{
-				"id":    fmt.Sprintf("%d", id),
+				"id":    id,
 				"title": fmt.Sprintf("%s Widget", strings.Title(strings.ReplaceAll(widgetType, "-", " "))),
 				"type":  "widget",
 				"url":   "",
@@ -464,70 +536,65 @@ func (a *application) handleSearchAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	json.NewEncoder(w).Encode(results)
 }
 
-func (a *application) handleActivityAPI(w http.ResponseWriter, r *http.Request) {
-	limit := 10
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		fmt.Sscanf(limitStr, "%d", &limit)
-	}
-
-	activities := []map[string]interface{}{
-		{
-			"id":         "activity-1",
-			"event_type": "info",
-			"widget":     "Dashboard",
-			"timestamp":  time.Now().Add(-2 * time.Minute),
-			"details":    "Dashboard loaded successfully",
-		},
-		{
-			"id":         "activity-2",
-			"event_type": "success",
-			"widget":     "Widgets",
-			"timestamp":  time.Now().Add(-5 * time.Minute),
-			"details":    "Widget data updated",
-		},
-		{
-			"id":         "activity-3",
-			"event_type": "info",
-			"widget":     "Metrics",
-			"timestamp":  time.Now().Add(-10 * time.Minute),
-			"details":    "System metrics collected",
-		},
-	}
-
-	if len(activities) > limit {
-		activities = activities[:limit]
+func (a *application) handleWidgetRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	json.NewEncoder(w).Encode(activities)
+	widget, exists := a.widgetByID[r.PathValue("widget")]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	widget.lock()
+	defer widget.unlock()
+
+	widget.handleRequest(w, r)
 }
 
-func (a *application) handleWidgetRequest(w http.ResponseWriter, r *http.Request) {
-	// TODO: this requires a rework of the widget update logic so that rather
-	// than locking the entire page we lock individual widgets
-	w.WriteHeader(http.StatusNotImplemented)
+// Updates the widget right away and responds with its newly rendered contents
+func (a *application) handleWidgetRefreshRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
 
-	// widgetValue := r.PathValue("widget")
+	target, exists := a.widgetByID[r.PathValue("widget")]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
 
-	// widgetID, err := strconv.ParseUint(widgetValue, 10, 64)
-	// if err != nil {
-	// 	a.handleNotFound(w, r)
-	// 	return
-	// }
+	a.services.scheduler.refresh(r.Context(), leafWidgets(widgets{target}))
+	writeRenderedWidget(w, target)
+}
 
-	// widget, exists := a.widgetByID[widgetID]
+// Responds with the rendered contents of the widget once the update it's going
+// through finishes, if any, used by pages that were loaded while it was refreshing
+func (a *application) handleWidgetContentRequest(w http.ResponseWriter, r *http.Request) {
+	if a.handleUnauthorizedResponse(w, r, showUnauthorizedJSON) {
+		return
+	}
 
-	// if !exists {
-	// 	a.handleNotFound(w, r)
-	// 	return
-	// }
+	target, exists := a.widgetByID[r.PathValue("widget")]
+	if !exists {
+		a.handleNotFound(w, r)
+		return
+	}
+
+	a.services.scheduler.waitForUpdating(r.Context(), leafWidgets(widgets{target}))
+	writeRenderedWidget(w, target)
+}
 
-	// widget.handleRequest(w, r)
+func writeRenderedWidget(w http.ResponseWriter, target widget) {
+	target.lock()
+	defer target.unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(target.Render()))
 }
 
 func (a *application) StaticAssetPath(asset string) string {
@@ -539,7 +606,7 @@ func (a *application) VersionedAssetPath(asset string) string {
 		"?v=" + strconv.FormatInt(a.CreatedAt.Unix(), 10)
 }
 
-func (a *application) server() (func() error, func() error) {
+func (a *application) handler() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /{$}", a.handlePageRequest)
@@ -551,20 +618,36 @@ func (a *application) server() (func() error, func() error) {
 		mux.HandleFunc("POST /api/set-theme/{key}", a.handleThemeChangeRequest)
 	}
 
-	// New API endpoints
-	mux.HandleFunc("GET /api/v1/metrics", a.handleMetricsAPI)
-	mux.HandleFunc("GET /api/v1/search", a.handleSearchAPI)
-	mux.HandleFunc("GET /api/v1/activity", a.handleActivityAPI)
+	apiHandler := a.requireAuthentication(a.apiServer)
+	mux.Handle("/api/v1/", apiHandler)
+	mux.Handle("/api/ws", apiHandler)
 
 	mux.HandleFunc("/api/widgets/{widget}/{path...}", a.handleWidgetRequest)
+	mux.HandleFunc("POST /api/widgets/{widget}/refresh", a.handleWidgetRefreshRequest)
+	mux.HandleFunc("GET /api/widgets/{widget}/content", a.handleWidgetContentRequest)
 	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	if a.Config.Metrics.Enabled && a.services.metrics != nil {
+		mux.HandleFunc("GET /metrics", a.handleMetricsRequest)
+	}
+
 	if a.RequiresAuth {
 		mux.HandleFunc("GET /login", a.handleLoginPageRequest)
 		mux.HandleFunc("GET /logout", a.handleLogoutRequest)
 		mux.HandleFunc("POST /api/authenticate", a.handleAuthenticationAttempt)
+
+		if a.StoresSessions() {
+			mux.HandleFunc("GET /sessions", a.handleSessionsPageRequest)
+			mux.HandleFunc("POST /sessions/{id}/revoke", a.handleRevokeSessionRequest)
+			mux.HandleFunc("POST /sessions/revoke-all", a.handleRevokeAllSessionsRequest)
+		}
+
+		if a.Config.Auth.OIDC != nil {
+			mux.HandleFunc("GET /auth/oidc/login", a.handleOIDCLoginRequest)
+			mux.HandleFunc("GET /auth/oidc/callback", a.handleOIDCCallbackRequest)
+		}
 	}
 
 	mux.Handle(
@@ -592,27 +675,49 @@ func (a *application) server() (func() error, func() error) {
 		w.Write(a.parsedManifest)
 	})
 
-	var absAssetsPath string
 	if a.Config.Server.AssetsPath != "" {
-		absAssetsPath, _ = filepath.Abs(a.Config.Server.AssetsPath)
 		assetsFS := fileServerWithCache(http.Dir(a.Config.Server.AssetsPath), 2*time.Hour)
 		mux.Handle("/assets/{path...}", http.StripPrefix("/assets/", assetsFS))
 	}
 
+	return a.recordRequestMetrics(mux)
+}
+
+func (a *application) serverAddress() string {
+	return fmt.Sprintf("%s:%d", a.Config.Server.Host, a.Config.Server.Port)
+}
+
+// The server passes requests to whichever handler is stored at the time they
+// come in, which allows swapping it on config reloads without closing the
+// listener or interrupting requests that are still being handled. The address
+// is bound right away so that a failure to do so can be handled before anything
+// that's currently running gets stopped.
+func newServer(app *application, address string, handler *atomic.Pointer[http.Handler]) (func() error, func() error, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	server := http.Server{
-		Addr:    fmt.Sprintf("%s:%d", a.Config.Server.Host, a.Config.Server.Port),
-		Handler: mux,
+		Addr: address,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			(*handler.Load()).ServeHTTP(w, r)
+		}),
 	}
 
 	start := func() error {
-		log.Printf("Starting server on %s:%d (base-url: \"%s\", assets-path: \"%s\")\n",
-			a.Config.Server.Host,
-			a.Config.Server.Port,
-			a.Config.Server.BaseURL,
+		var absAssetsPath string
+		if app.Config.Server.AssetsPath != "" {
+			absAssetsPath, _ = filepath.Abs(app.Config.Server.AssetsPath)
+		}
+
+		log.Printf("Starting server on %s (base-url: \"%s\", assets-path: \"%s\")\n",
+			address,
+			app.Config.Server.BaseURL,
 			absAssetsPath,
 		)
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			return err
 		}
 
@@ -620,8 +725,12 @@ func (a *application) server() (func() error, func() error) {
 	}
 
 	stop := func() error {
-		return server.Close()
+		err := server.Close()
+		// Closed separately in case the server was stopped before it started serving
+		listener.Close()
+
+		return err
 	}
 
-	return start, stop
+	return start, stop, nil
 }
@@ -0,0 +1,30 @@
+package glance
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+// Widgets that show numeric values worth charting over time implement this
+// so that the values get recorded into the history after every successful update
+type historyRecorder interface {
+	// Names of metrics a widget can record for many things at once are in the
+	// form of metric:subject, such as response_time_ms:Jellyfin
+	historySamples() []database.MetricSample
+}
+
+// Must be called with the widget locked
+func recordWidgetHistory(db *database.DB, widget widget) {
+	recorder, ok := widget.(historyRecorder)
+	if !ok || widget.getError() != nil {
+		return
+	}
+
+	samples := recorder.historySamples()
+	if err := db.History.Record(context.Background(), widget.GetID(), widget.GetType(), samples, time.Now()); err != nil {
+		slog.Error("Failed to record widget history", "widget", widget.GetID(), "error", err)
+	}
+}
@@ -1,12 +1,22 @@
 package glance
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
-
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/glanceapp/glance/internal/api"
+	"github.com/glanceapp/glance/internal/database"
+	"github.com/glanceapp/glance/internal/metrics"
+	"github.com/glanceapp/glance/internal/websocket"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -51,6 +61,12 @@ func Main() int {
 		}
 
 		fmt.Println(string(contents))
+	case cliIntentConfigHistory:
+		return cliConfigHistory(options.configPath)
+	case cliIntentConfigDiff:
+		return cliConfigDiff(options.configPath, options.args[1], options.args[2])
+	case cliIntentConfigRollback:
+		return cliConfigRollback(options.configPath, options.args[1])
 	case cliIntentSensorsPrint:
 		return cliSensorsPrint()
 	case cliIntentMountpointInfo:
@@ -65,6 +81,26 @@ func Main() int {
 		}
 
 		fmt.Println(key)
+	case cliIntentDatabaseStatus:
+		return cliDatabaseStatus(options.configPath)
+	case cliIntentDatabaseMigrate:
+		return cliDatabaseMigrate(options.configPath)
+	case cliIntentDatabaseBackup:
+		return cliDatabaseBackup(options.configPath, options.args[1])
+	case cliIntentDatabaseRestore:
+		return cliDatabaseRestore(options.configPath, options.args[1])
+	case cliIntentDatabaseRollback:
+		return cliDatabaseRollback(options.configPath, options.args[1])
+	case cliIntentNotifyTest:
+		return cliNotifyTest(options.configPath, options.args[1])
+	case cliIntentProfileList:
+		return cliProfileList(options.configPath)
+	case cliIntentProfileSave:
+		return cliProfileSave(options.configPath, options.args[1])
+	case cliIntentProfileActivate:
+		return cliProfileActivate(options.configPath, options.args[1])
+	case cliIntentProfileDeactivate:
+		return cliProfileDeactivate(options.configPath)
 	case cliIntentPasswordHash:
 		password := options.args[1]
 
@@ -97,15 +133,163 @@ func serveApp(configPath string) error {
 	exitChannel := make(chan struct{})
 	hadValidConfigOnStartup := false
 	var stopServer func() error
+	var runningAddress string
+	var currentApp *application
+	var handler atomic.Pointer[http.Handler]
+
+	// The database, websocket hub and widget scheduler are created once for the lifetime
+	// of the process and shared between all instances of the application created on config reloads
+	services := &sharedServices{
+		wsHub:          websocket.NewHub(),
+		scheduler:      newWidgetScheduler(),
+		metrics:        metrics.NewCollector(),
+		apiRateLimiter: api.NewRateLimiter(),
+	}
+	go services.wsHub.Run()
+
+	upstreamMetrics.Store(services.metrics)
+	services.metrics.RegisterGauge("glance_websocket_clients", "Connected WebSocket clients", func() float64 {
+		return float64(services.wsHub.ClientCount())
+	})
+	services.scheduler.start()
+	defer services.scheduler.stop()
+
+	// Switches over to serving the given application, the listener is only
+	// restarted when the address it should listen on has changed
+	activate := func(app *application) {
+		appHandler := app.handler()
+		handler.Store(&appHandler)
+		app.scheduleWidgets()
+		if services.maintenance != nil {
+			services.maintenance.configure(app)
+		}
+		if services.alerts != nil {
+			services.alerts.configure(app)
+		}
+		currentApp = app
+
+		if stopServer != nil && app.serverAddress() == runningAddress {
+			log.Println("Config reloaded")
+			return
+		}
+
+		// The new address is bound before the old one is closed so that a
+		// failure to bind to it leaves the server running where it was
+		address := app.serverAddress()
+		startServer, stopNewServer, err := newServer(app, address, &handler)
+		if err != nil && stopServer != nil && sameServerPort(address, runningAddress) {
+			// Another host on the same port can't be bound while the old listener is on
+			// all interfaces, so in that case the old one has to be closed first instead
+			if err := stopServer(); err != nil {
+				log.Printf("Error while trying to stop server: %v", err)
+			}
+			stopServer = nil
+
+			startServer, stopNewServer, err = newServer(app, address, &handler)
+			if err != nil {
+				log.Printf("Failed to listen on %s, going back to %s: %v", address, runningAddress, err)
+				address = runningAddress
+				startServer, stopNewServer, err = newServer(app, address, &handler)
+			}
+		}
+
+		if err != nil {
+			if stopServer != nil {
+				log.Printf("Failed to listen on %s, still serving on %s: %v", address, runningAddress, err)
+			} else {
+				log.Printf("Failed to start server: %v", err)
+			}
+			return
+		}
 
-	onChange := func(newContents []byte) {
 		if stopServer != nil {
-			log.Println("Config file changed, reloading...")
+			if err := stopServer(); err != nil {
+				log.Printf("Error while trying to stop server: %v", err)
+			}
 		}
 
+		stopServer = stopNewServer
+		runningAddress = address
+
+		go func() {
+			if err := startServer(); err != nil {
+				log.Printf("Failed to start server: %v", err)
+			}
+		}()
+	}
+
+	var dbPath string
+	defer func() {
+		if services.maintenance != nil {
+			services.maintenance.stop()
+		}
+
+		if services.db != nil {
+			services.db.Close()
+		}
+	}()
+
+	prepareDatabase := func(config *config) error {
+		if !config.Database.Enabled {
+			if services.db != nil {
+				log.Println("Disabling the database requires a restart, it will remain open until then")
+			}
+
+			return nil
+		}
+
+		path := resolveDatabasePath(configPath, config.Database.Path)
+		if services.db != nil {
+			if path != dbPath {
+				log.Printf("Changing the database path requires a restart, still using %s", dbPath)
+			}
+
+			return nil
+		}
+
+		db, err := openDatabase(path, time.Duration(config.Database.Retention))
+		if err != nil {
+			return err
+		}
+		services.db = db
+		services.maintenance = newDatabaseMaintenance(db)
+		services.alerts = newAlertManager(db)
+		dbPath = path
+
+		return nil
+	}
+
+	recordConfigError := func(err error) {
+		recordActivity(services.db, activityEvent{
+			Type:    activityConfigError,
+			Level:   activityLevelError,
+			Message: err.Error(),
+		})
+	}
+
+	// Config changes and profiles being switched through the API both reload the config
+	var reloadMu sync.Mutex
+	var lastContents []byte
+
+	// Must be called with reloadMu held
+	load := func(newContents []byte) {
+		lastContents = newContents
+		reloading := stopServer != nil
+
 		config, err := newConfigFromYAML(newContents)
 		if err != nil {
 			log.Printf("Config has errors: %v", err)
+			recordConfigError(err)
+
+			if !hadValidConfigOnStartup {
+				close(exitChannel)
+			}
+
+			return
+		}
+
+		if err := prepareDatabase(config); err != nil {
+			log.Printf("Failed to open database: %v", err)
 
 			if !hadValidConfigOnStartup {
 				close(exitChannel)
@@ -113,10 +297,12 @@ func serveApp(configPath string) error {
 
 			return
 		}
+		config = applyActiveProfile(services.db, config)
 
-		app, err := newApplication(config)
+		app, err := newApplication(config, services, currentApp)
 		if err != nil {
 			log.Printf("Failed to create application: %v", err)
+			recordConfigError(err)
 
 			if !hadValidConfigOnStartup {
 				close(exitChannel)
@@ -129,20 +315,33 @@ func serveApp(configPath string) error {
 			hadValidConfigOnStartup = true
 		}
 
+		activate(app)
+		recordConfigVersion(services.db, configPath, newContents, config.Database.ConfigVersions)
+
+		if reloading {
+			recordActivity(services.db, activityEvent{
+				Type:    activityConfigReloaded,
+				Message: "Config reloaded",
+			})
+		}
+	}
+
+	onChange := func(newContents []byte) {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
 		if stopServer != nil {
-			if err := stopServer(); err != nil {
-				log.Printf("Error while trying to stop server: %v", err)
-			}
+			log.Println("Config file changed, reloading...")
 		}
 
-		go func() {
-			var startServer func() error
-			startServer, stopServer = app.server()
+		load(newContents)
+	}
 
-			if err := startServer(); err != nil {
-				log.Printf("Failed to start server: %v", err)
-			}
-		}()
+	services.reloadConfig = func() {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		load(lastContents)
 	}
 
 	onErr := func(err error) {
@@ -165,12 +364,34 @@ func serveApp(configPath string) error {
 			return fmt.Errorf("validating config file: %w", err)
 		}
 
-		app, err := newApplication(config)
+		if err := prepareDatabase(config); err != nil {
+			return fmt.Errorf("opening database: %w", err)
+		}
+		config = applyActiveProfile(services.db, config)
+		// Nothing is reloaded without the watcher so there's nothing to reload into
+		services.reloadConfig = nil
+
+		app, err := newApplication(config, services, nil)
 		if err != nil {
 			return fmt.Errorf("creating application: %w", err)
 		}
 
-		startServer, _ := app.server()
+		appHandler := app.handler()
+		handler.Store(&appHandler)
+		app.scheduleWidgets()
+		if services.maintenance != nil {
+			services.maintenance.configure(app)
+		}
+		if services.alerts != nil {
+			services.alerts.configure(app)
+		}
+		recordConfigVersion(services.db, configPath, configContents, config.Database.ConfigVersions)
+
+		startServer, _, err := newServer(app, app.serverAddress(), &handler)
+		if err != nil {
+			return fmt.Errorf("starting server: %w", err)
+		}
+
 		if err := startServer(); err != nil {
 			return fmt.Errorf("starting server: %w", err)
 		}
@@ -180,6 +401,56 @@ func serveApp(configPath string) error {
 	return nil
 }
 
+func sameServerPort(a, b string) bool {
+	_, portA, _ := net.SplitHostPort(a)
+	_, portB, _ := net.SplitHostPort(b)
+
+	return portA == portB
+}
+
+// Relative database paths are resolved against the directory of the main config
+// file so that the database ends up next to glance.yml, which in the case of
+// Docker is the directory that's already mounted as a volume
+func resolveDatabasePath(configPath, databasePath string) string {
+	if filepath.IsAbs(databasePath) {
+		return databasePath
+	}
+
+	return filepath.Join(filepath.Dir(configPath), databasePath)
+}
+
+func openDatabase(path string, retention time.Duration) (*database.DB, error) {
+	db, err := database.New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Done right away rather than by the maintenance job since
+	// snapshots get restored as soon as the application is created
+	if _, err := db.Snapshots.DeleteOlderThan(context.Background(), time.Now().Add(-retention)); err != nil {
+		log.Printf("Failed to clean up old widget snapshots: %v", err)
+	}
+
+	// Maintenance only vacuums incrementally, the full vacuum needed to switch older
+	// databases over to that is done here since it locks the database until it's done
+	if enabled, err := db.IncrementalVacuumEnabled(); err != nil {
+		log.Printf("Failed to check the vacuum mode of the database: %v", err)
+	} else if !enabled {
+		log.Println("Switching the database to incremental vacuuming, this only happens once but can take a while for large databases...")
+		started := time.Now()
+
+		if err := db.EnableIncrementalVacuum(); err != nil {
+			log.Printf("Failed to switch the database to incremental vacuuming: %v", err)
+		} else {
+			log.Printf("Switched the database to incremental vacuuming in %s", time.Since(started).Round(time.Millisecond))
+		}
+	}
+
+	log.Printf("Using database at %s", path)
+
+	return db, nil
+}
+
 func serveUpdateNoticeIfConfigLocationNotMigrated(configPath string) bool {
 	if !isRunningInsideDockerContainer() {
 		return false
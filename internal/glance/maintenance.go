@@ -0,0 +1,167 @@
+package glance
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+// History gets rolled up on every tick, the rest of the tasks run once
+// their own interval has passed so this is also the smallest one they can have
+const maintenanceTickInterval = 5 * time.Minute
+
+type maintenanceSettings struct {
+	retention        time.Duration
+	historyRetention database.HistoryRetention
+	interval         time.Duration
+	vacuumInterval   time.Duration
+	// IDs of the widgets in the current config, the data of any other widget is orphaned
+	widgetIDs []string
+}
+
+// Keeps the database from growing forever by rolling up history, deleting
+// whatever is past its retention and vacuuming the space that frees up
+type databaseMaintenance struct {
+	db        *database.DB
+	settings  atomic.Pointer[maintenanceSettings]
+	startOnce sync.Once
+	// Canceled when stopping so that a task which is running doesn't hold up the shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newDatabaseMaintenance(db *database.DB) *databaseMaintenance {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &databaseMaintenance{
+		db:     db,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Applies the settings of the application, which are read on every tick so that
+// changes apply on config reloads. Maintenance starts once it's first configured
+// since until then it's not known which widgets exist.
+func (m *databaseMaintenance) configure(app *application) {
+	widgetIDs := make([]string, 0, len(app.widgetByID))
+	for id := range app.widgetByID {
+		widgetIDs = append(widgetIDs, id)
+	}
+
+	c := &app.Config.Database
+	m.settings.Store(&maintenanceSettings{
+		retention: time.Duration(c.Retention),
+		historyRetention: database.HistoryRetention{
+			Raw:        time.Duration(c.History.RawRetention),
+			FiveMinute: time.Duration(c.History.FiveMinuteRetention),
+			Hourly:     time.Duration(c.History.HourlyRetention),
+		},
+		interval:       time.Duration(c.Maintenance.Interval),
+		vacuumInterval: time.Duration(c.Maintenance.VacuumInterval),
+		widgetIDs:      widgetIDs,
+	})
+
+	m.startOnce.Do(func() { go m.run() })
+}
+
+func (m *databaseMaintenance) stop() {
+	m.cancel()
+}
+
+func (m *databaseMaintenance) run() {
+	ticker := time.NewTicker(maintenanceTickInterval)
+	defer ticker.Stop()
+
+	var lastRetention time.Time
+	// Vacuuming can take a while on large databases so it's
+	// better not to do it right as Glance is starting
+	lastVacuum := time.Now()
+
+	ctx := m.ctx
+
+	tick := func() {
+		settings := m.settings.Load()
+		now := time.Now()
+
+		if err := m.db.History.Rollup(ctx, now); err != nil {
+			slog.Error("Failed to roll up history", "error", err)
+		}
+
+		if now.Sub(lastRetention) >= settings.interval {
+			lastRetention = now
+			m.enforceRetention(ctx, settings, now)
+		}
+
+		if now.Sub(lastVacuum) >= settings.vacuumInterval {
+			lastVacuum = now
+			m.vacuum()
+		}
+	}
+
+	tick()
+
+	for {
+		select {
+		case <-ticker.C:
+			tick()
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *databaseMaintenance) enforceRetention(ctx context.Context, settings *maintenanceSettings, now time.Time) {
+	cutoff := now.Add(-settings.retention)
+
+	tasks := []struct {
+		name   string
+		delete func() (int64, error)
+	}{
+		{"history", func() (int64, error) {
+			return m.db.History.DeleteOlderThanRetention(ctx, settings.historyRetention, now)
+		}},
+		{"activity", func() (int64, error) { return m.db.Activity.DeleteOlderThan(ctx, cutoff) }},
+		{"widget_snapshots", func() (int64, error) { return m.db.Snapshots.DeleteOlderThan(ctx, cutoff) }},
+		{"widget_data", func() (int64, error) { return m.db.WidgetData.DeleteOrphaned(ctx, settings.widgetIDs, cutoff) }},
+		{"sessions", func() (int64, error) { return m.db.Sessions.DeleteExpired(ctx, now) }},
+	}
+
+	removed := make([]any, 0, len(tasks)*2)
+	var total int64
+
+	for _, task := range tasks {
+		deleted, err := task.delete()
+		if err != nil {
+			slog.Error("Failed to delete old data", "kind", task.name, "error", err)
+			continue
+		}
+
+		total += deleted
+		removed = append(removed, task.name, deleted)
+	}
+
+	if total > 0 {
+		slog.Info("Removed data past its retention from the database", removed...)
+	}
+}
+
+func (m *databaseMaintenance) vacuum() {
+	started := time.Now()
+
+	if err := m.db.Optimize(); err != nil {
+		slog.Error("Failed to optimize database", "error", err)
+	}
+
+	freed, err := m.db.Vacuum()
+	if err != nil {
+		slog.Error("Failed to vacuum database", "error", err)
+		return
+	}
+
+	slog.Info("Vacuumed database", "freed_bytes", freed, "took", time.Since(started).Round(time.Millisecond))
+}
@@ -0,0 +1,176 @@
+package glance
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/glanceapp/glance/internal/metrics"
+)
+
+// Requests made to other services go through the shared HTTP clients which
+// outlive any single application, so they record into whichever collector
+// the running process stored here
+var upstreamMetrics atomic.Pointer[metrics.Collector]
+
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func newInstrumentedTransport(next http.RoundTripper) http.RoundTripper {
+	return &instrumentedTransport{next: next}
+}
+
+func (t *instrumentedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	started := time.Now()
+	response, err := t.next.RoundTrip(request)
+
+	if collector := upstreamMetrics.Load(); collector != nil {
+		status := 0
+		if err == nil {
+			status = response.StatusCode
+		}
+
+		collector.RecordUpstreamRequest(request.URL.Host, request.Method, status, time.Since(started))
+	}
+
+	return response, err
+}
+
+// Groups the errors widget updates fail with so that it's possible to tell
+// apart an upstream that's slow from one that's down or one that changed its API
+func classifyUpdateError(err error) string {
+	var statusErr *httpStatusError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var opErr *net.OpError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var jsonSyntaxErr *json.SyntaxError
+	var jsonTypeErr *json.UnmarshalTypeError
+	var xmlSyntaxErr *xml.SyntaxError
+
+	switch {
+	case errors.As(err, &statusErr):
+		if statusErr.statusCode >= 500 {
+			return "http_5xx"
+		}
+		return "http_4xx"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthorityErr):
+		return "tls"
+	case errors.As(err, &opErr):
+		return "connection"
+	case errors.As(err, &jsonSyntaxErr), errors.As(err, &jsonTypeErr), errors.As(err, &xmlSyntaxErr):
+		return "decode"
+	case errors.Is(err, errNoContent):
+		return "no_content"
+	}
+
+	return "other"
+}
+
+// Prometheus can't log in, so the metrics endpoint is protected by its own
+// token rather than by the authentication used for pages
+// Scrapers authenticate with the token, while anyone that's logged in can also see the metrics
+// since they're only as public as the dashboard is when no token is set
+func (a *application) isAuthorizedForMetrics(w http.ResponseWriter, r *http.Request) bool {
+	token := a.Config.Metrics.Token
+
+	if token != "" {
+		provided, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if found && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	if token == "" || a.RequiresAuth {
+		return a.isAuthorized(w, r)
+	}
+
+	return false
+}
+
+func (a *application) handleMetricsRequest(w http.ResponseWriter, r *http.Request) {
+	if !a.isAuthorizedForMetrics(w, r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.OpenMetricsContentType)
+	if err := a.services.metrics.WriteOpenMetrics(w); err != nil {
+		slog.Error("Failed to write metrics", "error", err)
+	}
+}
+
+func (a *application) recordRequestMetrics(next http.Handler) http.Handler {
+	collector := a.services.metrics
+	if collector == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// The mux sets the pattern that matched the request
+		collector.RecordRequest(r.Pattern, r.Method, recorder.status, time.Since(started))
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Needed for upgrading WebSocket connections
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
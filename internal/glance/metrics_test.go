@@ -0,0 +1,95 @@
+package glance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glanceapp/glance/internal/database"
+	"github.com/glanceapp/glance/internal/metrics"
+	"github.com/glanceapp/glance/internal/websocket"
+)
+
+func TestMetricsRequireAuthentication(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	secret, _ := makeAuthSecretKey(AUTH_SECRET_KEY_LENGTH)
+	services := &sharedServices{db: db, wsHub: websocket.NewHub(), scheduler: newWidgetScheduler(), metrics: metrics.NewCollector()}
+
+	newHandler := func(token string) http.Handler {
+		t.Helper()
+		config, err := newConfigFromYAML([]byte(`
+auth:
+  secret-key: ` + secret + `
+  users:
+    admin:
+      password: hunter22
+metrics:
+  enabled: true
+  token: "` + token + `"
+database:
+  enabled: true
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: hello
+`))
+		if err != nil {
+			t.Fatalf("Failed to parse config: %v", err)
+		}
+
+		app, err := newApplication(config, services, nil)
+		if err != nil {
+			t.Fatalf("Failed to create application: %v", err)
+		}
+
+		return app.handler()
+	}
+
+	scrape := func(handler http.Handler, authorization string, cookie *http.Cookie) int {
+		request := httptest.NewRequest("GET", "/metrics", nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	handler := newHandler("")
+	if code := scrape(handler, "", nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected metrics not to be public when authentication is set up, got %d", code)
+	}
+
+	login := httptest.NewRequest("POST", "/api/authenticate", strings.NewReader(`{"username":"admin","password":"hunter22"}`))
+	login.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, login)
+	cookie := recorder.Result().Cookies()[0]
+
+	if code := scrape(handler, "", cookie); code != http.StatusOK {
+		t.Errorf("Expected logged in users to see the metrics, got %d", code)
+	}
+
+	handler = newHandler("scrape-token")
+	if code := scrape(handler, "Bearer scrape-token", nil); code != http.StatusOK {
+		t.Errorf("Expected the token to be accepted, got %d", code)
+	}
+
+	if code := scrape(handler, "Bearer wrong", nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong token to be rejected, got %d", code)
+	}
+}
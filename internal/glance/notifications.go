@@ -0,0 +1,634 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/glanceapp/glance/internal/api"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	notificationChannelWebhook = "webhook"
+	notificationChannelNtfy    = "ntfy"
+	notificationChannelGotify  = "gotify"
+	notificationChannelDiscord = "discord"
+	notificationChannelSlack   = "slack"
+	notificationChannelEmail   = "email"
+)
+
+const (
+	emailSecurityNone     = "none"
+	emailSecuritySTARTTLS = "starttls"
+	emailSecurityTLS      = "tls"
+)
+
+// How long a single attempt at sending a notification can take, email being the slowest
+const notificationAttemptTimeout = 15 * time.Second
+
+// Doubles after every failed attempt, a variable so that tests don't have to wait
+var notificationRetryDelay = 2 * time.Second
+
+var errNotificationRateLimited = errors.New("too many notifications sent through the channel, try again later")
+
+// What gets sent through a channel when an alert fires or resolves
+type notification struct {
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+	Resolved bool      `json:"resolved"`
+	Alert    string    `json:"alert"`
+	Subject  string    `json:"subject"`
+	WidgetID string    `json:"widget"`
+	Time     time.Time `json:"time"`
+}
+
+type notifier interface {
+	send(ctx context.Context, n *notification) error
+}
+
+// A named channel from the notifications section of the config, which can either
+// be an object with a type or an Apprise style URL such as ntfys://ntfy.sh/topic
+type notificationChannel struct {
+	Type          string `yaml:"type"`
+	URL           string `yaml:"url"`
+	AllowInsecure bool   `yaml:"allow-insecure"`
+	Token         string `yaml:"token"`
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+	// ntfy and gotify
+	Topic    string `yaml:"topic"`
+	Priority string `yaml:"priority"`
+	// webhook
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	// email
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Security string   `yaml:"security"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	// How many more times sending is attempted after it fails
+	Retries *int `yaml:"retries"`
+	// The maximum number of notifications sent through the channel per minute, 0 for no limit
+	RateLimit *int `yaml:"rate-limit"`
+
+	name     string
+	notifier notifier
+	limiter  *api.TokenBucket
+}
+
+func (c *notificationChannel) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		parsed, err := parseNotificationURL(node.Value)
+		if err != nil {
+			return err
+		}
+
+		*c = *parsed
+		return nil
+	}
+
+	type alias notificationChannel
+	return node.Decode((*alias)(c))
+}
+
+// Converts an Apprise style URL into the equivalent channel, supporting the schemes of
+// the services that Glance can send notifications to along with json:// for webhooks
+func parseNotificationURL(raw string) (*notificationChannel, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid notification URL %s", raw)
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	// Secure variants of the schemes end with an s, such as ntfys or mailtos
+	secure := strings.HasSuffix(scheme, "s")
+	httpScheme := ternary(secure, "https", "http")
+	query := parsed.Query()
+	path := strings.Trim(parsed.Path, "/")
+	segments := strings.Split(path, "/")
+
+	channel := &notificationChannel{
+		Username: parsed.User.Username(),
+		Priority: query.Get("priority"),
+	}
+	channel.Password, _ = parsed.User.Password()
+
+	switch scheme {
+	case "json", "jsons":
+		channel.Type = notificationChannelWebhook
+		channel.URL = (&url.URL{Scheme: httpScheme, Host: parsed.Host, Path: parsed.Path, RawQuery: parsed.RawQuery}).String()
+	case "ntfy", "ntfys":
+		channel.Type = notificationChannelNtfy
+		channel.Token = query.Get("token")
+
+		if path == "" {
+			// ntfy://topic uses the public instance
+			channel.URL = "https://ntfy.sh"
+			channel.Topic = parsed.Host
+		} else {
+			channel.URL = httpScheme + "://" + parsed.Host
+			channel.Topic = path
+		}
+	case "gotify", "gotifys":
+		channel.Type = notificationChannelGotify
+		channel.Token = segments[len(segments)-1]
+		channel.URL = httpScheme + "://" + parsed.Host
+		if len(segments) > 1 {
+			channel.URL += "/" + strings.Join(segments[:len(segments)-1], "/")
+		}
+	case "discord":
+		if len(segments) != 1 || path == "" {
+			return nil, errors.New("discord URLs must be in the format of discord://webhook_id/webhook_token")
+		}
+
+		channel.Type = notificationChannelDiscord
+		channel.URL = "https://discord.com/api/webhooks/" + parsed.Host + "/" + path
+	case "slack":
+		if len(segments) != 2 {
+			return nil, errors.New("slack URLs must be in the format of slack://TokenA/TokenB/TokenC")
+		}
+
+		channel.Type = notificationChannelSlack
+		channel.URL = "https://hooks.slack.com/services/" + parsed.Host + "/" + path
+	case "mailto", "mailtos":
+		channel.Type = notificationChannelEmail
+		channel.Host = parsed.Hostname()
+		channel.Security = ternary(secure, emailSecurityTLS, emailSecuritySTARTTLS)
+		channel.From = query.Get("from")
+
+		if port := parsed.Port(); port != "" {
+			channel.Port, err = strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port in notification URL %s", raw)
+			}
+		}
+
+		if channel.From == "" && strings.Contains(channel.Username, "@") {
+			channel.From = channel.Username
+		}
+
+		for _, to := range strings.Split(query.Get("to"), ",") {
+			if to = strings.TrimSpace(to); to != "" {
+				channel.To = append(channel.To, to)
+			}
+		}
+
+		if len(channel.To) == 0 && channel.From != "" {
+			channel.To = []string{channel.From}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported notification URL scheme %s", parsed.Scheme)
+	}
+
+	return channel, nil
+}
+
+func initializeNotificationChannels(config *config) error {
+	for name, channel := range config.Notifications {
+		if channel == nil {
+			return fmt.Errorf("notification channel %s is empty", name)
+		}
+
+		if err := channel.initialize(name); err != nil {
+			return fmt.Errorf("notification channel %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *notificationChannel) initialize(name string) error {
+	c.name = name
+
+	if c.Retries == nil {
+		retries := 3
+		c.Retries = &retries
+	} else if *c.Retries < 0 || *c.Retries > 10 {
+		return errors.New("retries must be between 0 and 10")
+	}
+
+	if c.RateLimit == nil {
+		rateLimit := 10
+		c.RateLimit = &rateLimit
+	} else if *c.RateLimit < 0 {
+		return errors.New("rate-limit cannot be negative")
+	}
+
+	if *c.RateLimit > 0 {
+		c.limiter = api.NewTokenBucket(float64(*c.RateLimit), float64(*c.RateLimit)/60)
+	}
+
+	client := ternary(c.AllowInsecure, defaultInsecureHTTPClient, defaultHTTPClient)
+
+	requireURL := func() error {
+		if c.URL == "" {
+			return errors.New("url is required")
+		}
+
+		if _, err := url.ParseRequestURI(c.URL); err != nil {
+			return fmt.Errorf("invalid url: %v", err)
+		}
+
+		return nil
+	}
+
+	switch c.Type {
+	case notificationChannelWebhook:
+		if err := requireURL(); err != nil {
+			return err
+		}
+
+		c.Method = ternary(c.Method == "", http.MethodPost, strings.ToUpper(c.Method))
+		webhook := &webhookNotifier{client: client, method: c.Method, url: c.URL, headers: c.Headers, encode: encodeNotificationJSON}
+
+		if c.Body != "" {
+			body, err := template.New("").Funcs(notificationTemplateFuncs).Parse(c.Body)
+			if err != nil {
+				return fmt.Errorf("parsing body template: %v", err)
+			}
+
+			webhook.encode = func(n *notification) ([]byte, error) {
+				var buffer bytes.Buffer
+				err := body.Execute(&buffer, n)
+				return buffer.Bytes(), err
+			}
+		}
+
+		c.notifier = webhook
+	case notificationChannelNtfy:
+		if c.URL == "" {
+			c.URL = "https://ntfy.sh"
+		}
+
+		if err := requireURL(); err != nil {
+			return err
+		}
+
+		if c.Topic == "" {
+			return errors.New("topic is required")
+		}
+
+		if c.Priority != "" && !slices.Contains([]string{"1", "2", "3", "4", "5", "min", "low", "default", "high", "max", "urgent"}, c.Priority) {
+			return errors.New("priority must be one of min, low, default, high or max")
+		}
+
+		c.notifier = &ntfyNotifier{client: client, channel: c}
+	case notificationChannelGotify:
+		if err := requireURL(); err != nil {
+			return err
+		}
+
+		if c.Token == "" {
+			return errors.New("token is required")
+		}
+
+		priority := 5
+		if c.Priority != "" {
+			var err error
+			if priority, err = strconv.Atoi(c.Priority); err != nil || priority < 0 || priority > 10 {
+				return errors.New("priority must be a number between 0 and 10")
+			}
+		}
+
+		c.notifier = &gotifyNotifier{client: client, channel: c, priority: priority}
+	case notificationChannelDiscord, notificationChannelSlack:
+		if err := requireURL(); err != nil {
+			return err
+		}
+
+		c.notifier = &webhookNotifier{
+			client: client,
+			method: http.MethodPost,
+			url:    c.URL,
+			encode: ternary(c.Type == notificationChannelDiscord, encodeDiscordNotification, encodeSlackNotification),
+		}
+	case notificationChannelEmail:
+		if c.Host == "" {
+			return errors.New("host is required")
+		}
+
+		if c.From == "" {
+			return errors.New("from is required")
+		}
+
+		if len(c.To) == 0 {
+			return errors.New("to is required")
+		}
+
+		if c.Security == "" {
+			c.Security = emailSecuritySTARTTLS
+		}
+
+		switch c.Security {
+		case emailSecurityNone:
+			c.Port = ternary(c.Port == 0, 25, c.Port)
+		case emailSecuritySTARTTLS:
+			c.Port = ternary(c.Port == 0, 587, c.Port)
+		case emailSecurityTLS:
+			c.Port = ternary(c.Port == 0, 465, c.Port)
+		default:
+			return errors.New("security must be one of none, starttls or tls")
+		}
+
+		c.notifier = &emailNotifier{channel: c}
+	case "":
+		return errors.New("type is required")
+	default:
+		return fmt.Errorf("unknown type %s, must be one of webhook, ntfy, gotify, discord, slack or email", c.Type)
+	}
+
+	return nil
+}
+
+// Attempts to send the notification up to as many times as the channel allows, waiting longer
+// after every failure, unless the service responds in a way that retrying wouldn't fix
+func (c *notificationChannel) send(ctx context.Context, n *notification) error {
+	if c.limiter != nil && !c.limiter.Allow(1) {
+		return errNotificationRateLimited
+	}
+
+	delay := notificationRetryDelay
+	attempts := 0
+
+	for {
+		attempts++
+		attemptCtx, cancel := context.WithTimeout(ctx, notificationAttemptTimeout)
+		err := c.notifier.send(attemptCtx, n)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+
+		if attempts > *c.Retries || !isRetryableNotificationError(err) {
+			if attempts > 1 {
+				return fmt.Errorf("%w (after %d attempts)", err, attempts)
+			}
+
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Client errors other than timeouts and rate limits mean that the request itself is wrong
+func isRetryableNotificationError(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		code := statusErr.statusCode
+		return code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+	}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code < 500
+	}
+
+	return true
+}
+
+var notificationTemplateFuncs = template.FuncMap{
+	// Encodes a value as JSON, so that strings can be safely placed within JSON bodies
+	"json": func(value any) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+func newNotificationRequest(ctx context.Context, method, url string, body []byte) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("User-Agent", glanceUserAgentString)
+	return request, nil
+}
+
+func sendNotificationRequest(client requestDoer, request *http.Request) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		truncatedBody, _ := limitStringLength(string(body), 256)
+
+		return &httpStatusError{response.StatusCode, request.URL.Redacted(), truncatedBody}
+	}
+
+	return nil
+}
+
+type webhookNotifier struct {
+	client  requestDoer
+	method  string
+	url     string
+	headers map[string]string
+	encode  func(*notification) ([]byte, error)
+}
+
+func (w *webhookNotifier) send(ctx context.Context, n *notification) error {
+	body, err := w.encode(n)
+	if err != nil {
+		return fmt.Errorf("creating body: %v", err)
+	}
+
+	request, err := newNotificationRequest(ctx, w.method, w.url, body)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range w.headers {
+		request.Header.Set(key, value)
+	}
+
+	return sendNotificationRequest(w.client, request)
+}
+
+func encodeNotificationJSON(n *notification) ([]byte, error) {
+	return json.Marshal(n)
+}
+
+func encodeDiscordNotification(n *notification) ([]byte, error) {
+	return json.Marshal(map[string]string{"content": "**" + n.Title + "**\n" + n.Message})
+}
+
+func encodeSlackNotification(n *notification) ([]byte, error) {
+	return json.Marshal(map[string]string{"text": "*" + n.Title + "*\n" + n.Message})
+}
+
+type ntfyNotifier struct {
+	client  requestDoer
+	channel *notificationChannel
+}
+
+func (w *ntfyNotifier) send(ctx context.Context, n *notification) error {
+	c := w.channel
+	request, err := newNotificationRequest(ctx, http.MethodPost, strings.TrimRight(c.URL, "/")+"/"+c.Topic, []byte(n.Message))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Title", mime.QEncoding.Encode("utf-8", n.Title))
+	request.Header.Set("Tags", ternary(n.Resolved, "white_check_mark", "warning"))
+	if c.Priority != "" {
+		request.Header.Set("Priority", c.Priority)
+	}
+
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Username != "" {
+		request.SetBasicAuth(c.Username, c.Password)
+	}
+
+	return sendNotificationRequest(w.client, request)
+}
+
+type gotifyNotifier struct {
+	client   requestDoer
+	channel  *notificationChannel
+	priority int
+}
+
+func (w *gotifyNotifier) send(ctx context.Context, n *notification) error {
+	body, err := json.Marshal(map[string]any{
+		"title":    n.Title,
+		"message":  n.Message,
+		"priority": w.priority,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := newNotificationRequest(ctx, http.MethodPost, strings.TrimRight(w.channel.URL, "/")+"/message", body)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Gotify-Key", w.channel.Token)
+
+	return sendNotificationRequest(w.client, request)
+}
+
+type emailNotifier struct {
+	channel *notificationChannel
+}
+
+func (w *emailNotifier) send(ctx context.Context, n *notification) error {
+	c := w.channel
+	tlsConfig := &tls.Config{ServerName: c.Host, InsecureSkipVerify: c.AllowInsecure}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.Host, strconv.Itoa(c.Port)))
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if c.Security == emailSecurityTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if c.Security == emailSecuritySTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("server doesn't support STARTTLS, set security to none to send emails unencrypted")
+		}
+
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(c.From); err != nil {
+		return err
+	}
+
+	for _, to := range c.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(w.message(n)); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (w *emailNotifier) message(n *notification) []byte {
+	var message bytes.Buffer
+
+	headers := [][2]string{
+		{"From", w.channel.From},
+		{"To", strings.Join(w.channel.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", n.Title)},
+		{"Date", n.Time.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+	}
+
+	for _, header := range headers {
+		message.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(n.Message, "\n", "\r\n"))
+	message.WriteString("\r\n")
+
+	return message.Bytes()
+}
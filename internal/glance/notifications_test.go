@@ -0,0 +1,121 @@
+package glance
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestNotificationURLsAreParsedIntoChannels(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected notificationChannel
+	}{
+		{"ntfy://alerts", notificationChannel{Type: "ntfy", URL: "https://ntfy.sh", Topic: "alerts"}},
+		{"ntfys://ntfy.example.com/alerts?priority=high&token=tk", notificationChannel{Type: "ntfy", URL: "https://ntfy.example.com", Topic: "alerts", Priority: "high", Token: "tk"}},
+		{"gotify://gotify.local:8080/sub/apptoken", notificationChannel{Type: "gotify", URL: "http://gotify.local:8080/sub", Token: "apptoken"}},
+		{"discord://123/abc", notificationChannel{Type: "discord", URL: "https://discord.com/api/webhooks/123/abc"}},
+		{"slack://A/B/C", notificationChannel{Type: "slack", URL: "https://hooks.slack.com/services/A/B/C"}},
+		{"jsons://hooks.example.com/glance?key=1", notificationChannel{Type: "webhook", URL: "https://hooks.example.com/glance?key=1"}},
+		{"mailtos://me@example.com:secret@smtp.example.com", notificationChannel{
+			Type: "email", Host: "smtp.example.com", Security: "tls", Username: "me@example.com", Password: "secret", From: "me@example.com", To: []string{"me@example.com"},
+		}},
+	}
+
+	for _, test := range tests {
+		channel, err := parseNotificationURL(test.url)
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", test.url, err)
+			continue
+		}
+
+		got, _ := yaml.Marshal(channel)
+		expected, _ := yaml.Marshal(&test.expected)
+		if string(got) != string(expected) {
+			t.Errorf("Unexpected channel for %s:\n%s\nexpected:\n%s", test.url, got, expected)
+		}
+	}
+
+	if _, err := parseNotificationURL("pushover://user/token"); err == nil {
+		t.Error("Expected unsupported schemes to be rejected")
+	}
+}
+
+func TestWebhookNotificationsAreRetried(t *testing.T) {
+	notificationRetryDelay = time.Millisecond
+	defer func() { notificationRetryDelay = 2 * time.Second }()
+
+	var requests atomic.Int32
+	var lastBody atomic.Value
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/invalid" {
+			requests.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		lastBody.Store(string(body))
+	}))
+	defer server.Close()
+
+	var config struct {
+		Notifications map[string]*notificationChannel `yaml:"notifications"`
+	}
+
+	err := yaml.Unmarshal([]byte(`
+notifications:
+  hook:
+    type: webhook
+    url: `+server.URL+`/hook
+    body: '{"text": {{ .Message | json }}}'
+  invalid:
+    type: webhook
+    url: `+server.URL+`/invalid
+`), &config)
+	if err != nil {
+		t.Fatalf("Failed to parse channels: %v", err)
+	}
+
+	for name, channel := range config.Notifications {
+		if err := channel.initialize(name); err != nil {
+			t.Fatalf("Failed to initialize channel %s: %v", name, err)
+		}
+	}
+
+	n := &notification{Title: "Alert: disk", Message: `Disk usage of "nas:/" is 95%`}
+
+	if err := config.Notifications["hook"].send(t.Context(), n); err != nil {
+		t.Fatalf("Expected notification to be sent after retrying, got %v", err)
+	}
+
+	if count := requests.Load(); count != 3 {
+		t.Errorf("Expected 3 attempts, got %d", count)
+	}
+
+	if body := lastBody.Load(); body != `{"text": "Disk usage of \"nas:/\" is 95%"}` {
+		t.Errorf("Unexpected body %v", body)
+	}
+
+	requests.Store(0)
+	err = config.Notifications["invalid"].send(t.Context(), n)
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("Expected the status code to be returned, got %v", err)
+	}
+
+	if count := requests.Load(); count != 1 {
+		t.Errorf("Expected client errors not to be retried, got %d attempts", count)
+	}
+}
@@ -0,0 +1,813 @@
+package glance
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long someone has to finish logging in at the provider
+const oidcLoginTimeout = 10 * time.Minute
+const oidcLoginCookieName = "oidc_login"
+const oidcMetadataCacheDuration = time.Hour
+
+// Keys are fetched again when a token is signed with one that isn't known, but not more often than this
+const oidcKeysRefetchInterval = time.Minute
+const oidcClockSkew = time.Minute
+
+// Users of the provider are stored in sessions by their subject with this in front of it, so that
+// they can't be mistaken for a local user with the same name
+const oidcSessionUserIDPrefix = "oidc:"
+
+var errOIDCUserNotAllowed = errors.New("user is not in any of the allowed groups")
+
+type oidcProvider struct {
+	Name          string   `yaml:"name"`
+	Issuer        string   `yaml:"issuer"`
+	ClientID      string   `yaml:"client-id"`
+	ClientSecret  string   `yaml:"client-secret"`
+	RedirectURL   string   `yaml:"redirect-url"`
+	Scopes        []string `yaml:"scopes"`
+	UsernameClaim string   `yaml:"username-claim"`
+	GroupsClaim   string   `yaml:"groups-claim"`
+	AllowedGroups []string `yaml:"allowed-groups"`
+
+	mu                sync.Mutex
+	metadata          *oidcProviderMetadata
+	metadataFetchedAt time.Time
+	keys              map[string]crypto.PublicKey
+	keysFetchedAt     time.Time
+}
+
+type oidcProviderMetadata struct {
+	Issuer                   string   `json:"issuer"`
+	AuthorizationEndpoint    string   `json:"authorization_endpoint"`
+	TokenEndpoint            string   `json:"token_endpoint"`
+	UserinfoEndpoint         string   `json:"userinfo_endpoint"`
+	JWKSURI                  string   `json:"jwks_uri"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type oidcTokenResponse struct {
+	IDToken     string `json:"id_token"`
+	AccessToken string `json:"access_token"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type oidcUser struct {
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+// Stored in the data of sessions that were created by logging in through the provider, which is
+// what lets them be checked against the config again once it changes
+type oidcSessionData struct {
+	Provider string   `json:"provider"`
+	Issuer   string   `json:"issuer"`
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+func parseOIDCSessionData(data string) (*oidcSessionData, bool) {
+	var parsed oidcSessionData
+	if !strings.HasPrefix(data, "{") || json.Unmarshal([]byte(data), &parsed) != nil || parsed.Provider != "oidc" {
+		return nil, false
+	}
+
+	return &parsed, true
+}
+
+// Reports whether a user that logged in with the given groups may access the dashboard
+func (p *oidcProvider) allowsGroups(groups []string) bool {
+	if len(p.AllowedGroups) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(p.AllowedGroups, func(group string) bool { return slices.Contains(groups, group) })
+}
+
+// Kept in a signed cookie between sending someone to the provider and them coming back
+type oidcLoginState struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	RedirectURL  string `json:"redirect_url"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+func (p *oidcProvider) initialize() error {
+	if p.Issuer == "" {
+		return errors.New("issuer is required")
+	}
+
+	if !isAbsoluteHTTPURL(p.Issuer) {
+		return errors.New("issuer must be an absolute http or https URL")
+	}
+
+	if p.ClientID == "" {
+		return errors.New("client-id is required")
+	}
+
+	if p.RedirectURL != "" && !isAbsoluteHTTPURL(p.RedirectURL) {
+		return errors.New("redirect-url must be an absolute http or https URL")
+	}
+
+	if p.Name == "" {
+		p.Name = "SSO"
+	}
+
+	if len(p.Scopes) == 0 {
+		p.Scopes = []string{"openid", "profile", "email"}
+	} else if !slices.Contains(p.Scopes, "openid") {
+		p.Scopes = append([]string{"openid"}, p.Scopes...)
+	}
+
+	if p.UsernameClaim == "" {
+		p.UsernameClaim = "preferred_username"
+	}
+
+	if p.GroupsClaim == "" {
+		p.GroupsClaim = "groups"
+	}
+
+	return nil
+}
+
+func isAbsoluteHTTPURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oidcProviderMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil && time.Since(p.metadataFetchedAt) < oidcMetadataCacheDuration {
+		return p.metadata, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", glanceUserAgentString)
+
+	metadata, err := decodeJsonFromRequest[oidcProviderMetadata](defaultHTTPClient, request)
+	if err != nil {
+		if p.metadata != nil {
+			log.Printf("Could not refresh metadata of OpenID provider, using the previous one: %v", err)
+			return p.metadata, nil
+		}
+
+		return nil, fmt.Errorf("fetching provider metadata: %v", err)
+	}
+
+	// Some providers end their issuer with a slash and some don't, the one they report is what tokens get checked against
+	if strings.TrimSuffix(metadata.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return nil, fmt.Errorf("provider reports its issuer as %q instead of %q", metadata.Issuer, p.Issuer)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("provider metadata is missing the authorization, token or keys endpoint")
+	}
+
+	p.metadata = &metadata
+	p.metadataFetchedAt = time.Now()
+
+	return p.metadata, nil
+}
+
+func (p *oidcProvider) signingKey(ctx context.Context, metadata *oidcProviderMetadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lookup := func() (crypto.PublicKey, bool) {
+		if kid == "" && len(p.keys) == 1 {
+			for _, key := range p.keys {
+				return key, true
+			}
+		}
+
+		key, exists := p.keys[kid]
+		return key, exists
+	}
+
+	if key, exists := lookup(); exists {
+		return key, nil
+	}
+
+	if p.keys != nil && time.Since(p.keysFetchedAt) < oidcKeysRefetchInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", glanceUserAgentString)
+
+	response, err := decodeJsonFromRequest[struct {
+		Keys []jsonWebKey `json:"keys"`
+	}](defaultHTTPClient, request)
+	if err != nil {
+		return nil, fmt.Errorf("fetching signing keys: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(response.Keys))
+	for i := range response.Keys {
+		if response.Keys[i].Use != "" && response.Keys[i].Use != "sig" {
+			continue
+		}
+
+		// Keys of types that aren't supported are skipped since tokens signed with them can't be verified anyway
+		if key, err := parseJSONWebKey(&response.Keys[i]); err == nil {
+			keys[response.Keys[i].Kid] = key
+		}
+	}
+
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, exists := lookup(); exists {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func parseJSONWebKey(key *jsonWebKey) (crypto.PublicKey, error) {
+	decode := func(value string) (*big.Int, error) {
+		decoded, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(decoded) == 0 {
+			return nil, errors.New("invalid key parameter")
+		}
+
+		return new(big.Int).SetBytes(decoded), nil
+	}
+
+	switch key.Kty {
+	case "RSA":
+		n, err := decode(key.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decode(key.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", key.Crv)
+		}
+
+		x, err := decode(key.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decode(key.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", key.Kty)
+	}
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	var hash crypto.Hash
+	var curve string
+	switch alg[2:] {
+	case "256":
+		hash, curve = crypto.SHA256, "P-256"
+	case "384":
+		hash, curve = crypto.SHA384, "P-384"
+	case "512":
+		hash, curve = crypto.SHA512, "P-521"
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the type of the key", alg)
+		}
+
+		if alg[:2] == "RS" {
+			return rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+		}
+
+		return rsa.VerifyPSS(rsaKey, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve.Params().Name != curve {
+			return fmt.Errorf("algorithm %s does not match the type of the key", alg)
+		}
+
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("signature does not match")
+		}
+
+		return nil
+	default:
+		// Also rules out "none" and the HMAC algorithms, which would be keyed with the client secret
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+// Verifies the ID token returned by the provider and returns its claims
+func (p *oidcProvider) verifyIDToken(
+	ctx context.Context,
+	metadata *oidcProviderMetadata,
+	token, nonce string,
+	now time.Time,
+) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("decoding header: %v", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decoding signature: %v", err)
+	}
+
+	key, err := p.signingKey(ctx, metadata, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("verifying signature: %v", err)
+	}
+
+	var claims map[string]any
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("decoding claims: %v", err)
+	}
+
+	if issuer, _ := claims["iss"].(string); issuer != metadata.Issuer {
+		return nil, fmt.Errorf("token was issued by %q", issuer)
+	}
+
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	audiences := claimStrings(claims["aud"])
+	if !slices.Contains(audiences, p.ClientID) {
+		return nil, errors.New("token was not issued for this client")
+	}
+
+	if party, exists := claims["azp"].(string); exists && party != p.ClientID {
+		return nil, errors.New("token was authorized for a different client")
+	}
+
+	expires, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(expires), 0).Add(oidcClockSkew)) {
+		return nil, errors.New("token has expired")
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, errors.New("token nonce does not match")
+	}
+
+	return claims, nil
+}
+
+func decodeJWTSegment(segment string, target any) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(decoded, target)
+}
+
+// Returns the strings of a claim that can either be a single string or a list of them
+func claimStrings(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+
+		return values
+	default:
+		return nil
+	}
+}
+
+func (p *oidcProvider) exchangeCode(
+	ctx context.Context,
+	metadata *oidcProviderMetadata,
+	code, codeVerifier, redirectURL string,
+) (*oidcTokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	// Basic auth is what providers have to support by default, so the secret only goes in the
+	// form for the ones that say they don't
+	methods := metadata.TokenEndpointAuthMethods
+	secretInForm := !slices.Contains(methods, "client_secret_basic") && slices.Contains(methods, "client_secret_post")
+
+	if p.ClientSecret == "" || secretInForm {
+		form.Set("client_id", p.ClientID)
+	}
+
+	if p.ClientSecret != "" && secretInForm {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("User-Agent", glanceUserAgentString)
+
+	if p.ClientSecret != "" && !secretInForm {
+		request.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	response, err := decodeJsonFromRequest[oidcTokenResponse](defaultHTTPClient, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.IDToken == "" {
+		return nil, errors.New("provider did not return an ID token")
+	}
+
+	return &response, nil
+}
+
+func (p *oidcProvider) fetchUserInfo(ctx context.Context, metadata *oidcProviderMetadata, accessToken string) (map[string]any, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", metadata.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("User-Agent", glanceUserAgentString)
+
+	return decodeJsonFromRequest[map[string]any](defaultHTTPClient, request)
+}
+
+// Exchanges the code the provider redirected back with and returns the user it belongs to
+func (p *oidcProvider) completeLogin(ctx context.Context, state *oidcLoginState, code string) (*oidcUser, error) {
+	if code == "" {
+		return nil, errors.New("provider did not return a code")
+	}
+
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := p.exchangeCode(ctx, metadata, code, state.CodeVerifier, state.RedirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %v", err)
+	}
+
+	claims, err := p.verifyIDToken(ctx, metadata, tokens.IDToken, state.Nonce, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+
+	// Providers often leave claims out of the ID token and only return them from the userinfo endpoint
+	_, hasUsername := claims[p.UsernameClaim]
+	_, hasGroups := claims[p.GroupsClaim]
+	if (!hasUsername || (!hasGroups && len(p.AllowedGroups) > 0)) && metadata.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		userInfo, err := p.fetchUserInfo(ctx, metadata, tokens.AccessToken)
+		if err != nil {
+			return nil, fmt.Errorf("fetching user info: %v", err)
+		}
+
+		if userInfo["sub"] != claims["sub"] {
+			return nil, errors.New("user info belongs to a different user than the ID token")
+		}
+
+		for claim, value := range userInfo {
+			if _, exists := claims[claim]; !exists {
+				claims[claim] = value
+			}
+		}
+	}
+
+	user := &oidcUser{Groups: claimStrings(claims[p.GroupsClaim])}
+	user.Subject, _ = claims["sub"].(string)
+	user.Username, _ = claims[p.UsernameClaim].(string)
+
+	if user.Username == "" {
+		return nil, fmt.Errorf("provider did not return the %s claim", p.UsernameClaim)
+	}
+
+	if !p.allowsGroups(user.Groups) {
+		return user, errOIDCUserNotAllowed
+	}
+
+	return user, nil
+}
+
+func randomURLSafeString(length int) (string, error) {
+	bytes := make([]byte, length)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func newOIDCLoginState(redirectURL string, now time.Time) (*oidcLoginState, error) {
+	state := &oidcLoginState{
+		RedirectURL: redirectURL,
+		ExpiresAt:   now.Add(oidcLoginTimeout).Unix(),
+	}
+
+	for _, field := range []*string{&state.State, &state.Nonce, &state.CodeVerifier} {
+		value, err := randomURLSafeString(32)
+		if err != nil {
+			return nil, err
+		}
+
+		*field = value
+	}
+
+	return state, nil
+}
+
+func (a *application) oidcRedirectURL(r *http.Request) string {
+	if a.Config.Auth.OIDC.RedirectURL != "" {
+		return a.Config.Auth.OIDC.RedirectURL
+	}
+
+	scheme := "http"
+	if r.TLS != nil || strings.ToLower(r.Header.Get("X-Forwarded-Proto")) == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host + a.Config.Server.BaseURL + "/auth/oidc/callback"
+}
+
+func (a *application) signOIDCLoginState(state *oidcLoginState) (string, error) {
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(encoded)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(a.oidcLoginStateSignature(payload)), nil
+}
+
+func (a *application) oidcLoginStateSignature(payload string) []byte {
+	h := hmac.New(sha256.New, a.authSecretKey[0:AUTH_TOKEN_SECRET_LENGTH])
+	h.Write([]byte("oidc-login:" + payload))
+	return h.Sum(nil)
+}
+
+func (a *application) verifyOIDCLoginState(value string, now time.Time) (*oidcLoginState, error) {
+	payload, encodedSignature, found := strings.Cut(value, ".")
+	if !found {
+		return nil, errors.New("malformed login state")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, a.oidcLoginStateSignature(payload)) {
+		return nil, errors.New("signature does not match")
+	}
+
+	var state oidcLoginState
+	if err := decodeJWTSegment(payload, &state); err != nil {
+		return nil, err
+	}
+
+	if now.Unix() > state.ExpiresAt {
+		return nil, errors.New("login took too long")
+	}
+
+	return &state, nil
+}
+
+func (a *application) setOIDCLoginCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookieName,
+		Value:    value,
+		MaxAge:   maxAge,
+		Secure:   strings.ToLower(r.Header.Get("X-Forwarded-Proto")) == "https",
+		Path:     a.Config.Server.BaseURL + "/auth/oidc/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+	})
+}
+
+func (a *application) redirectToLoginWithError(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, a.Config.Server.BaseURL+"/login?error="+code, http.StatusSeeOther)
+}
+
+func (a *application) handleOIDCLoginRequest(w http.ResponseWriter, r *http.Request) {
+	provider := a.Config.Auth.OIDC
+
+	metadata, err := provider.discover(r.Context())
+	if err != nil {
+		log.Printf("Could not log in through %s: %v", provider.Name, err)
+		a.redirectToLoginWithError(w, r, loginErrorSSOFailed)
+		return
+	}
+
+	state, err := newOIDCLoginState(a.oidcRedirectURL(r), time.Now())
+	if err != nil {
+		log.Printf("Could not log in through %s: %v", provider.Name, err)
+		a.redirectToLoginWithError(w, r, loginErrorSSOFailed)
+		return
+	}
+
+	signedState, err := a.signOIDCLoginState(state)
+	if err != nil {
+		log.Printf("Could not log in through %s: %v", provider.Name, err)
+		a.redirectToLoginWithError(w, r, loginErrorSSOFailed)
+		return
+	}
+
+	authorizationURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		log.Printf("Could not log in through %s: invalid authorization endpoint: %v", provider.Name, err)
+		a.redirectToLoginWithError(w, r, loginErrorSSOFailed)
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+
+	query := authorizationURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", state.RedirectURL)
+	query.Set("scope", strings.Join(provider.Scopes, " "))
+	query.Set("state", state.State)
+	query.Set("nonce", state.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authorizationURL.RawQuery = query.Encode()
+
+	a.setOIDCLoginCookie(w, r, signedState, int(oidcLoginTimeout.Seconds()))
+	http.Redirect(w, r, authorizationURL.String(), http.StatusFound)
+}
+
+func (a *application) handleOIDCCallbackRequest(w http.ResponseWriter, r *http.Request) {
+	provider := a.Config.Auth.OIDC
+	ip := a.addressOfRequest(r)
+	query := r.URL.Query()
+
+	cookie, err := r.Cookie(oidcLoginCookieName)
+	a.setOIDCLoginCookie(w, r, "", -1)
+
+	var state *oidcLoginState
+	if err == nil {
+		state, err = a.verifyOIDCLoginState(cookie.Value, time.Now())
+	}
+
+	if err != nil || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		log.Printf("Rejected login through %s from %s: the login was not started here or took too long", provider.Name, ip)
+		a.redirectToLoginWithError(w, r, loginErrorSSOFailed)
+		return
+	}
+
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("Login through %s from %s did not succeed: %s %s", provider.Name, ip, providerError, query.Get("error_description"))
+		a.redirectToLoginWithError(w, r, loginErrorSSOFailed)
+		return
+	}
+
+	user, err := provider.completeLogin(r.Context(), state, query.Get("code"))
+	if err != nil {
+		username := ""
+		if user != nil {
+			username = user.Username
+		}
+
+		log.Printf("Failed login attempt through %s from %s: %v", provider.Name, ip, err)
+
+		if a.services.metrics != nil {
+			a.services.metrics.RecordAuthFailure()
+		}
+
+		recordActivity(a.services.db, activityEvent{
+			Type:      activityLoginFailed,
+			Level:     activityLevelWarning,
+			Message:   fmt.Sprintf("Failed login attempt through %s: %v", provider.Name, err),
+			User:      username,
+			IPAddress: ip,
+		})
+
+		a.redirectToLoginWithError(w, r, ternary(errors.Is(err, errOIDCUserNotAllowed), loginErrorSSODenied, loginErrorSSOFailed))
+		return
+	}
+
+	data, err := json.Marshal(&oidcSessionData{
+		Provider: "oidc",
+		Issuer:   provider.Issuer,
+		Username: user.Username,
+		Groups:   user.Groups,
+	})
+	if err == nil {
+		_, err = a.createStoredSession(w, r, oidcSessionUserIDPrefix+user.Subject, string(data))
+	}
+
+	if err != nil {
+		log.Printf("Could not store session during login through %s: %v", provider.Name, err)
+		a.redirectToLoginWithError(w, r, loginErrorSSOFailed)
+		return
+	}
+
+	recordActivity(a.services.db, activityEvent{
+		Type:      activityLogin,
+		Level:     activityLevelSuccess,
+		Message:   fmt.Sprintf("User '%s' logged in through %s", user.Username, provider.Name),
+		User:      user.Username,
+		IPAddress: ip,
+	})
+
+	http.Redirect(w, r, a.Config.Server.BaseURL+"/", http.StatusSeeOther)
+}
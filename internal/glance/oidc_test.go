@@ -0,0 +1,278 @@
+package glance
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+	"github.com/glanceapp/glance/internal/websocket"
+)
+
+// A stand-in for an OpenID provider that hands out tokens for whichever user the test picks
+type testOIDCProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	// Claims of the user that logs in next
+	user map[string]any
+	// Code challenges by the codes they were sent along with
+	challenges map[string]string
+	nonces     map[string]string
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	provider := &testOIDCProvider{key: key, challenges: map[string]string{}, nonces: map[string]string{}}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                 provider.URL,
+			"authorization_endpoint": provider.URL + "/authorize",
+			"token_endpoint":         provider.URL + "/token",
+			"userinfo_endpoint":      provider.URL + "/userinfo",
+			"jwks_uri":               provider.URL + "/keys",
+		})
+	})
+
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		code := r.FormValue("code")
+		challenge := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+
+		if id, secret, _ := r.BasicAuth(); id != "glance" || secret != "client-secret" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		if provider.challenges[code] != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := map[string]any{
+			"iss":   provider.URL,
+			"aud":   "glance",
+			"sub":   provider.user["sub"],
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": provider.nonces[code],
+		}
+
+		// Like a lot of providers, the groups are only returned from the userinfo endpoint
+		for claim, value := range provider.user {
+			if claim != "groups" {
+				claims[claim] = value
+			}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{
+			"id_token":     provider.sign(t, claims),
+			"access_token": "access-" + code,
+		})
+	})
+
+	mux.HandleFunc("GET /userinfo", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, provider.user)
+	})
+
+	provider.Server = httptest.NewServer(mux)
+	t.Cleanup(provider.Close)
+
+	return provider
+}
+
+func (p *testOIDCProvider) sign(t *testing.T, claims map[string]any) string {
+	encode := func(value any) string {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(encoded)
+	}
+
+	signed := encode(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Follows the redirect to the authorization endpoint the way the provider would once the user logs in
+func (p *testOIDCProvider) authorize(t *testing.T, location, code string) string {
+	authorizationURL, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, p.URL+"/authorize") {
+		t.Fatalf("Expected to be redirected to the provider, got %q", location)
+	}
+
+	query := authorizationURL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("scope") != "openid profile groups" {
+		t.Fatalf("Unexpected authorization request %q", location)
+	}
+
+	p.challenges[code] = query.Get("code_challenge")
+	p.nonces[code] = query.Get("nonce")
+
+	return query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+}
+
+func TestLoggingInThroughOIDCProvider(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+
+	db, err := database.New(filepath.Join(t.TempDir(), "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	secret, _ := makeAuthSecretKey(AUTH_SECRET_KEY_LENGTH)
+	config, err := newConfigFromYAML([]byte(`
+auth:
+  secret-key: ` + secret + `
+  oidc:
+    issuer: ` + provider.URL + `
+    client-id: glance
+    client-secret: client-secret
+    scopes: [profile, groups]
+    allowed-groups: [family]
+  users:
+    alice:
+      password: hunter22
+database:
+  enabled: true
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: hello
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	services := &sharedServices{db: db, wsHub: websocket.NewHub(), scheduler: newWidgetScheduler()}
+	app, err := newApplication(config, services, nil)
+	if err != nil {
+		t.Fatalf("Failed to create application: %v", err)
+	}
+	handler := app.handler()
+
+	login := func(code string) *httptest.ResponseRecorder {
+		t.Helper()
+		start := httptest.NewRecorder()
+		handler.ServeHTTP(start, httptest.NewRequest("GET", "http://glance.local/auth/oidc/login", nil))
+
+		callback := httptest.NewRequest("GET", provider.authorize(t, start.Header().Get("Location"), code), nil)
+		for _, cookie := range start.Result().Cookies() {
+			callback.AddCookie(cookie)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, callback)
+		return recorder
+	}
+
+	provider.user = map[string]any{"sub": "1", "preferred_username": "alice", "groups": []string{"family"}}
+	response := login("first")
+	if location := response.Header().Get("Location"); location != "/" {
+		t.Fatalf("Expected to be logged in, got redirected to %q", location)
+	}
+
+	var sessionCookie *http.Cookie
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == AUTH_SESSION_COOKIE_NAME {
+			sessionCookie = cookie
+		}
+	}
+
+	if sessionCookie == nil || !app.isAuthorized(httptest.NewRecorder(), withCookie(sessionCookie)) {
+		t.Fatal("Expected the session to be authorized")
+	}
+
+	if sessions, _ := db.Sessions.ListForUser(t.Context(), oidcSessionUserIDPrefix+"1", time.Now()); len(sessions) != 1 || sessionUsername(&sessions[0]) != "alice" {
+		t.Errorf("Expected a session to be stored for the subject of the user, got %+v", sessions)
+	}
+
+	// A local user with the same name is a different user
+	localLogin := httptest.NewRequest("POST", "/api/authenticate", strings.NewReader(`{"username":"alice","password":"hunter22"}`))
+	localLogin.Header.Set("Content-Type", "application/json")
+	localLogin.Header.Set("User-Agent", "local-browser")
+	localRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(localRecorder, localLogin)
+	localCookie := localRecorder.Result().Cookies()[0]
+
+	sessionsPage := httptest.NewRequest("GET", "/sessions", nil)
+	sessionsPage.AddCookie(sessionCookie)
+	page := httptest.NewRecorder()
+	handler.ServeHTTP(page, sessionsPage)
+	if body := page.Body.String(); page.Code != http.StatusOK || strings.Contains(body, "local-browser") {
+		t.Errorf("Expected only the sessions of the provider's user to be listed, got %d:\n%s", page.Code, body)
+	}
+
+	revokeAll := httptest.NewRequest("POST", "/sessions/revoke-all", nil)
+	revokeAll.AddCookie(sessionCookie)
+	handler.ServeHTTP(httptest.NewRecorder(), revokeAll)
+	if !app.isAuthorized(httptest.NewRecorder(), withCookie(localCookie)) || app.isAuthorized(httptest.NewRecorder(), withCookie(sessionCookie)) {
+		t.Error("Expected logging out everywhere to only end the sessions of the provider's user")
+	}
+
+	sessionCookie = nil
+	for _, cookie := range login("again").Result().Cookies() {
+		if cookie.Name == AUTH_SESSION_COOKIE_NAME {
+			sessionCookie = cookie
+		}
+	}
+
+	// Groups are checked again against the config for sessions that already exist
+	app.Config.Auth.OIDC.AllowedGroups = []string{"admins"}
+	if sessionCookie == nil || app.isAuthorized(httptest.NewRecorder(), withCookie(sessionCookie)) {
+		t.Error("Expected the session to end once its groups are no longer allowed")
+	}
+	app.Config.Auth.OIDC.AllowedGroups = []string{"family"}
+
+	provider.user = map[string]any{"sub": "2", "preferred_username": "mallory", "groups": []string{"guests"}}
+	if location := login("second").Header().Get("Location"); location != "/login?error="+loginErrorSSODenied {
+		t.Errorf("Expected users outside of the allowed groups to be turned away, got redirected to %q", location)
+	}
+
+	// The callback only works for logins that were started from the same browser
+	provider.user = map[string]any{"sub": "1", "preferred_username": "alice", "groups": []string{"family"}}
+	start := httptest.NewRecorder()
+	handler.ServeHTTP(start, httptest.NewRequest("GET", "http://glance.local/auth/oidc/login", nil))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", provider.authorize(t, start.Header().Get("Location"), "third"), nil))
+	if location := recorder.Header().Get("Location"); location != "/login?error="+loginErrorSSOFailed {
+		t.Errorf("Expected a callback without the login state to be rejected, got redirected to %q", location)
+	}
+}
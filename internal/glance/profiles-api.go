@@ -0,0 +1,286 @@
+package glance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+const maxProfileRequestBodySize = 64 * 1024
+
+type profileResponse struct {
+	database.Profile
+	// Omitted when listing profiles since it can be large
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+type profileRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Replaces the pages and theme of the profile with the ones currently in use, only used when updating
+	Snapshot bool `json:"snapshot"`
+}
+
+func (a *application) registerProfileRoutes() {
+	a.apiServer.Handle("GET /api/v1/profiles", http.HandlerFunc(a.handleListProfiles))
+	a.apiServer.Handle("POST /api/v1/profiles", http.HandlerFunc(a.handleCreateProfile))
+	a.apiServer.Handle("POST /api/v1/profiles/deactivate", http.HandlerFunc(a.handleDeactivateProfiles))
+	a.apiServer.Handle("GET /api/v1/profiles/{id}", http.HandlerFunc(a.handleGetProfile))
+	a.apiServer.Handle("PUT /api/v1/profiles/{id}", http.HandlerFunc(a.handleUpdateProfile))
+	a.apiServer.Handle("DELETE /api/v1/profiles/{id}", http.HandlerFunc(a.handleDeleteProfile))
+	a.apiServer.Handle("POST /api/v1/profiles/{id}/activate", http.HandlerFunc(a.handleActivateProfile))
+}
+
+func (a *application) handleListProfiles(w http.ResponseWriter, r *http.Request) {
+	if !a.requireProfiles(w) {
+		return
+	}
+
+	profiles, err := a.services.db.Profiles.List(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve profiles: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]profileResponse, 0, len(profiles))
+	for i := range profiles {
+		response = append(response, profileResponse{Profile: profiles[i]})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *application) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := a.profileOfRequest(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newProfileResponse(profile))
+}
+
+// Saves the pages and theme currently in use as a new profile
+func (a *application) handleCreateProfile(w http.ResponseWriter, r *http.Request) {
+	if !a.requireProfiles(w) {
+		return
+	}
+
+	request, ok := decodeProfileRequest(w, r)
+	if !ok {
+		return
+	}
+
+	configJSON, err := a.currentProfileConfig()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to snapshot the current pages: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	profile := &database.Profile{Name: request.Name, Description: request.Description, ConfigJSON: configJSON}
+	if err := a.services.db.Profiles.Create(r.Context(), profile); err != nil {
+		writeProfileSaveError(w, err)
+		return
+	}
+
+	// Reading it back includes the timestamps set by the database
+	created, err := a.services.db.Profiles.Get(r.Context(), profile.ID)
+	if err != nil || created == nil {
+		created = profile
+	}
+
+	writeJSON(w, http.StatusCreated, newProfileResponse(created))
+}
+
+func (a *application) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := a.profileOfRequest(w, r)
+	if !ok {
+		return
+	}
+
+	request, ok := decodeProfileRequest(w, r)
+	if !ok {
+		return
+	}
+
+	profile.Name = request.Name
+	profile.Description = request.Description
+
+	if request.Snapshot {
+		configJSON, err := a.currentProfileConfig()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to snapshot the current pages: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		profile.ConfigJSON = configJSON
+	}
+
+	if err := a.services.db.Profiles.Update(r.Context(), profile); err != nil {
+		writeProfileSaveError(w, err)
+		return
+	}
+
+	if updated, err := a.services.db.Profiles.Get(r.Context(), profile.ID); err == nil && updated != nil {
+		profile = updated
+	}
+
+	writeJSON(w, http.StatusOK, newProfileResponse(profile))
+}
+
+func (a *application) handleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := a.profileOfRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.services.db.Profiles.Delete(r.Context(), profile.ID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Goes back to the pages from the config files
+	if profile.Active {
+		a.reloadForProfile()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// The profile is applied to the config files as they are now and has to result
+// in a valid config, otherwise it's not activated and the error is returned
+func (a *application) handleActivateProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := a.profileOfRequest(w, r)
+	if !ok || !a.requireReloading(w) {
+		return
+	}
+
+	if _, err := newConfigWithProfile(a.Config.contents, profile); err != nil {
+		http.Error(w, fmt.Sprintf("Profile can't be used with the current config: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.services.db.Profiles.Activate(r.Context(), profile.ID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to activate profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Switching to profile %s", profile.Name)
+	a.reloadForProfile()
+
+	profile.Active = true
+	writeJSON(w, http.StatusOK, newProfileResponse(profile))
+}
+
+func (a *application) handleDeactivateProfiles(w http.ResponseWriter, r *http.Request) {
+	if !a.requireProfiles(w) || !a.requireReloading(w) {
+		return
+	}
+
+	if err := a.services.db.Profiles.Deactivate(r.Context()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to deactivate profiles: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if a.Config.profile != nil {
+		log.Println("Switching back to the pages from the config file")
+		a.reloadForProfile()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *application) requireProfiles(w http.ResponseWriter) bool {
+	if a.services.db == nil {
+		http.Error(w, "Database is not enabled", http.StatusServiceUnavailable)
+		return false
+	}
+
+	return true
+}
+
+func (a *application) requireReloading(w http.ResponseWriter) bool {
+	if a.services.reloadConfig == nil {
+		http.Error(w, "Switching profiles requires the config files to be watched for changes, which failed when Glance started", http.StatusServiceUnavailable)
+		return false
+	}
+
+	return true
+}
+
+// Done before responding so that the pages of the profile are being served by the time the client gets the response
+func (a *application) reloadForProfile() {
+	if a.services.reloadConfig != nil {
+		a.services.reloadConfig()
+	}
+}
+
+// The pages and theme in use, which are either the ones of the active profile or from the config files
+func (a *application) currentProfileConfig() (string, error) {
+	if a.Config.profile != nil {
+		return a.Config.profile.ConfigJSON, nil
+	}
+
+	return snapshotProfileConfig(a.Config.contents)
+}
+
+func (a *application) profileOfRequest(w http.ResponseWriter, r *http.Request) (*database.Profile, bool) {
+	if !a.requireProfiles(w) {
+		return nil, false
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	profile, err := a.services.db.Profiles.Get(r.Context(), id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to retrieve profile: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if profile == nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return profile, true
+}
+
+func decodeProfileRequest(w http.ResponseWriter, r *http.Request) (*profileRequest, bool) {
+	request := &profileRequest{}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxProfileRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if request.Name == "" {
+		http.Error(w, "Invalid profile: name is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return request, true
+}
+
+func writeProfileSaveError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrProfileNameTaken) {
+		http.Error(w, "A profile with that name already exists", http.StatusConflict)
+		return
+	}
+
+	http.Error(w, fmt.Sprintf("Failed to save profile: %v", err), http.StatusInternalServerError)
+}
+
+func newProfileResponse(profile *database.Profile) profileResponse {
+	return profileResponse{Profile: *profile, Config: json.RawMessage(profile.ConfigJSON)}
+}
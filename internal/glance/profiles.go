@@ -0,0 +1,274 @@
+package glance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/glanceapp/glance/internal/database"
+	"gopkg.in/yaml.v3"
+)
+
+// The sections of the config that a profile replaces, everything else still comes from the config files
+var profileSections = []string{"theme", "pages"}
+
+// Returns the pages and theme from the contents of the config files as the JSON stored in a
+// profile. The order of keys is kept since it matters for some of them, such as theme presets.
+// Variables aren't replaced so that secrets don't end up in the database.
+func snapshotProfileConfig(contents []byte) (string, error) {
+	root, err := parseConfigDocument(contents)
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+
+	for i, section := range profileSections {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		buffer.WriteString(`"` + section + `":`)
+
+		node := findYAMLMappingValue(root, section)
+		if node == nil {
+			if section == "pages" {
+				return "", errors.New("config has no pages")
+			}
+
+			// Otherwise activating the profile would keep the theme from the config files
+			buffer.WriteString("{}")
+			continue
+		}
+
+		if err := encodeYAMLNodeAsJSON(&buffer, node); err != nil {
+			return "", fmt.Errorf("encoding %s: %v", section, err)
+		}
+	}
+
+	buffer.WriteByte('}')
+	return buffer.String(), nil
+}
+
+// Parses the contents of the config files with the pages and theme replaced by the ones of the profile
+func newConfigWithProfile(contents []byte, profile *database.Profile) (*config, error) {
+	overlaid, err := overlayProfileConfig(contents, profile.ConfigJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := newConfigFromYAML(overlaid)
+	if err != nil {
+		return nil, err
+	}
+
+	config.contents = contents
+	config.profile = profile
+
+	return config, nil
+}
+
+func overlayProfileConfig(contents []byte, configJSON string) ([]byte, error) {
+	root, err := parseConfigDocument(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, parsing it this way keeps the order of keys
+	var profileDocument yaml.Node
+	if err := yaml.Unmarshal([]byte(configJSON), &profileDocument); err != nil {
+		return nil, fmt.Errorf("parsing profile: %v", err)
+	}
+
+	if len(profileDocument.Content) == 0 || profileDocument.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("profile must be an object")
+	}
+	profileRoot := profileDocument.Content[0]
+
+	for i := 0; i < len(profileRoot.Content); i += 2 {
+		if key := profileRoot.Content[i].Value; !slices.Contains(profileSections, key) {
+			return nil, fmt.Errorf("profiles can only contain %s, got %s", strings.Join(profileSections, " and "), key)
+		}
+	}
+
+	for _, section := range profileSections {
+		value := findYAMLMappingValue(profileRoot, section)
+		if value == nil {
+			continue
+		}
+
+		if existing := findYAMLMappingValue(root, section); existing != nil {
+			*existing = *value
+		} else {
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: section}, value)
+		}
+	}
+
+	return yaml.Marshal(root)
+}
+
+// Used for the config as parsed when loaded and when a profile gets activated through the API,
+// if the profile can't be applied the pages and theme from the config files are used instead
+func applyActiveProfile(db *database.DB, config *config) *config {
+	if db == nil {
+		return config
+	}
+
+	profile, err := db.Profiles.Active(context.Background())
+	if err != nil {
+		log.Printf("Failed to get the active profile: %v", err)
+		return config
+	}
+
+	if profile == nil {
+		return config
+	}
+
+	withProfile, err := newConfigWithProfile(config.contents, profile)
+	if err != nil {
+		log.Printf("Could not apply profile %s, using the pages from the config file instead: %v", profile.Name, err)
+		return config
+	}
+
+	return withProfile
+}
+
+func parseConfigDocument(contents []byte) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, err
+	}
+
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("config must be a mapping")
+	}
+
+	return document.Content[0], nil
+}
+
+func findYAMLMappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// Unlike decoding into a map and encoding that, keeps the order of keys
+func encodeYAMLNodeAsJSON(buffer *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return encodeYAMLNodeAsJSON(buffer, node.Content[0])
+	case yaml.AliasNode:
+		return encodeYAMLNodeAsJSON(buffer, node.Alias)
+	case yaml.SequenceNode:
+		buffer.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+
+			if err := encodeYAMLNodeAsJSON(buffer, item); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(']')
+	case yaml.MappingNode:
+		pairs := flattenYAMLMapping(node)
+
+		buffer.WriteByte('{')
+		for i := 0; i < len(pairs); i += 2 {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+
+			key, _ := json.Marshal(pairs[i].Value)
+			buffer.Write(key)
+			buffer.WriteByte(':')
+
+			if err := encodeYAMLNodeAsJSON(buffer, pairs[i+1]); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('}')
+	case yaml.ScalarNode:
+		var value any = node.Value
+
+		switch node.ShortTag() {
+		case "!!null", "!!bool", "!!int", "!!float":
+			if err := node.Decode(&value); err != nil {
+				return err
+			}
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			// Such as infinite floats, which YAML has but JSON doesn't
+			encoded, _ = json.Marshal(node.Value)
+		}
+		buffer.Write(encoded)
+	default:
+		return fmt.Errorf("unsupported node at line %d", node.Line)
+	}
+
+	return nil
+}
+
+// Resolves merge keys such as <<: *defaults into the pairs they bring in,
+// keys that are set on the mapping itself take precedence over merged ones
+func flattenYAMLMapping(node *yaml.Node) []*yaml.Node {
+	explicit := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].ShortTag() != "!!merge" {
+			explicit[node.Content[i].Value] = true
+		}
+	}
+
+	pairs := make([]*yaml.Node, 0, len(node.Content))
+	added := make(map[string]bool)
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		if key.ShortTag() != "!!merge" {
+			pairs = append(pairs, key, value)
+			continue
+		}
+
+		merged := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			merged = value.Content
+		}
+
+		for _, source := range merged {
+			if source.Kind == yaml.AliasNode {
+				source = source.Alias
+			}
+
+			if source.Kind != yaml.MappingNode {
+				continue
+			}
+
+			sourcePairs := flattenYAMLMapping(source)
+			for j := 0; j < len(sourcePairs); j += 2 {
+				name := sourcePairs[j].Value
+				if explicit[name] || added[name] {
+					continue
+				}
+
+				added[name] = true
+				pairs = append(pairs, sourcePairs[j], sourcePairs[j+1])
+			}
+		}
+	}
+
+	return pairs
+}
@@ -0,0 +1,86 @@
+package glance
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+func TestProfileSnapshotCanBeOverlaid(t *testing.T) {
+	original := []byte(`
+server:
+  port: 8080
+
+theme:
+  background-color: 240 8 9
+  presets:
+    nord:
+      primary-color: 213 32 52
+    dracula:
+      primary-color: 265 89 79
+
+defaults: &column
+  size: full
+
+pages:
+  - name: Home
+    columns:
+      - <<: *column
+        widgets:
+          - type: calendar
+`)
+
+	configJSON, err := snapshotProfileConfig(original)
+	if err != nil {
+		t.Fatalf("Failed to snapshot config: %v", err)
+	}
+
+	if strings.Contains(configJSON, "<<") || !strings.Contains(configJSON, `"size":"full"`) {
+		t.Errorf("Expected merge keys to be resolved, got %s", configJSON)
+	}
+
+	if strings.Index(configJSON, "nord") > strings.Index(configJSON, "dracula") {
+		t.Errorf("Expected the order of presets to be kept, got %s", configJSON)
+	}
+
+	current := []byte(`
+server:
+  port: 9090
+
+pages:
+  - name: Other
+    columns:
+      - size: full
+        widgets:
+          - type: clock
+`)
+
+	config, err := newConfigWithProfile(current, &database.Profile{Name: "home", ConfigJSON: configJSON})
+	if err != nil {
+		t.Fatalf("Failed to apply profile: %v", err)
+	}
+
+	if config.Server.Port != 9090 {
+		t.Errorf("Expected settings outside of the profile to come from the config, got port %d", config.Server.Port)
+	}
+
+	if len(config.Pages) != 1 || config.Pages[0].Title != "Home" {
+		t.Errorf("Expected the pages of the profile to be used, got %+v", config.Pages)
+	}
+
+	if string(config.contents) != string(current) {
+		t.Error("Expected the contents of the config files to be kept without the profile")
+	}
+
+	invalid := []*database.Profile{
+		{Name: "server", ConfigJSON: `{"server":{"port":1}}`},
+		{Name: "no columns", ConfigJSON: `{"pages":[{"name":"Empty"}]}`},
+	}
+
+	for _, profile := range invalid {
+		if _, err := newConfigWithProfile(current, profile); err == nil {
+			t.Errorf("Expected profile %q to be rejected", profile.Name)
+		}
+	}
+}
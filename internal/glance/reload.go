@@ -0,0 +1,94 @@
+package glance
+
+// Replaces widgets that haven't changed since the previous config with their
+// instances from it so that they keep their data, schedule and retry state
+// rather than starting over. Returns the widgets that were carried over.
+func carryOverUnchangedWidgets(pages []page, previous *application, providers *widgetProviders) map[widget]bool {
+	carried := make(map[widget]bool)
+	if previous == nil {
+		return carried
+	}
+
+	type placedWidget struct {
+		widget  widget
+		inGroup bool
+	}
+
+	previousByID := make(map[string]placedWidget)
+
+	var collect func(list widgets, inGroup bool)
+	collect = func(list widgets, inGroup bool) {
+		for _, widget := range list {
+			if container, ok := widget.(widgetWithChildren); ok {
+				collect(container.childWidgets(), widget.GetType() == "group")
+				continue
+			}
+
+			previousByID[widget.GetID()] = placedWidget{widget, inGroup}
+		}
+	}
+
+	for p := range previous.Config.Pages {
+		collect(previous.Config.Pages[p].HeadWidgets, false)
+
+		for c := range previous.Config.Pages[p].Columns {
+			collect(previous.Config.Pages[p].Columns[c].Widgets, false)
+		}
+	}
+
+	// Widgets inside of groups get modified by the group when it's initialized,
+	// so a widget that moved in or out of one is treated as having changed
+	var replace func(list widgets, inGroup bool)
+	replace = func(list widgets, inGroup bool) {
+		for i, widget := range list {
+			if container, ok := widget.(widgetWithChildren); ok {
+				replace(container.childWidgets(), widget.GetType() == "group")
+				continue
+			}
+
+			old, exists := previousByID[widget.GetID()]
+			if !exists ||
+				old.inGroup != inGroup ||
+				old.widget.GetType() != widget.GetType() ||
+				old.widget.getConfigHash() != widget.getConfigHash() {
+				continue
+			}
+
+			// The previous application may still be updating the widget
+			old.widget.lock()
+			old.widget.setProviders(providers)
+			old.widget.unlock()
+
+			list[i] = old.widget
+			carried[old.widget] = true
+		}
+	}
+
+	for p := range pages {
+		replace(pages[p].HeadWidgets, false)
+
+		for c := range pages[p].Columns {
+			replace(pages[p].Columns[c].Widgets, false)
+		}
+	}
+
+	return carried
+}
+
+// Notification channels keep their rate limiter across reloads so that reloading
+// the config doesn't let through a whole new burst of notifications. Channels are
+// matched by name and start over if their rate limit changed.
+func carryOverNotificationLimiters(channels map[string]*notificationChannel, previous *application) {
+	if previous == nil {
+		return
+	}
+
+	for name, channel := range channels {
+		old, exists := previous.Config.Notifications[name]
+		if !exists || old.limiter == nil || channel.limiter == nil || *old.RateLimit != *channel.RateLimit {
+			continue
+		}
+
+		channel.limiter = old.limiter
+	}
+}
@@ -0,0 +1,176 @@
+package glance
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/glanceapp/glance/internal/api"
+	"github.com/glanceapp/glance/internal/websocket"
+)
+
+func TestUnchangedWidgetsAreCarriedOverOnReload(t *testing.T) {
+	const before = `
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            id: same
+            source: unchanged
+          - type: html
+            id: changed
+            source: before
+`
+
+	const after = `
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            id: changed
+            source: after
+          - type: html
+            id: same
+            source: unchanged
+`
+
+	services := &sharedServices{wsHub: websocket.NewHub(), scheduler: newWidgetScheduler()}
+
+	newTestApp := func(contents string, previous *application) *application {
+		config, err := newConfigFromYAML([]byte(contents))
+		if err != nil {
+			t.Fatalf("Failed to parse config: %v", err)
+		}
+
+		app, err := newApplication(config, services, previous)
+		if err != nil {
+			t.Fatalf("Failed to create application: %v", err)
+		}
+
+		return app
+	}
+
+	previous := newTestApp(before, nil)
+	current := newTestApp(after, previous)
+
+	if previous.widgetByID["same"] != current.widgetByID["same"] {
+		t.Error("Expected the unchanged widget to be carried over")
+	}
+
+	if previous.widgetByID["changed"] == current.widgetByID["changed"] {
+		t.Error("Expected the changed widget to be replaced")
+	}
+
+	if current.Config.Pages[0].Columns[0].Widgets[1] != current.widgetByID["same"] {
+		t.Error("Expected the carried over widget to take the place of the new one")
+	}
+}
+
+func TestNotificationRateLimitsSurviveReloads(t *testing.T) {
+	const contents = `
+notifications:
+  phone:
+    type: ntfy
+    url: https://ntfy.sh
+    topic: glance
+    rate-limit: 2
+  chat:
+    type: ntfy
+    url: https://ntfy.sh
+    topic: chat
+    rate-limit: %d
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: hello
+`
+
+	services := &sharedServices{wsHub: websocket.NewHub(), scheduler: newWidgetScheduler()}
+
+	newTestApp := func(chatRateLimit int, previous *application) *application {
+		config, err := newConfigFromYAML(fmt.Appendf(nil, contents, chatRateLimit))
+		if err != nil {
+			t.Fatalf("Failed to parse config: %v", err)
+		}
+
+		app, err := newApplication(config, services, previous)
+		if err != nil {
+			t.Fatalf("Failed to create application: %v", err)
+		}
+
+		return app
+	}
+
+	previous := newTestApp(2, nil)
+	for _, channel := range previous.Config.Notifications {
+		channel.limiter.Allow(2)
+	}
+
+	current := newTestApp(3, previous)
+
+	if current.Config.Notifications["phone"].limiter.Allow(1) {
+		t.Error("Expected the channel to still be rate limited after reloading")
+	}
+
+	if !current.Config.Notifications["chat"].limiter.Allow(1) {
+		t.Error("Expected the channel whose rate limit changed to start over")
+	}
+}
+
+func TestAPIRateLimitsSurviveReloads(t *testing.T) {
+	const contents = `
+api:
+  rate-limit: %d
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: hello
+`
+
+	services := &sharedServices{wsHub: websocket.NewHub(), scheduler: newWidgetScheduler(), apiRateLimiter: api.NewRateLimiter()}
+
+	newTestApp := func(rateLimit int, previous *application) *application {
+		config, err := newConfigFromYAML(fmt.Appendf(nil, contents, rateLimit))
+		if err != nil {
+			t.Fatalf("Failed to parse config: %v", err)
+		}
+
+		app, err := newApplication(config, services, previous)
+		if err != nil {
+			t.Fatalf("Failed to create application: %v", err)
+		}
+
+		return app
+	}
+
+	request := func(app *application) int {
+		recorder := httptest.NewRecorder()
+		app.handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/api/v1/metrics", nil))
+		return recorder.Code
+	}
+
+	previous := newTestApp(2, nil)
+	request(previous)
+	request(previous)
+
+	current := newTestApp(2, previous)
+	if code := request(current); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the client to still be rate limited after reloading, got %d", code)
+	}
+
+	changed := newTestApp(3, current)
+	if code := request(changed); code == http.StatusTooManyRequests {
+		t.Error("Expected clients to start over once the rate limit changes")
+	}
+}
@@ -0,0 +1,260 @@
+package glance
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const widgetSchedulerInterval = time.Second
+
+// Refreshes widgets in the background as soon as they're due for an update so
+// that requests for a page don't have to wait for slow upstreams. A single
+// scheduler is shared across config reloads so that updates which are still in
+// progress for widgets that got carried over to the new config are tracked.
+type widgetScheduler struct {
+	mu       sync.Mutex
+	widgets  []widget
+	updating map[widget]*widgetUpdate
+
+	// How long past the time it was due for an update the content of a
+	// widget can be shown for while it's being updated
+	maxStaleness time.Duration
+	concurrency  chan struct{}
+	// Called after each update while the widget is still locked
+	onUpdated func(widget, widgetUpdateResult)
+
+	stopOnce    sync.Once
+	stopChannel chan struct{}
+}
+
+type widgetUpdateResult struct {
+	duration time.Duration
+	// The error the widget had before the update
+	previousErr error
+}
+
+type widgetUpdate struct {
+	// Closed once the update finishes
+	done chan struct{}
+	// When the widget was due for the update, zero if it has never been updated
+	due time.Time
+}
+
+func newWidgetScheduler() *widgetScheduler {
+	return &widgetScheduler{
+		updating:    make(map[widget]*widgetUpdate),
+		concurrency: make(chan struct{}, 1),
+		stopChannel: make(chan struct{}),
+	}
+}
+
+// Replaces the widgets that get updated, updates that are in progress for
+// widgets which are no longer scheduled are left to finish
+func (s *widgetScheduler) schedule(widgets []widget, concurrency int, maxStaleness time.Duration, onUpdated func(widget, widgetUpdateResult)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.widgets = widgets
+	s.maxStaleness = maxStaleness
+	s.onUpdated = onUpdated
+
+	if cap(s.concurrency) != concurrency {
+		s.concurrency = make(chan struct{}, concurrency)
+	}
+}
+
+func (s *widgetScheduler) start() {
+	go func() {
+		ticker := time.NewTicker(widgetSchedulerInterval)
+		defer ticker.Stop()
+
+		for {
+			s.updateOutdated()
+
+			select {
+			case <-s.stopChannel:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Updates that are already in progress are left to finish
+func (s *widgetScheduler) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChannel)
+	})
+}
+
+func (s *widgetScheduler) updateOutdated() {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, widget := range s.widgets {
+		if _, updating := s.updating[widget]; updating {
+			continue
+		}
+
+		if widget.requiresUpdate(&now) {
+			s.startUpdateLocked(widget)
+		}
+	}
+}
+
+// Starts updating any of the given widgets that are outdated and waits for the
+// ones whose content is too stale to be shown or that have never been updated
+func (s *widgetScheduler) refreshOutdated(ctx context.Context, widgets []widget) {
+	now := time.Now()
+	pending := make([]chan struct{}, 0)
+
+	s.mu.Lock()
+	for _, widget := range widgets {
+		update, updating := s.updating[widget]
+
+		if !updating {
+			if !widget.requiresUpdate(&now) {
+				continue
+			}
+
+			update = s.startUpdateLocked(widget)
+		}
+
+		if update.due.IsZero() || now.Sub(update.due) > s.maxStaleness {
+			pending = append(pending, update.done)
+		}
+	}
+	s.mu.Unlock()
+
+	waitForAll(ctx, pending)
+}
+
+// Updates the given widgets regardless of whether they're due for an update,
+// widgets that are already being updated don't get updated a second time
+func (s *widgetScheduler) refresh(ctx context.Context, widgets []widget) {
+	pending := make([]chan struct{}, 0, len(widgets))
+
+	s.mu.Lock()
+	for _, widget := range widgets {
+		update, updating := s.updating[widget]
+		if !updating {
+			update = s.startUpdateLocked(widget)
+		}
+
+		pending = append(pending, update.done)
+	}
+	s.mu.Unlock()
+
+	waitForAll(ctx, pending)
+}
+
+// Waits for the updates of the given widgets that are in progress without
+// starting any, widgets that aren't being updated are returned right away
+func (s *widgetScheduler) waitForUpdating(ctx context.Context, widgets []widget) {
+	pending := make([]chan struct{}, 0, len(widgets))
+
+	s.mu.Lock()
+	for _, widget := range widgets {
+		if update, updating := s.updating[widget]; updating {
+			pending = append(pending, update.done)
+		}
+	}
+	s.mu.Unlock()
+
+	waitForAll(ctx, pending)
+}
+
+func waitForAll(ctx context.Context, pending []chan struct{}) {
+	for _, done := range pending {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *widgetScheduler) startUpdateLocked(widget widget) *widgetUpdate {
+	update := &widgetUpdate{
+		done: make(chan struct{}),
+		due:  widget.getNextUpdate(),
+	}
+	s.updating[widget] = update
+	widget.setRefreshing(true)
+
+	concurrency := s.concurrency
+	onUpdated := s.onUpdated
+
+	go func() {
+		concurrency <- struct{}{}
+
+		widget.lock()
+		widget.setStaleContent(widget.Render())
+		result := widgetUpdateResult{previousErr: widget.getError()}
+		started := time.Now()
+		widget.update(context.Background())
+		result.duration = time.Since(started)
+		if onUpdated != nil {
+			onUpdated(widget, result)
+		}
+		widget.setStaleContent("")
+		widget.setRefreshing(false)
+		widget.unlock()
+
+		<-concurrency
+
+		s.mu.Lock()
+		delete(s.updating, widget)
+		s.mu.Unlock()
+
+		close(update.done)
+	}()
+
+	return update
+}
+
+// Container widgets don't fetch anything themselves, so the widgets inside of
+// them get scheduled individually instead
+func (p *page) leafWidgets() []widget {
+	leaves := leafWidgets(p.HeadWidgets)
+
+	for c := range p.Columns {
+		leaves = append(leaves, leafWidgets(p.Columns[c].Widgets)...)
+	}
+
+	return leaves
+}
+
+func leafWidgets(list widgets) []widget {
+	leaves := make([]widget, 0, len(list))
+
+	walkWidgets(list, func(widget widget) {
+		if _, ok := widget.(widgetWithChildren); !ok {
+			leaves = append(leaves, widget)
+		}
+	})
+
+	return leaves
+}
+
+// Calls fn for every widget on the page, including the ones inside of containers
+func (p *page) walkWidgets(fn func(widget)) {
+	walkWidgets(p.HeadWidgets, fn)
+
+	for c := range p.Columns {
+		walkWidgets(p.Columns[c].Widgets, fn)
+	}
+}
+
+func walkWidgets(list widgets, fn func(widget)) {
+	for _, widget := range list {
+		fn(widget)
+
+		if container, ok := widget.(widgetWithChildren); ok {
+			walkWidgets(container.childWidgets(), fn)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package glance
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glanceapp/glance/internal/metrics"
+	"github.com/glanceapp/glance/internal/websocket"
+)
+
+type blockingTestWidget struct {
+	widgetBase
+	release chan struct{}
+	version int
+}
+
+func (widget *blockingTestWidget) initialize() error {
+	return nil
+}
+
+func (widget *blockingTestWidget) update(ctx context.Context) {
+	<-widget.release
+	widget.version++
+	widget.scheduleNextUpdate()
+}
+
+func (widget *blockingTestWidget) Render() template.HTML {
+	return template.HTML(fmt.Sprintf("v%d", widget.version))
+}
+
+func renderTestWidget(w widget) template.HTML {
+	return globalTemplateFunctions["renderWidget"].(func(widget) template.HTML)(w)
+}
+
+func newBlockingTestWidget() *blockingTestWidget {
+	widget := &blockingTestWidget{release: make(chan struct{})}
+	widget.withCacheDuration(time.Hour)
+
+	return widget
+}
+
+func TestSchedulerWaitsForWidgetsThatWereNeverUpdated(t *testing.T) {
+	testWidget := newBlockingTestWidget()
+	scheduler := newWidgetScheduler()
+	scheduler.schedule(nil, 1, time.Hour, nil)
+
+	returned := make(chan struct{})
+	go func() {
+		scheduler.refreshOutdated(context.Background(), []widget{testWidget})
+		close(returned)
+	}()
+
+	select {
+	case <-returned:
+		t.Fatal("Returned before the widget was updated for the first time")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(testWidget.release)
+	<-returned
+
+	if content := renderTestWidget(testWidget); content != "v1" {
+		t.Fatalf("Expected updated content, got %s", content)
+	}
+}
+
+func TestSchedulerShowsStaleContentWhileUpdating(t *testing.T) {
+	testWidget := newBlockingTestWidget()
+	testWidget.version = 1
+	testWidget.nextUpdate = time.Now().Add(-time.Minute)
+	scheduler := newWidgetScheduler()
+	scheduler.schedule(nil, 1, time.Hour, nil)
+
+	scheduler.refreshOutdated(context.Background(), []widget{testWidget})
+
+	if !testWidget.IsRefreshing() {
+		t.Fatal("Expected widget to be marked as refreshing")
+	}
+
+	// Wait for the update to start so that the widget is locked
+	for testWidget.getStaleContent() == "" {
+		time.Sleep(time.Millisecond)
+	}
+
+	if content := renderTestWidget(testWidget); content != "v1" {
+		t.Fatalf("Expected the content from before the update, got %s", content)
+	}
+
+	close(testWidget.release)
+	for testWidget.IsRefreshing() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if content := renderTestWidget(testWidget); content != "v2" {
+		t.Fatalf("Expected updated content, got %s", content)
+	}
+}
+
+func TestSchedulerRecordsUpdateMetrics(t *testing.T) {
+	testWidget := newBlockingTestWidget()
+	testWidget.ID = "blocking"
+	testWidget.Type = "blocking"
+	close(testWidget.release)
+
+	collector := metrics.NewCollector()
+	scheduler := newWidgetScheduler()
+	scheduler.schedule(nil, 1, time.Hour, func(w widget, result widgetUpdateResult) {
+		recordWidgetUpdateMetrics(collector, w, result.duration)
+	})
+
+	scheduler.refresh(context.Background(), []widget{testWidget})
+
+	// The test widget doesn't touch its notice when updating
+	testWidget.lock()
+	testWidget.withNotice(errPartialContent)
+	testWidget.unlock()
+	scheduler.refresh(context.Background(), []widget{testWidget})
+
+	recorded := collector.GetMetrics("blocking")
+	if recorded == nil {
+		t.Fatal("Expected metrics to be recorded for the widget")
+	}
+
+	if recorded.UpdateCount != 2 || recorded.WidgetType != "blocking" {
+		t.Errorf("Expected 2 updates of a blocking widget, got %d of %q", recorded.UpdateCount, recorded.WidgetType)
+	}
+
+	if recorded.PartialCount != 1 || recorded.LastOutcome != metrics.OutcomePartial {
+		t.Errorf("Expected the last update to be partial, got outcome %q", recorded.LastOutcome)
+	}
+
+	if recorded.ErrorCount != 0 || recorded.LastError != errPartialContent.Error() {
+		t.Errorf("Expected no errors and the notice as the last error, got %d and %q", recorded.ErrorCount, recorded.LastError)
+	}
+}
+
+func TestPageLoadedWhileRefreshingDoesNotUpdateWidgetAgain(t *testing.T) {
+	config, err := newConfigFromYAML([]byte(`
+server:
+  max-staleness: 1h
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: placeholder
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	testWidget := newBlockingTestWidget()
+	testWidget.ID = "slow"
+	testWidget.version = 1
+	testWidget.nextUpdate = time.Now().Add(-time.Minute)
+	config.Pages[0].Columns[0].Widgets[0] = testWidget
+
+	services := &sharedServices{wsHub: websocket.NewHub(), scheduler: newWidgetScheduler()}
+	app, err := newApplication(config, services, nil)
+	if err != nil {
+		t.Fatalf("Failed to create application: %v", err)
+	}
+	app.scheduleWidgets()
+	handler := app.handler()
+
+	request := func(method, path string) string {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected %s %s to succeed, got %d", method, path, recorder.Code)
+		}
+		return recorder.Body.String()
+	}
+
+	if body := request("GET", "/api/pages/home/content/"); !strings.Contains(body, "v1") {
+		t.Fatalf("Expected the page to show the content from before the update, got %s", body)
+	}
+
+	content := make(chan string)
+	go func() { content <- request("GET", "/api/widgets/slow/content") }()
+
+	close(testWidget.release)
+	if body := <-content; body != "v2" {
+		t.Errorf("Expected the widget content once its update finished, got %s", body)
+	}
+
+	// Fetched again after the update is long done, like a page whose request arrives late
+	if body := request("GET", "/api/widgets/slow/content"); body != "v2" || testWidget.version != 2 {
+		t.Errorf("Expected the widget to have been updated once, got %s after %d updates", body, testWidget.version-1)
+	}
+}
+
+func TestSchedulerOnlyUpdatesDueWidgets(t *testing.T) {
+	due := newBlockingTestWidget()
+	due.nextUpdate = time.Now().Add(-time.Minute)
+
+	notDue := newBlockingTestWidget()
+	notDue.nextUpdate = time.Now().Add(time.Minute)
+
+	infinite := newBlockingTestWidget()
+	infinite.cacheType = cacheTypeInfinite
+
+	scheduler := newWidgetScheduler()
+	scheduler.schedule([]widget{due, notDue, infinite}, 3, time.Hour, nil)
+	scheduler.updateOutdated()
+
+	if !due.IsRefreshing() {
+		t.Error("Expected the widget that is due for an update to be updated")
+	}
+
+	if notDue.IsRefreshing() || infinite.IsRefreshing() {
+		t.Error("Expected widgets that aren't due for an update to be left alone")
+	}
+
+	// A widget that's still being updated doesn't get updated a second time
+	scheduler.updateOutdated()
+	close(due.release)
+	scheduler.waitForUpdating(context.Background(), []widget{due})
+
+	if due.version != 1 {
+		t.Errorf("Expected the widget to be updated once, got %d updates", due.version)
+	}
+}
+
+func TestSchedulerLimitsConcurrentUpdates(t *testing.T) {
+	first := newBlockingTestWidget()
+	second := newBlockingTestWidget()
+
+	scheduler := newWidgetScheduler()
+	scheduler.schedule([]widget{first, second}, 1, time.Hour, nil)
+	scheduler.updateOutdated()
+
+	started := func(w *blockingTestWidget) bool {
+		return w.getStaleContent() != ""
+	}
+
+	for !started(first) && !started(second) {
+		time.Sleep(time.Millisecond)
+	}
+
+	running, waiting := first, second
+	if started(second) {
+		running, waiting = second, first
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if started(waiting) {
+		t.Fatal("Expected the second update to wait for the first one to finish")
+	}
+
+	close(running.release)
+	for !started(waiting) {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(waiting.release)
+	scheduler.waitForUpdating(context.Background(), []widget{first, second})
+}
@@ -0,0 +1,369 @@
+package glance
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+const AUTH_SESSION_TOKEN_LENGTH = 32
+
+// How long a session lasts at most, no matter how often it's used
+const AUTH_SESSION_MAX_LIFETIME = 30 * 24 * time.Hour // 30 days
+
+// How often a session gets marked as used, which also pushes back when it expires
+const AUTH_SESSION_TOUCH_INTERVAL = time.Minute
+
+const maxSessionUserAgentLength = 512
+
+var sessionsPageTemplate = mustParseTemplate("sessions.html", "document.html", "footer.html")
+
+// Sessions are stored when the database is enabled so that they can be listed and revoked,
+// otherwise the stateless tokens from generateSessionToken are used
+func (a *application) StoresSessions() bool {
+	return a.RequiresAuth && a.services.db != nil
+}
+
+// Sessions expire once they haven't been used for this long
+func (a *application) sessionLifetime() time.Duration {
+	if a.Config.Auth.IdleTimeout > 0 {
+		return time.Duration(a.Config.Auth.IdleTimeout)
+	}
+
+	return AUTH_TOKEN_VALID_PERIOD
+}
+
+// Sessions end this long after logging in even if they keep being used, so that a stolen cookie can't be used forever
+func (a *application) maxSessionLifetime() time.Duration {
+	if a.Config.Auth.MaxLifetime > 0 {
+		return time.Duration(a.Config.Auth.MaxLifetime)
+	}
+
+	return AUTH_SESSION_MAX_LIFETIME
+}
+
+// Returns when a session that was created at the given time expires if it gets used now
+func (a *application) sessionExpiry(createdAt, now time.Time) time.Time {
+	expiresAt := now.Add(a.sessionLifetime())
+	if limit := createdAt.Add(a.maxSessionLifetime()); limit.Before(expiresAt) {
+		return limit
+	}
+
+	return expiresAt
+}
+
+// Only the hash of a token is stored so that the tokens of active sessions can't be taken from the database
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *application) createStoredSession(w http.ResponseWriter, r *http.Request, username, data string) (*database.Session, error) {
+	tokenBytes := make([]byte, AUTH_SESSION_TOKEN_LENGTH)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	userAgent, _ := limitStringLength(r.UserAgent(), maxSessionUserAgentLength)
+	now := time.Now()
+
+	session := &database.Session{
+		ID:        hashSessionToken(token),
+		UserID:    username,
+		Data:      data,
+		IPAddress: a.addressOfRequest(r),
+		UserAgent: userAgent,
+		ExpiresAt: a.sessionExpiry(now, now),
+		CreatedAt: now,
+	}
+
+	if err := a.services.db.Sessions.Create(r.Context(), session); err != nil {
+		return nil, err
+	}
+
+	a.setAuthSessionCookie(w, r, token, session.ExpiresAt)
+	return session, nil
+}
+
+// Returns the session of the request or nil if it doesn't have a valid one
+func (a *application) storedSessionOfRequest(w http.ResponseWriter, r *http.Request) *database.Session {
+	token, err := r.Cookie(AUTH_SESSION_COOKIE_NAME)
+	if err != nil || token.Value == "" {
+		return nil
+	}
+
+	now := time.Now()
+	session, err := a.services.db.Sessions.Get(r.Context(), hashSessionToken(token.Value), now)
+	if err != nil {
+		log.Printf("Could not get session: %v", err)
+		return nil
+	}
+
+	// Tokens from before sessions were stored aren't accepted since they couldn't be revoked
+	if session == nil {
+		return nil
+	}
+
+	if !a.sessionUserExists(session) {
+		return nil
+	}
+
+	// Sessions from before the lifetime was capped can still be set to expire later than they should
+	if !now.Before(session.CreatedAt.Add(a.maxSessionLifetime())) {
+		return nil
+	}
+
+	if now.Sub(session.LastSeenAt) >= AUTH_SESSION_TOUCH_INTERVAL {
+		expiresAt := a.sessionExpiry(session.CreatedAt, now)
+		ip := a.addressOfRequest(r)
+
+		if err := a.services.db.Sessions.Touch(r.Context(), session.ID, ip, now, expiresAt); err != nil {
+			log.Printf("Could not update session: %v", err)
+		} else {
+			session.LastSeenAt, session.ExpiresAt, session.IPAddress = now, expiresAt, ip
+			a.setAuthSessionCookie(w, r, token.Value, expiresAt)
+		}
+	}
+
+	return session
+}
+
+// Users that log in through the OpenID provider aren't listed in the config, so their sessions stay
+// valid for as long as the provider they came from is configured and they're in one of the allowed groups
+func (a *application) sessionUserExists(session *database.Session) bool {
+	if strings.HasPrefix(session.UserID, oidcSessionUserIDPrefix) {
+		data, ok := parseOIDCSessionData(session.Data)
+		provider := a.Config.Auth.OIDC
+
+		return ok && provider != nil && data.Issuer == provider.Issuer && provider.allowsGroups(data.Groups)
+	}
+
+	_, exists := a.Config.Auth.Users[session.UserID]
+	return exists
+}
+
+// Returns the name of the user a session belongs to, which isn't its user ID for users of the OpenID provider
+func sessionUsername(session *database.Session) string {
+	if data, ok := parseOIDCSessionData(session.Data); ok && strings.HasPrefix(session.UserID, oidcSessionUserIDPrefix) {
+		return data.Username
+	}
+
+	return session.UserID
+}
+
+func (a *application) deleteSessionOfRequest(r *http.Request) {
+	token, err := r.Cookie(AUTH_SESSION_COOKIE_NAME)
+	if err != nil || token.Value == "" {
+		return
+	}
+
+	if err := a.services.db.Sessions.Delete(r.Context(), hashSessionToken(token.Value)); err != nil {
+		log.Printf("Could not delete session: %v", err)
+	}
+}
+
+type sessionsPageData struct {
+	templateData
+	Username string
+	Sessions []sessionListItem
+}
+
+type sessionListItem struct {
+	database.Session
+	Device     string
+	SignedIn   string
+	LastActive string
+	Current    bool
+}
+
+func (a *application) handleSessionsPageRequest(w http.ResponseWriter, r *http.Request) {
+	current := a.storedSessionOfRequest(w, r)
+	if current == nil {
+		http.Redirect(w, r, a.Config.Server.BaseURL+"/login", http.StatusSeeOther)
+		return
+	}
+
+	sessions, err := a.services.db.Sessions.ListForUser(r.Context(), current.UserID, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list sessions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data := &sessionsPageData{
+		templateData: templateData{App: a},
+		Username:     sessionUsername(current),
+		Sessions:     make([]sessionListItem, 0, len(sessions)),
+	}
+	a.populateTemplateRequestData(&data.Request, r)
+
+	now := time.Now()
+	for i := range sessions {
+		data.Sessions = append(data.Sessions, sessionListItem{
+			Session:    sessions[i],
+			Device:     describeUserAgent(sessions[i].UserAgent),
+			SignedIn:   formatTimeAgo(sessions[i].CreatedAt, now),
+			LastActive: formatTimeAgo(sessions[i].LastSeenAt, now),
+			Current:    sessions[i].ID == current.ID,
+		})
+	}
+
+	// The session of the device that's looking at the list comes first
+	slices.SortStableFunc(data.Sessions, func(a, b sessionListItem) int {
+		return ternary(a.Current, 0, 1) - ternary(b.Current, 0, 1)
+	})
+
+	var responseBytes bytes.Buffer
+	if err := sessionsPageTemplate.Execute(&responseBytes, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Write(responseBytes.Bytes())
+}
+
+func (a *application) handleRevokeSessionRequest(w http.ResponseWriter, r *http.Request) {
+	current := a.storedSessionOfRequest(w, r)
+	if current == nil {
+		http.Redirect(w, r, a.Config.Server.BaseURL+"/login", http.StatusSeeOther)
+		return
+	}
+
+	id := r.PathValue("id")
+	session, err := a.services.db.Sessions.Get(r.Context(), id, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Sessions of other users are treated the same as ones that don't exist
+	if session == nil || session.UserID != current.UserID {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := a.services.db.Sessions.Delete(r.Context(), id); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to revoke session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	recordActivity(a.services.db, activityEvent{
+		Type:      activitySessionsRevoked,
+		Message:   fmt.Sprintf("User '%s' logged out a session on %s", sessionUsername(current), describeUserAgent(session.UserAgent)),
+		User:      sessionUsername(current),
+		IPAddress: a.addressOfRequest(r),
+	})
+
+	if id == current.ID {
+		a.setAuthSessionCookie(w, r, "", time.Now().Add(-1*time.Hour))
+		http.Redirect(w, r, a.Config.Server.BaseURL+"/login", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, a.Config.Server.BaseURL+"/sessions", http.StatusSeeOther)
+}
+
+func (a *application) handleRevokeAllSessionsRequest(w http.ResponseWriter, r *http.Request) {
+	current := a.storedSessionOfRequest(w, r)
+	if current == nil {
+		http.Redirect(w, r, a.Config.Server.BaseURL+"/login", http.StatusSeeOther)
+		return
+	}
+
+	revoked, err := a.services.db.Sessions.DeleteForUser(r.Context(), current.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to revoke sessions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	recordActivity(a.services.db, activityEvent{
+		Type:      activitySessionsRevoked,
+		Level:     activityLevelWarning,
+		Message:   fmt.Sprintf("User '%s' logged out everywhere, ending %d session(s)", sessionUsername(current), revoked),
+		User:      sessionUsername(current),
+		IPAddress: a.addressOfRequest(r),
+	})
+
+	a.setAuthSessionCookie(w, r, "", time.Now().Add(-1*time.Hour))
+	http.Redirect(w, r, a.Config.Server.BaseURL+"/login", http.StatusSeeOther)
+}
+
+func formatTimeAgo(t, now time.Time) string {
+	elapsed := now.Sub(t)
+
+	switch {
+	case elapsed < AUTH_SESSION_TOUCH_INTERVAL:
+		return "just now"
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm ago", int(elapsed.Minutes()))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(elapsed.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(elapsed.Hours()/24))
+	}
+}
+
+var userAgentBrowsers = []struct{ token, name string }{
+	// Order matters since most browsers also claim to be the ones they're based on
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Vivaldi/", "Vivaldi"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+}
+
+var userAgentSystems = []struct{ token, name string }{
+	{"Android", "Android"},
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// Returns a short description of the device a session is used from, such as "Firefox on Linux"
+func describeUserAgent(userAgent string) string {
+	var browser, system string
+
+	for _, candidate := range userAgentBrowsers {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	for _, candidate := range userAgentSystems {
+		if strings.Contains(userAgent, candidate.token) {
+			system = candidate.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	case userAgent != "":
+		browser, _ = limitStringLength(userAgent, 40)
+		return browser
+	default:
+		return "Unknown device"
+	}
+}
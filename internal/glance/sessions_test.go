@@ -0,0 +1,142 @@
+package glance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+	"github.com/glanceapp/glance/internal/websocket"
+)
+
+func TestStoredSessionsCanBeRevoked(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	secret, _ := makeAuthSecretKey(AUTH_SECRET_KEY_LENGTH)
+	config, err := newConfigFromYAML([]byte(`
+auth:
+  secret-key: ` + secret + `
+  idle-timeout: 1h
+  users:
+    admin:
+      password: hunter22
+database:
+  enabled: true
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: hello
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	services := &sharedServices{db: db, wsHub: websocket.NewHub(), scheduler: newWidgetScheduler()}
+	app, err := newApplication(config, services, nil)
+	if err != nil {
+		t.Fatalf("Failed to create application: %v", err)
+	}
+	handler := app.handler()
+
+	login := func(userAgent string) *http.Cookie {
+		t.Helper()
+		request := httptest.NewRequest("POST", "/api/authenticate", strings.NewReader(`{"username":"admin","password":"hunter22"}`))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("User-Agent", userAgent)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected logging in to succeed, got %d", recorder.Code)
+		}
+
+		return recorder.Result().Cookies()[0]
+	}
+
+	request := func(method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		request := httptest.NewRequest(method, path, nil)
+		request.AddCookie(cookie)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	laptop := login("Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+	phone := login("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Version/17.0 Mobile/15E148 Safari/604.1")
+
+	page := request("GET", "/sessions", laptop)
+	if page.Code != http.StatusOK {
+		t.Fatalf("Expected the sessions page to be shown, got %d", page.Code)
+	}
+
+	if body := page.Body.String(); !strings.Contains(body, "Firefox on Linux") || !strings.Contains(body, "Safari on iPhone") {
+		t.Errorf("Expected both sessions to be listed, got:\n%s", body)
+	}
+
+	phoneID := hashSessionToken(phone.Value)
+	if response := request("POST", "/sessions/"+phoneID+"/revoke", laptop); response.Code != http.StatusSeeOther {
+		t.Fatalf("Expected revoking the session to redirect, got %d", response.Code)
+	}
+
+	if !app.isAuthorized(httptest.NewRecorder(), withCookie(laptop)) || app.isAuthorized(httptest.NewRecorder(), withCookie(phone)) {
+		t.Fatal("Expected only the revoked session to be logged out")
+	}
+
+	// Has to be used within the idle timeout to stay valid
+	laptopID := hashSessionToken(laptop.Value)
+	if err := db.Sessions.Touch(t.Context(), laptopID, "", time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("Failed to update session: %v", err)
+	}
+
+	if app.isAuthorized(httptest.NewRecorder(), withCookie(laptop)) {
+		t.Error("Expected the idle session to have expired")
+	}
+
+	// Sessions end after the maximum lifetime even if they keep being used
+	oldToken := "old-session-token"
+	if err := db.Sessions.Create(t.Context(), &database.Session{
+		ID:        hashSessionToken(oldToken),
+		UserID:    "admin",
+		ExpiresAt: time.Now().Add(time.Hour),
+		CreatedAt: time.Now().Add(-AUTH_SESSION_MAX_LIFETIME),
+	}); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	if app.isAuthorized(httptest.NewRecorder(), withCookie(&http.Cookie{Name: AUTH_SESSION_COOKIE_NAME, Value: oldToken})) {
+		t.Error("Expected sessions older than the maximum lifetime to be rejected")
+	}
+
+	// Can't be revoked, so they aren't accepted once sessions are stored
+	legacyToken, _ := generateSessionToken("admin", app.authSecretKey, time.Now())
+	if app.isAuthorized(httptest.NewRecorder(), withCookie(&http.Cookie{Name: AUTH_SESSION_COOKIE_NAME, Value: legacyToken})) {
+		t.Error("Expected stateless tokens to be rejected")
+	}
+
+	desktop := login("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/126.0 Safari/537.36")
+	if response := request("POST", "/sessions/revoke-all", desktop); response.Code != http.StatusSeeOther {
+		t.Fatalf("Expected logging out everywhere to redirect, got %d", response.Code)
+	}
+
+	if sessions, _ := db.Sessions.ListForUser(t.Context(), "admin", time.Now()); len(sessions) != 0 {
+		t.Errorf("Expected no sessions to be left, got %d", len(sessions))
+	}
+}
+
+func withCookie(cookie *http.Cookie) *http.Request {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.AddCookie(cookie)
+	return request
+}
@@ -33,23 +33,6 @@ const lang = {
     unknownError: "An error occurred, please try again",
 };
 
-container.clearStyles("display");
-setTimeout(() => usernameInput.focus(), 200);
-
-toggleVisibilityButton
-    .html(showPasswordSVG)
-    .attr("title", lang.showPassword)
-    .on("click", function() {
-        if (passwordInput.type === "password") {
-            passwordInput.type = "text";
-            toggleVisibilityButton.html(hidePasswordSVG).attr("title", lang.hidePassword);
-            return;
-        }
-
-        passwordInput.type = "password";
-        toggleVisibilityButton.html(showPasswordSVG).attr("title", lang.showPassword);
-    });
-
 function enableLoginButtonIfCriteriaMet() {
     const usernameValue = usernameInput.value.trim();
     const passwordValue = passwordInput.value.trim();
@@ -70,9 +53,6 @@ function enableLoginButtonIfCriteriaMet() {
     );
 }
 
-usernameInput.on("input", enableLoginButtonIfCriteriaMet);
-passwordInput.on("input", enableLoginButtonIfCriteriaMet);
-
 async function handleLoginAttempt() {
     state.lastUsername = usernameInput.value;
     state.lastPassword = passwordInput.value;
@@ -125,4 +105,28 @@ async function handleLoginAttempt() {
     }
 }
 
-loginButton.disable().on("click", handleLoginAttempt);
+container.clearStyles("display");
+
+// The password form is left out when only the OpenID provider is configured
+if (usernameInput !== null) {
+    setTimeout(() => usernameInput.focus(), 200);
+
+    toggleVisibilityButton
+        .html(showPasswordSVG)
+        .attr("title", lang.showPassword)
+        .on("click", function() {
+            if (passwordInput.type === "password") {
+                passwordInput.type = "text";
+                toggleVisibilityButton.html(hidePasswordSVG).attr("title", lang.hidePassword);
+                return;
+            }
+
+            passwordInput.type = "password";
+            toggleVisibilityButton.html(showPasswordSVG).attr("title", lang.showPassword);
+        });
+
+    usernameInput.on("input", enableLoginButtonIfCriteriaMet);
+    passwordInput.on("input", enableLoginButtonIfCriteriaMet);
+
+    loginButton.disable().on("click", handleLoginAttempt);
+}
@@ -12,8 +12,8 @@ async function fetchPageContent(pageData) {
     return content;
 }
 
-function setupCarousels() {
-    const carouselElements = document.getElementsByClassName("carousel-container");
+function setupCarousels(root = document) {
+    const carouselElements = root.getElementsByClassName("carousel-container");
 
     if (carouselElements.length == 0) {
         return;
@@ -95,8 +95,8 @@ function updateRelativeTimeForElements(elements)
     }
 }
 
-function setupSearchBoxes() {
-    const searchWidgets = document.getElementsByClassName("search");
+function setupSearchBoxes(root = document) {
+    const searchWidgets = root.getElementsByClassName("search");
 
     if (searchWidgets.length == 0) {
         return;
@@ -206,8 +206,8 @@ function setupSearchBoxes() {
     }
 }
 
-function setupDynamicRelativeTime() {
-    const elements = document.querySelectorAll("[data-dynamic-relative-time]");
+function setupDynamicRelativeTime(root = document) {
+    const elements = root.querySelectorAll("[data-dynamic-relative-time]");
     const updateInterval = 60 * 1000;
     let lastUpdateTime = Date.now();
 
@@ -308,8 +308,8 @@ function setupGroups() {
     }
 }
 
-function setupLazyImages() {
-    const images = document.querySelectorAll("img[loading=lazy]");
+function setupLazyImages(root = document) {
+    const images = root.querySelectorAll("img[loading=lazy]");
 
     if (images.length == 0) {
         return;
@@ -383,8 +383,8 @@ function attachExpandToggleButton(collapsibleContainer) {
 };
 
 
-function setupCollapsibleLists() {
-    const collapsibleLists = document.querySelectorAll(".list.collapsible-container");
+function setupCollapsibleLists(root = document) {
+    const collapsibleLists = root.querySelectorAll(".list.collapsible-container");
 
     if (collapsibleLists.length == 0) {
         return;
@@ -417,8 +417,8 @@ function setupCollapsibleLists() {
     }
 }
 
-function setupCollapsibleGrids() {
-    const collapsibleGridElements = document.querySelectorAll(".cards-grid.collapsible-container");
+function setupCollapsibleGrids(root = document) {
+    const collapsibleGridElements = root.querySelectorAll(".cards-grid.collapsible-container");
 
     if (collapsibleGridElements.length == 0) {
         return;
@@ -570,8 +570,8 @@ function zoneDiffText(diffInMinutes) {
     return { text: `${sign}${hours}h~`, title: `${hours} hour${hourSuffix} and ${minutes} minutes ${signText}` };
 }
 
-function setupClocks() {
-    const clocks = document.getElementsByClassName('clock');
+function setupClocks(root = document) {
+    const clocks = root.getElementsByClassName('clock');
 
     if (clocks.length == 0) {
         return;
@@ -631,8 +631,8 @@ function setupClocks() {
     updateClocks();
 }
 
-async function setupCalendars() {
-    const elems = document.getElementsByClassName("calendar");
+async function setupCalendars(root = document) {
+    const elems = root.getElementsByClassName("calendar");
     if (elems.length == 0) return;
 
     // TODO: implement prefetching, currently loads as a nasty waterfall of requests
@@ -642,8 +642,8 @@ async function setupCalendars() {
         calendar.default(elems[i]);
 }
 
-async function setupTodos() {
-    const elems = Array.from(document.getElementsByClassName("todo"));
+async function setupTodos(root = document) {
+    const elems = Array.from(root.getElementsByClassName("todo"));
     if (elems.length == 0) return;
 
     const todo = await import ('./todo.js');
@@ -653,8 +653,8 @@ async function setupTodos() {
     }
 }
 
-function setupTruncatedElementTitles() {
-    const elements = document.querySelectorAll(".text-truncate, .single-line-titles .title, .text-truncate-2-lines, .text-truncate-3-lines");
+function setupTruncatedElementTitles(root = document) {
+    const elements = root.querySelectorAll(".text-truncate, .single-line-titles .title, .text-truncate-2-lines, .text-truncate-3-lines");
 
     if (elements.length == 0) {
         return;
@@ -743,6 +743,46 @@ function initThemePicker() {
     })
 }
 
+async function setupWidgetContent(root) {
+    setupPopovers(root);
+    setupClocks(root);
+    await setupCalendars(root);
+    await setupTodos(root);
+    setupCarousels(root);
+    setupSearchBoxes(root);
+    setupCollapsibleLists(root);
+    setupCollapsibleGrids(root);
+    setupDynamicRelativeTime(root);
+    setupLazyImages(root);
+    setupTruncatedElementTitles(root);
+}
+
+// Widgets that were being updated when the page was loaded show what they displayed
+// before the update, so they get swapped for their updated content once it's done
+async function refreshStaleWidgets() {
+    const widgets = document.querySelectorAll(".widget-refreshing[data-widget-id]");
+
+    await Promise.all(Array.from(widgets).map(async (widget) => {
+        const response = await fetch(`${pageData.baseURL}/api/widgets/${widget.dataset.widgetId}/content`);
+
+        if (response.status != 200) {
+            widget.classList.remove("widget-refreshing");
+            return;
+        }
+
+        const template = document.createElement("template");
+        template.innerHTML = await response.text();
+        const updated = template.content.firstElementChild;
+
+        // The element itself is kept since masonry layouts hold on to it
+        widget.className = updated.className;
+        widget.removeAttribute("data-widget-id");
+        widget.replaceChildren(...updated.childNodes);
+
+        await setupWidgetContent(widget);
+    }));
+}
+
 async function setupPage() {
     initThemePicker();
 
@@ -781,6 +821,8 @@ async function setupPage() {
             document.body.classList.add("page-columns-transitioned");
         }, 300);
     }
+
+    refreshStaleWidgets();
 }
 
 setupPage();
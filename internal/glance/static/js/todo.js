@@ -6,9 +6,14 @@ const trashIconSvg = `<svg fill="currentColor" xmlns="http://www.w3.org/2000/svg
   <path fill-rule="evenodd" d="M5 3.25V4H2.75a.75.75 0 0 0 0 1.5h.3l.815 8.15A1.5 1.5 0 0 0 5.357 15h5.285a1.5 1.5 0 0 0 1.493-1.35l.815-8.15h.3a.75.75 0 0 0 0-1.5H11v-.75A2.25 2.25 0 0 0 8.75 1h-1.5A2.25 2.25 0 0 0 5 3.25Zm2.25-.75a.75.75 0 0 0-.75.75V4h3v-.75a.75.75 0 0 0-.75-.75h-1.5ZM6.05 6a.75.75 0 0 1 .787.713l.275 5.5a.75.75 0 0 1-1.498.075l-.275-5.5A.75.75 0 0 1 6.05 6Zm3.9 0a.75.75 0 0 1 .712.787l-.275 5.5a.75.75 0 0 1-1.498-.075l.275-5.5a.75.75 0 0 1 .786-.711Z" clip-rule="evenodd" />
 </svg>`;
 
+const SYNC_POLL_INTERVAL = 30 * 1000;
+const SYNC_MAX_CONFLICT_RETRIES = 3;
+
 export default function(element) {
+    const id = element.dataset.todoId;
+
     element.swapWith(
-        Todo(element.dataset.todoId)
+        Todo(element.dataset.todoSync === "true" ? serverStore(id) : localStore(id))
     )
 }
 
@@ -45,10 +50,172 @@ function saveToLocalStorage(id, data) {
     localStorage.setItem(`todo-${id}`, JSON.stringify(data));
 }
 
+function newItemID() {
+    return Date.now().toString(36) + Math.random().toString(36).slice(2, 8);
+}
+
+function withIDs(items) {
+    return items.map(item => item.id ? item : { ...item, id: newItemID() });
+}
+
+function sameItem(a, b) {
+    return a !== undefined && b !== undefined && a.text === b.text && a.checked === b.checked;
+}
+
+// Three-way merge of items based on their IDs, local changes win over remote
+// ones and items deleted on either side stay deleted
+function mergeItems(base, local, remote) {
+    const baseByID = new Map(base.map(item => [item.id, item]));
+    const localByID = new Map(local.map(item => [item.id, item]));
+    const remoteIDs = new Set(remote.map(item => item.id));
+    const merged = [];
+
+    for (const remoteItem of remote) {
+        const baseItem = baseByID.get(remoteItem.id);
+        const localItem = localByID.get(remoteItem.id);
+
+        if (baseItem !== undefined && localItem === undefined) continue;
+        merged.push(localItem !== undefined && !sameItem(localItem, baseItem) ? localItem : remoteItem);
+    }
+
+    for (const localItem of local)
+        if (!baseByID.has(localItem.id) && !remoteIDs.has(localItem.id))
+            merged.push(localItem);
+
+    return merged;
+}
+
+function localStore(id) {
+    return {
+        initial: withIDs(loadFromLocalStorage(id)),
+        start: () => {},
+        save: (items) => saveToLocalStorage(id, items),
+    };
+}
+
+// Keeps the tasks in the database through the widget data API. Writes are
+// conditional on the last known revision, when another browser got there first
+// the server responds with its copy which gets merged with ours before retrying.
+function serverStore(id) {
+    const dataEndpoint = `${pageData.baseURL}/api/v1/widgets/${encodeURIComponent(id)}/data`;
+    const itemsEndpoint = `${dataEndpoint}/items`;
+
+    let revision = 0;
+    let base = [];
+    let queued = null;
+    let inFlight = null;
+    let onRemoteItems;
+
+    const fetchRemote = async () => {
+        const response = await fetch(itemsEndpoint);
+        if (response.status === 404) return { items: [], revision: 0 };
+        if (!response.ok) throw new Error(`loading to-do items failed with status ${response.status}`);
+
+        const data = await response.json();
+        return { items: withIDs(data.value || []), revision: data.revision };
+    };
+
+    const send = async (items) => {
+        let local = items;
+
+        for (let i = 0; i < SYNC_MAX_CONFLICT_RETRIES; i++) {
+            const response = await fetch(dataEndpoint, {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify({ key: "items", type: "to-do", value: local, revision }),
+            });
+
+            if (response.ok) {
+                revision = (await response.json()).revision;
+                base = local;
+                if (local !== items) onRemoteItems(local);
+                return;
+            }
+
+            if (response.status !== 409)
+                throw new Error(`saving to-do items failed with status ${response.status}`);
+
+            const current = await response.json();
+            const remote = withIDs(current.value || []);
+            local = mergeItems(base, local, remote);
+            base = remote;
+            revision = current.revision;
+        }
+
+        throw new Error("saving to-do items failed due to too many conflicting changes");
+    };
+
+    const flush = async () => {
+        try {
+            while (queued !== null) {
+                const items = queued;
+                queued = null;
+                await send(items);
+            }
+        } catch (error) {
+            console.error(error);
+        } finally {
+            inFlight = null;
+        }
+    };
+
+    const save = (items) => {
+        queued = items;
+        if (inFlight === null) inFlight = flush();
+    };
+
+    const refresh = async (canApply) => {
+        if (inFlight !== null || queued !== null) return;
+
+        try {
+            const remote = await fetchRemote();
+            if (remote.revision === revision || inFlight !== null || !canApply()) return;
+
+            revision = remote.revision;
+            base = remote.items;
+            onRemoteItems(remote.items);
+        } catch (error) {
+            console.error(error);
+        }
+    };
+
+    const start = async (applyRemoteItems, canApply) => {
+        onRemoteItems = applyRemoteItems;
+
+        try {
+            const remote = await fetchRemote();
+            revision = remote.revision;
+            base = remote.items;
+            onRemoteItems(remote.items);
+
+            // One-time import of a list that was previously only kept in this browser
+            const legacy = loadFromLocalStorage(id);
+            if (legacy.length > 0) {
+                save(mergeItems([], withIDs(legacy), remote.items));
+                await inFlight;
+                if (queued === null) localStorage.removeItem(`todo-${id}`);
+            }
+        } catch (error) {
+            console.error(error);
+        }
+
+        setInterval(() => {
+            if (document.visibilityState === "visible") refresh(canApply);
+        }, SYNC_POLL_INTERVAL);
+
+        document.addEventListener("visibilitychange", () => {
+            if (document.visibilityState === "visible") refresh(canApply);
+        });
+    };
+
+    return { initial: [], start, save };
+}
+
 function Item(unserialize = {}, onUpdate, onDelete, onEscape, onDragStart) {
     let item, input, inputArea;
 
     const serializeable = {
+        id: unserialize.id || newItemID(),
         text: unserialize.text || "",
         checked: unserialize.checked || false
     };
@@ -101,11 +268,12 @@ function Item(unserialize = {}, onUpdate, onDelete, onEscape, onDragStart) {
     });
 }
 
-function Todo(id) {
+function Todo(store) {
     let items, input, inputArea, inputContainer, lastAddedItem;
     let queuedForRemoval = 0;
     let reorderable;
     let isDragging = false;
+    let hasUnsavedChanges = false;
 
     const onDragEnd = () => isDragging = false;
     const onDragStart = (event, element) => {
@@ -116,13 +284,16 @@ function Todo(id) {
     const saveItems = () => {
         if (isDragging) return;
 
-        saveToLocalStorage(
-            id, items.children.map(item => item.component.serialize())
-        );
+        hasUnsavedChanges = false;
+        store.save(items.children.map(item => item.component.serialize()));
     };
 
     const onItemRepositioned = () => saveItems();
-    const debouncedOnItemUpdate = throttledDebounce(saveItems, 10, 1000);
+    const throttledSaveItems = throttledDebounce(saveItems, 10, 1000);
+    const debouncedOnItemUpdate = () => {
+        hasUnsavedChanges = true;
+        throttledSaveItems();
+    };
 
     const onItemDelete = (item) => {
         if (lastAddedItem === item) lastAddedItem = null;
@@ -179,13 +350,27 @@ function Todo(id) {
         }
     };
 
+    const setItems = (list) => {
+        lastAddedItem = null;
+        items.replaceChildren(...list.map(data => newItem(data)));
+        inputContainer.getAnimations().forEach(animation => animation.cancel());
+        inputContainer.classesIf(list.length > 0, "margin-bottom-15");
+    };
+
+    // Remote changes are not applied while the user is in the middle of editing
+    // since that would throw away what they're typing, they get merged on save instead
+    const canApplyRemoteItems = () => !isDragging
+        && !hasUnsavedChanges
+        && queuedForRemoval === 0
+        && !items.contains(document.activeElement);
+
     items = elem()
         .classes("todo-items")
         .append(
-            ...loadFromLocalStorage(id).map(data => newItem(data))
+            ...store.initial.map(data => newItem(data))
         );
 
-    return fragment().append(
+    const todo = fragment().append(
         inputContainer = elem()
             .classes("todo-input", "flex", "gap-10", "items-center")
             .classesIf(items.children.length > 0, "margin-bottom-15")
@@ -203,6 +388,10 @@ function Todo(id) {
 
         reorderable = verticallyReorderable(items, onItemRepositioned, onDragEnd),
     );
+
+    store.start(setItems, canApplyRemoteItems);
+
+    return todo;
 }
 
 
@@ -13,6 +13,21 @@ import (
 var intl = message.NewPrinter(language.English)
 
 var globalTemplateFunctions = template.FuncMap{
+	// Widgets have to be rendered through this rather than by calling Render
+	// directly so that they don't get rendered while being updated, in which
+	// case what they rendered right before the update started is used instead
+	"renderWidget": func(w widget) template.HTML {
+		if !w.tryLock() {
+			if stale := w.getStaleContent(); stale != "" {
+				return stale
+			}
+
+			w.lock()
+		}
+		defer w.unlock()
+
+		return w.Render()
+	},
 	"formatApproxNumber": formatApproxNumber,
 	"formatNumber":       intl.Sprint,
 	"safeCSS": func(str string) template.CSS {
@@ -2,6 +2,7 @@ package glance
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"math"
@@ -245,3 +246,9 @@ func hslToHex(h, s, l float64) string {
 
 	return fmt.Sprintf("#%02x%02x%02x", ir, ig, ib)
 }
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -2,159 +2,93 @@ package glance
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"html/template"
-	"net/http"
 	"time"
+
+	"github.com/glanceapp/glance/internal/database"
 )
 
+var activityLogWidgetTemplate = mustParseTemplate("activity-log.html", "widget-base.html")
+
 type activityLogWidget struct {
-	widgetBase
-	Limit int `yaml:"limit"`
+	widgetBase    `yaml:",inline"`
+	Limit         int                `yaml:"limit"`
+	CollapseAfter int                `yaml:"collapse-after"`
+	EventTypes    []string           `yaml:"event-types"`
+	WidgetID      string             `yaml:"widget-id"`
+	MaxAge        durationField      `yaml:"max-age"`
+	Entries       []activityLogEntry `yaml:"-"`
 }
 
-type activity struct {
-	ID        string    `json:"id"`
-	EventType string    `json:"event_type"`
-	Widget    string    `json:"widget"`
-	Timestamp time.Time `json:"timestamp"`
-	Details   string    `json:"details"`
+type activityLogEntry struct {
+	EventType string
+	WidgetID  string
+	Message   string
+	Level     string
+	CreatedAt time.Time
 }
 
-func (w *activityLogWidget) initialize() error {
-	if w.Limit == 0 {
-		w.Limit = 10
+func (widget *activityLogWidget) initialize() error {
+	widget.withTitle("Activity Log").withCacheDuration(30 * time.Second)
+
+	if widget.Limit <= 0 {
+		widget.Limit = 10
+	}
+
+	if widget.CollapseAfter == 0 || widget.CollapseAfter < -1 {
+		widget.CollapseAfter = 5
 	}
-	w.Title = "Activity Log"
-	w.cacheDuration = 10 * time.Second
-	w.cacheType = cacheTypeDuration
+
 	return nil
 }
 
-func (w *activityLogWidget) update(ctx context.Context) {
-	resp, err := http.Get(fmt.Sprintf("http://localhost:8080/api/v1/activity?limit=%d", w.Limit))
-	if err != nil {
-		w.Error = err
+func (widget *activityLogWidget) update(ctx context.Context) {
+	if widget.Providers == nil || widget.Providers.db == nil {
+		widget.withError(errors.New("the activity log requires the database to be enabled"))
+		widget.scheduleNextUpdate()
 		return
 	}
-	defer resp.Body.Close()
 
-	var activities []activity
-	if err := json.NewDecoder(resp.Body).Decode(&activities); err != nil {
-		w.Error = err
+	filter := database.ActivityFilter{
+		EventTypes: widget.EventTypes,
+		WidgetID:   widget.WidgetID,
+		Limit:      widget.Limit,
+	}
+
+	if widget.MaxAge > 0 {
+		filter.Since = time.Now().Add(-time.Duration(widget.MaxAge))
+	}
+
+	logs, err := widget.Providers.db.Activity.List(ctx, filter)
+	if !widget.canContinueUpdateAfterHandlingErr(err) {
 		return
 	}
 
-	w.renderActivity(activities)
-	w.ContentAvailable = true
-}
+	entries := make([]activityLogEntry, 0, len(logs))
+	for i := range logs {
+		entry := activityLogEntry{
+			EventType: logs[i].EventType,
+			WidgetID:  logs[i].WidgetID,
+			Message:   logs[i].EventType,
+			Level:     activityLevelInfo,
+			CreatedAt: logs[i].CreatedAt,
+		}
 
-func (w *activityLogWidget) renderActivity(activities []activity) {
-	tmpl := template.Must(template.New("activity").Parse(`
-		<div class="activity-log">
-			{{range .Activities}}
-			<div class="activity-item {{.EventType}}">
-				<div class="activity-header">
-					<span class="activity-type">{{.EventType}}</span>
-					<span class="activity-time" title="{{.Timestamp.Format "Mon Jan 02 15:04:05"}}">
-						{{.Timestamp.Format "15:04"}}
-					</span>
-				</div>
-				<div class="activity-widget">{{.Widget}}</div>
-				<div class="activity-details">{{.Details}}</div>
-			</div>
-			{{end}}
-		</div>
-		<style>
-			.activity-log {
-				padding: 0.5rem;
-				max-height: 400px;
-				overflow-y: auto;
-			}
-			.activity-item {
-				padding: 0.75rem;
-				margin: 0.5rem 0;
-				border-left: 3px solid rgba(255,255,255,0.2);
-				border-radius: 4px;
-				background: rgba(0,0,0,0.2);
-				font-size: 0.85rem;
-			}
-			.activity-item.error {
-				border-left-color: #ff6b6b;
-				background: rgba(255,107,107,0.1);
-			}
-			.activity-item.success {
-				border-left-color: #51cf66;
-				background: rgba(81,207,102,0.1);
-			}
-			.activity-item.warning {
-				border-left-color: #ffd43b;
-				background: rgba(255,212,59,0.1);
-			}
-			.activity-item.info {
-				border-left-color: #4dabf7;
-				background: rgba(77,171,247,0.1);
-			}
-			.activity-header {
-				display: flex;
-				justify-content: space-between;
-				align-items: center;
-				margin-bottom: 0.25rem;
-			}
-			.activity-type {
-				font-weight: bold;
-				text-transform: uppercase;
-				font-size: 0.75rem;
-			}
-			.activity-item.error .activity-type {
-				color: #ff6b6b;
-			}
-			.activity-item.success .activity-type {
-				color: #51cf66;
-			}
-			.activity-item.warning .activity-type {
-				color: #ffd43b;
-			}
-			.activity-item.info .activity-type {
-				color: #4dabf7;
-			}
-			.activity-time {
-				font-size: 0.75rem;
-				opacity: 0.7;
-			}
-			.activity-widget {
-				font-weight: 600;
-				margin: 0.25rem 0;
-				color: var(--primary-color, #00ff00);
-			}
-			.activity-details {
-				opacity: 0.8;
-				font-size: 0.8rem;
-				margin-top: 0.25rem;
-			}
-		</style>
-	`))
-
-	w.templateBuffer.Reset()
-	tmpl.Execute(&w.templateBuffer, map[string]interface{}{
-		"Activities": activities,
-	})
-}
+		if message, ok := logs[i].Details["message"].(string); ok && message != "" {
+			entry.Message = message
+		}
 
-func (w *activityLogWidget) Render() template.HTML {
-	return template.HTML(w.templateBuffer.String())
-}
+		if level, ok := logs[i].Details["level"].(string); ok && level != "" {
+			entry.Level = level
+		}
 
-func (w *activityLogWidget) GetType() string {
-	return "activity-log"
-}
+		entries = append(entries, entry)
+	}
 
-func (w *activityLogWidget) handleRequest(wr http.ResponseWriter, r *http.Request) {
-	wr.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(wr).Encode(map[string]string{"status": "ok"})
+	widget.Entries = entries
 }
 
-func (w *activityLogWidget) setHideHeader(b bool) {
-	w.HideHeader = b
+func (widget *activityLogWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, activityLogWidgetTemplate)
 }
@@ -9,7 +9,7 @@ import (
 )
 
 type advancedSearchWidget struct {
-	widgetBase
+	widgetBase `yaml:",inline"`
 	Placeholder string `yaml:"placeholder"`
 }
 
@@ -69,6 +69,10 @@ func (widget *changeDetectionWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, changeDetectionWidgetTemplate)
 }
 
+func (widget *changeDetectionWidget) snapshotData() any {
+	return &widget.ChangeDetections
+}
+
 type changeDetectionWatch struct {
 	Title        string
 	URL          string
@@ -6,6 +6,10 @@ import (
 	"time"
 )
 
+type widgetWithChildren interface {
+	childWidgets() widgets
+}
+
 type containerWidgetBase struct {
 	Widgets widgets `yaml:"widgets"`
 }
@@ -41,6 +45,10 @@ func (widget *containerWidgetBase) _update(ctx context.Context) {
 	wg.Wait()
 }
 
+func (widget *containerWidgetBase) childWidgets() widgets {
+	return widget.Widgets
+}
+
 func (widget *containerWidgetBase) _setProviders(providers *widgetProviders) {
 	for i := range widget.Widgets {
 		widget.Widgets[i].setProviders(providers)
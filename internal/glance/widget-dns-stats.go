@@ -14,6 +14,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/glanceapp/glance/internal/database"
 )
 
 var dnsStatsWidgetTemplate = mustParseTemplate("dns-stats.html", "widget-base.html")
@@ -42,6 +44,11 @@ type dnsStatsWidget struct {
 	Password       string `yaml:"password"`
 }
 
+const (
+	dnsBlockingEnabled  = "enabled"
+	dnsBlockingDisabled = "disabled"
+)
+
 const (
 	dnsServiceAdguard    = "adguard"
 	dnsServicePihole     = "pihole"
@@ -123,6 +130,17 @@ func (widget *dnsStatsWidget) update(ctx context.Context) {
 	widget.Stats = stats
 }
 
+func (widget *dnsStatsWidget) historySamples() []database.MetricSample {
+	if widget.Stats == nil {
+		return nil
+	}
+
+	return []database.MetricSample{
+		{Name: "blocked_percent", Value: float64(widget.Stats.BlockedPercent)},
+		{Name: "total_queries", Value: float64(widget.Stats.TotalQueries)},
+	}
+}
+
 func (widget *dnsStatsWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, dnsStatsWidgetTemplate)
 }
@@ -135,6 +153,8 @@ type dnsStats struct {
 	DomainsBlocked    int
 	Series            [dnsStatsBars]dnsStatsSeries
 	TopBlockedDomains []dnsStatsBlockedDomain
+	// Empty when the service doesn't report it
+	BlockingStatus string
 }
 
 type dnsStatsSeries struct {
@@ -181,6 +201,7 @@ func fetchAdguardStats(instanceURL string, allowInsecure bool, username, passwor
 		BlockedQueries:    responseJson.BlockedQueries,
 		ResponseTime:      int(responseJson.ResponseTime * 1000),
 		TopBlockedDomains: make([]dnsStatsBlockedDomain, 0, topBlockedDomainsCount),
+		BlockingStatus:    fetchAdguardBlockingStatus(client, instanceURL, username, password),
 	}
 
 	if stats.TotalQueries <= 0 {
@@ -262,6 +283,28 @@ func fetchAdguardStats(instanceURL string, allowInsecure bool, username, passwor
 	return stats, nil
 }
 
+// Not being able to get the status isn't treated as an error since the stats are still usable
+func fetchAdguardBlockingStatus(client requestDoer, instanceURL, username, password string) string {
+	request, err := http.NewRequest("GET", strings.TrimRight(instanceURL, "/")+"/control/status", nil)
+	if err != nil {
+		return ""
+	}
+
+	request.SetBasicAuth(username, password)
+
+	type statusResponseJson struct {
+		ProtectionEnabled bool `json:"protection_enabled"`
+	}
+
+	status, err := decodeJsonFromRequest[statusResponseJson](client, request)
+	if err != nil {
+		slog.Warn("Failed to fetch AdGuard blocking status", "error", err)
+		return ""
+	}
+
+	return ternary(status.ProtectionEnabled, dnsBlockingEnabled, dnsBlockingDisabled)
+}
+
 // Legacy Pi-hole stats response (before v6)
 type pihole5StatsResponse struct {
 	TotalQueries      int                      `json:"dns_queries_today"`
@@ -271,6 +314,7 @@ type pihole5StatsResponse struct {
 	BlockedPercentage float64                  `json:"ads_percentage_today"`
 	TopBlockedDomains pihole5TopBlockedDomains `json:"top_ads"`
 	DomainsBlocked    int                      `json:"domains_being_blocked"`
+	Status            string                   `json:"status"`
 }
 
 // If the user has query logging disabled it's possible for domains_over_time to be returned as an
@@ -335,6 +379,7 @@ func fetchPihole5Stats(instanceURL string, allowInsecure bool, token string, noG
 		BlockedQueries: responseJson.BlockedQueries,
 		BlockedPercent: int(responseJson.BlockedPercentage),
 		DomainsBlocked: responseJson.DomainsBlocked,
+		BlockingStatus: parsePiholeBlockingStatus(responseJson.Status),
 	}
 
 	if len(responseJson.TopBlockedDomains) > 0 {
@@ -501,6 +546,22 @@ func fetchPiholeStats(
 		}()
 	}
 
+	type blockingResponseJson struct {
+		Blocking string `json:"blocking"`
+	}
+
+	var blockingResponse blockingResponseJson
+	var blockingErr error
+
+	blockingRequest, _ := http.NewRequestWithContext(ctx, "GET", instanceURL+"/api/dns/blocking", nil)
+	blockingRequest.Header.Set("x-ftl-sid", sessionID)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		blockingResponse, blockingErr = decodeJsonFromRequest[blockingResponseJson](client, blockingRequest)
+	}()
+
 	type topDomainsResponseJson struct {
 		Domains []struct {
 			Domain string `json:"domain"`
@@ -549,6 +610,12 @@ func fetchPiholeStats(
 		DomainsBlocked: statsResponse.Gravity.DomainsBlocked,
 	}
 
+	if blockingErr != nil {
+		slog.Warn("Failed to fetch Pihole v6 blocking status", "error", blockingErr)
+	} else {
+		stats.BlockingStatus = parsePiholeBlockingStatus(blockingResponse.Blocking)
+	}
+
 	if includeGraph && seriesErr == nil {
 		if len(seriesResponse.History) != 145 {
 			slog.Error(
@@ -615,6 +682,16 @@ func fetchPiholeStats(
 	return stats, sessionID, ternary(partialContent, errPartialContent, nil)
 }
 
+// Both versions report the status as enabled or disabled, anything else such as
+// failed or unknown is treated as not knowing whether blocking is enabled
+func parsePiholeBlockingStatus(status string) string {
+	if status == dnsBlockingEnabled || status == dnsBlockingDisabled {
+		return status
+	}
+
+	return ""
+}
+
 func fetchPiholeSessionID(instanceURL string, client *http.Client, password string) (string, error) {
 	requestBody := []byte(`{"password":"` + password + `"}`)
 
@@ -50,9 +50,41 @@ func (widget *dockerContainersWidget) update(ctx context.Context) {
 	}
 
 	containers.sortByStateIconThenTitle()
+	widget.recordStateChanges(widget.Containers, containers)
 	widget.Containers = containers
 }
 
+// Nothing is recorded on the first update since there's nothing to compare against
+func (widget *dockerContainersWidget) recordStateChanges(previous, current dockerContainerList) {
+	if previous == nil {
+		return
+	}
+
+	previousStates := make(map[string]string)
+	for _, container := range previous.flatten() {
+		previousStates[container.Name] = container.State
+	}
+
+	for _, container := range current.flatten() {
+		previousState, existed := previousStates[container.Name]
+		if !existed || previousState == container.State {
+			continue
+		}
+
+		recordActivity(widget.Providers.db, activityEvent{
+			Type:     activityContainerStateChanged,
+			Level:    ternary(container.State == "running", activityLevelSuccess, activityLevelWarning),
+			Message:  fmt.Sprintf("%s changed from %s to %s", container.Name, previousState, container.State),
+			WidgetID: widget.GetID(),
+			Details: map[string]any{
+				"container":      container.Name,
+				"previous_state": previousState,
+				"state":          container.State,
+			},
+		})
+	}
+}
+
 func (widget *dockerContainersWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, dockerContainersWidgetTemplate)
 }
@@ -125,6 +157,17 @@ type dockerContainer struct {
 
 type dockerContainerList []dockerContainer
 
+// Returns the containers along with their children
+func (containers dockerContainerList) flatten() dockerContainerList {
+	flattened := make(dockerContainerList, 0, len(containers))
+	for i := range containers {
+		flattened = append(flattened, containers[i])
+		flattened = append(flattened, containers[i].Children...)
+	}
+
+	return flattened
+}
+
 func (containers dockerContainerList) sortByStateIconThenTitle() {
 	p := &dockerContainerStateIconPriorities
 
@@ -66,6 +66,10 @@ func (widget *hackerNewsWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, forumPostsTemplate)
 }
 
+func (widget *hackerNewsWidget) snapshotData() any {
+	return &widget.Posts
+}
+
 type hackerNewsPostResponseJson struct {
 	Id           int    `json:"id"`
 	Score        int    `json:"score"`
@@ -62,6 +62,10 @@ func (widget *lobstersWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, forumPostsTemplate)
 }
 
+func (widget *lobstersWidget) snapshotData() any {
+	return &widget.Posts
+}
+
 type lobstersPostResponseJson struct {
 	CreatedAt    string   `json:"created_at"`
 	Title        string   `json:"title"`
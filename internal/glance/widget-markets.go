@@ -10,6 +10,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/glanceapp/glance/internal/database"
 )
 
 var marketsWidgetTemplate = mustParseTemplate("markets.html", "widget-base.html")
@@ -67,6 +69,23 @@ func (widget *marketsWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, marketsWidgetTemplate)
 }
 
+func (widget *marketsWidget) snapshotData() any {
+	return &widget.Markets
+}
+
+func (widget *marketsWidget) historySamples() []database.MetricSample {
+	samples := make([]database.MetricSample, 0, len(widget.Markets))
+
+	for i := range widget.Markets {
+		samples = append(samples, database.MetricSample{
+			Name:  "price:" + widget.Markets[i].Symbol,
+			Value: widget.Markets[i].Price,
+		})
+	}
+
+	return samples
+}
+
 type marketRequest struct {
 	CustomName string `yaml:"name"`
 	Symbol     string `yaml:"symbol"`
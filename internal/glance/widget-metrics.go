@@ -2,113 +2,73 @@ package glance
 
 import (
 	"context"
-	"encoding/json"
 	"html/template"
-	"net/http"
+	"runtime"
+	"sort"
 	"time"
+
+	"github.com/glanceapp/glance/internal/api"
+	"github.com/glanceapp/glance/internal/metrics"
 )
 
-type metricsWidget struct {
-	widgetBase
-}
+var metricsWidgetTemplate = mustParseTemplate("metrics.html", "widget-base.html")
 
-type metricsData struct {
-	Timestamp     int64            `json:"timestamp"`
-	SystemMetrics systemMetrics    `json:"system_metrics"`
-	WidgetMetrics []widgetMetric   `json:"widget_metrics"`
-	APIMetrics    apiMetrics       `json:"api_metrics"`
+type metricsWidget struct {
+	widgetBase     `yaml:",inline"`
+	SystemMetrics  systemMetrics            `yaml:"-"`
+	APIMetrics     api.Stats                `yaml:"-"`
+	UpdateCount    int64                    `yaml:"-"`
+	FailingCount   int                      `yaml:"-"`
+	SlowestWidgets []*metrics.WidgetMetrics `yaml:"-"`
 }
 
 type systemMetrics struct {
-	Memory     uint64 `json:"memory_mb"`
-	Goroutines int    `json:"goroutines"`
-	Uptime     string `json:"uptime"`
+	MemoryMB   uint64
+	Goroutines int
+	Uptime     string
 }
 
-type widgetMetric struct {
-	WidgetID  string `json:"widget_id"`
-	UpdateMin int    `json:"update_min"`
-	ErrorCount int   `json:"error_count"`
-}
-
-type apiMetrics struct {
-	TotalRequests   int64   `json:"total_requests"`
-	AverageLatency  float64 `json:"average_latency_ms"`
-	RateLimited     int64   `json:"rate_limited"`
-}
+func (widget *metricsWidget) initialize() error {
+	widget.withTitle("Metrics").withCacheDuration(5 * time.Second)
 
-func (w *metricsWidget) initialize() error {
-	w.cacheDuration = 5 * time.Second
-	w.cacheType = cacheTypeDuration
-	w.ContentAvailable = true
 	return nil
 }
 
-func (w *metricsWidget) update(ctx context.Context) {
-	resp, err := http.Get("http://localhost:8080/api/v1/metrics")
-	if err != nil {
-		w.Error = err
-		return
-	}
-	defer resp.Body.Close()
+func (widget *metricsWidget) update(ctx context.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
 
-	var metrics metricsData
-	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
-		w.Error = err
-		return
+	widget.APIMetrics = api.CurrentStats()
+	widget.SystemMetrics = systemMetrics{
+		MemoryMB:   m.Alloc / 1024 / 1024,
+		Goroutines: runtime.NumGoroutine(),
+		Uptime:     widget.APIMetrics.Uptime.Truncate(time.Second).String(),
 	}
 
-	w.renderMetrics(metrics)
-}
+	widget.UpdateCount = 0
+	widget.FailingCount = 0
+	widget.SlowestWidgets = widget.SlowestWidgets[:0]
 
-func (w *metricsWidget) renderMetrics(m metricsData) {
-	tmpl := template.Must(template.New("metrics").Parse(`
-		<div class="list list-gap-12">
-			<div class="list-horizontal list-gap-10">
-				<span class="size-h4 color-primary">{{.SystemMetrics.Memory}}</span>
-				<span>MB Memory</span>
-			</div>
-			<div class="list-horizontal list-gap-10">
-				<span class="size-h4 color-primary">{{.SystemMetrics.Goroutines}}</span>
-				<span>Goroutines</span>
-			</div>
-			<div class="list-horizontal list-gap-10">
-				<span class="size-h4 color-primary">{{.SystemMetrics.Uptime}}</span>
-				<span>Uptime</span>
-			</div>
-			<div class="list-horizontal list-gap-10">
-				<span class="size-h4 color-primary">{{.APIMetrics.TotalRequests}}</span>
-				<span>API Requests</span>
-			</div>
-			<div class="list-horizontal list-gap-10">
-				<span class="size-h4 color-primary">{{.APIMetrics.AverageLatency | printf "%.1f"}}</span>
-				<span>ms Latency</span>
-			</div>
-			<div class="list-horizontal list-gap-10">
-				<span class="size-h4 color-primary">{{.APIMetrics.RateLimited}}</span>
-				<span>Rate Limited</span>
-			</div>
-		</div>
-	`))
-	w.templateBuffer.Reset()
-	tmpl.Execute(&w.templateBuffer, m)
-	w.ContentAvailable = true
-}
+	if widget.Providers != nil && widget.Providers.metrics != nil {
+		for _, wm := range widget.Providers.metrics.GetAllMetrics() {
+			widget.UpdateCount += wm.UpdateCount
+			if wm.LastOutcome == metrics.OutcomeError {
+				widget.FailingCount++
+			}
 
+			widget.SlowestWidgets = append(widget.SlowestWidgets, wm)
+		}
 
-func (w *metricsWidget) Render() template.HTML {
-	return template.HTML(w.templateBuffer.String())
-}
+		sort.Slice(widget.SlowestWidgets, func(i, j int) bool {
+			return widget.SlowestWidgets[i].P95UpdateMS > widget.SlowestWidgets[j].P95UpdateMS
+		})
 
-func (w *metricsWidget) GetType() string {
-	return "metrics"
-}
+		widget.SlowestWidgets = widget.SlowestWidgets[:min(5, len(widget.SlowestWidgets))]
+	}
 
-func (w *metricsWidget) handleRequest(wr http.ResponseWriter, r *http.Request) {
-	wr.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(wr).Encode(map[string]string{"status": "ok"})
+	widget.canContinueUpdateAfterHandlingErr(nil)
 }
 
-func (w *metricsWidget) setHideHeader(b bool) {
-	w.HideHeader = b
+func (widget *metricsWidget) Render() template.HTML {
+	return widget.renderTemplate(widget, metricsWidgetTemplate)
 }
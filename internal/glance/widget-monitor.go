@@ -3,11 +3,14 @@ package glance
 import (
 	"context"
 	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
 	"slices"
 	"strconv"
 	"time"
+
+	"github.com/glanceapp/glance/internal/database"
 )
 
 var (
@@ -58,9 +61,11 @@ func (widget *monitorWidget) update(ctx context.Context) {
 	for i := range widget.Sites {
 		site := &widget.Sites[i]
 		status := &statuses[i]
+		previous := site.Status
 		site.Status = status
 
-		if !slices.Contains(site.AltStatusCodes, status.Code) && (status.Code >= 400 || status.Error != nil) {
+		failing := siteStatusIsFailing(status, site.AltStatusCodes)
+		if failing {
 			widget.HasFailing = true
 		}
 
@@ -72,7 +77,51 @@ func (widget *monitorWidget) update(ctx context.Context) {
 
 		site.StatusText = statusCodeToText(status.Code, site.AltStatusCodes)
 		site.StatusStyle = statusCodeToStyle(status.Code, site.AltStatusCodes)
+
+		if previous != nil && failing != siteStatusIsFailing(previous, site.AltStatusCodes) {
+			widget.recordStatusChange(site.Title, site.StatusText, failing)
+		}
+	}
+}
+
+func (widget *monitorWidget) recordStatusChange(title, statusText string, failing bool) {
+	event := activityEvent{
+		Type:     activityMonitorStatusChanged,
+		WidgetID: widget.GetID(),
+		Details:  map[string]any{"site": title, "status": statusText},
+	}
+
+	if failing {
+		event.Level = activityLevelError
+		event.Message = fmt.Sprintf("%s is down (%s)", title, statusText)
+	} else {
+		event.Level = activityLevelSuccess
+		event.Message = fmt.Sprintf("%s is back up", title)
+	}
+
+	recordActivity(widget.Providers.db, event)
+}
+
+func (widget *monitorWidget) historySamples() []database.MetricSample {
+	samples := make([]database.MetricSample, 0, len(widget.Sites))
+
+	for i := range widget.Sites {
+		status := widget.Sites[i].Status
+		if status == nil || status.Error != nil {
+			continue
+		}
+
+		samples = append(samples, database.MetricSample{
+			Name:  "response_time_ms:" + widget.Sites[i].Title,
+			Value: float64(status.ResponseTime.Milliseconds()),
+		})
 	}
+
+	return samples
+}
+
+func siteStatusIsFailing(status *siteStatus, altStatusCodes []int) bool {
+	return !slices.Contains(altStatusCodes, status.Code) && (status.Code >= 400 || status.Error != nil)
 }
 
 func (widget *monitorWidget) Render() template.HTML {
@@ -122,6 +122,10 @@ func (widget *redditWidget) Render() template.HTML {
 
 }
 
+func (widget *redditWidget) snapshotData() any {
+	return &widget.Posts
+}
+
 type subredditResponseJson struct {
 	Data struct {
 		Children []struct {
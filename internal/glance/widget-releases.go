@@ -74,6 +74,10 @@ func (widget *releasesWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, releasesWidgetTemplate)
 }
 
+func (widget *releasesWidget) snapshotData() any {
+	return &widget.Releases
+}
+
 type releaseSource string
 
 const (
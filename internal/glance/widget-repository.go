@@ -60,6 +60,10 @@ func (widget *repositoryWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, repositoryWidgetTemplate)
 }
 
+func (widget *repositoryWidget) snapshotData() any {
+	return &widget.Repository
+}
+
 type repository struct {
 	Name             string
 	Stars            int
@@ -111,6 +111,10 @@ func (widget *rssWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, rssWidgetTemplate)
 }
 
+func (widget *rssWidget) snapshotData() any {
+	return &widget.Items
+}
+
 type cachedRSSFeed struct {
 	etag         string
 	lastModified string
@@ -224,7 +228,7 @@ func (widget *rssWidget) fetchItemsFromFeedTask(request rssFeedRequest) ([]rssFe
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, request.URL)
+		return nil, &httpStatusError{statusCode: resp.StatusCode, url: request.URL}
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/glanceapp/glance/internal/database"
 	"github.com/glanceapp/glance/pkg/sysinfo"
 )
 
@@ -80,6 +81,41 @@ func (widget *serverStatsWidget) update(context.Context) {
 	widget.withError(nil).scheduleNextUpdate()
 }
 
+func (widget *serverStatsWidget) historySamples() []database.MetricSample {
+	samples := make([]database.MetricSample, 0)
+
+	for i := range widget.Servers {
+		serv := &widget.Servers[i]
+		if !serv.IsReachable || serv.Info == nil {
+			continue
+		}
+
+		info := serv.Info
+		name := ternary(serv.Name != "", serv.Name, info.Hostname)
+
+		if info.CPU.LoadIsAvailable {
+			samples = append(samples, database.MetricSample{Name: "cpu_load_percent:" + name, Value: float64(info.CPU.Load1Percent)})
+		}
+
+		if info.CPU.TemperatureIsAvailable {
+			samples = append(samples, database.MetricSample{Name: "cpu_temperature_c:" + name, Value: float64(info.CPU.TemperatureC)})
+		}
+
+		if info.Memory.IsAvailable {
+			samples = append(samples, database.MetricSample{Name: "memory_used_percent:" + name, Value: float64(info.Memory.UsedPercent)})
+		}
+
+		for _, mountpoint := range info.Mountpoints {
+			samples = append(samples, database.MetricSample{
+				Name:  "disk_used_percent:" + name + ":" + mountpoint.Path,
+				Value: float64(mountpoint.UsedPercent),
+			})
+		}
+	}
+
+	return samples
+}
+
 func (widget *serverStatsWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, serverStatsWidgetTemplate)
 }
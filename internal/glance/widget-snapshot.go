@@ -0,0 +1,87 @@
+package glance
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+// Widgets that implement this have the data from their last successful update
+// stored in the database so that it can be shown right away after a restart
+// rather than having to wait for it to get fetched again
+type snapshottableWidget interface {
+	widget
+	// Returns a pointer to the data that gets marshaled when taking a snapshot
+	// and that the snapshot gets unmarshaled into when restoring it
+	snapshotData() any
+	updateSucceeded() bool
+	restoredFromSnapshot(nextUpdate time.Time)
+}
+
+func (w *widgetBase) updateSucceeded() bool {
+	return w.ContentAvailable && w.Error == nil
+}
+
+func (w *widgetBase) restoredFromSnapshot(nextUpdate time.Time) {
+	w.withError(nil)
+	w.nextUpdate = nextUpdate
+}
+
+// Must be called with the widget locked
+func saveWidgetSnapshot(db *database.DB, w widget) {
+	snapshottable, ok := w.(snapshottableWidget)
+	if !ok || !snapshottable.updateSucceeded() {
+		return
+	}
+
+	data, err := json.Marshal(snapshottable.snapshotData())
+	if err != nil {
+		slog.Error("Failed to marshal widget snapshot", "widget", w.GetID(), "error", err)
+		return
+	}
+
+	err = db.Snapshots.Save(context.Background(), &database.WidgetSnapshot{
+		WidgetID:   w.GetID(),
+		WidgetType: w.GetType(),
+		ConfigHash: snapshottable.getConfigHash(),
+		Version:    buildVersion,
+		Data:       data,
+		NextUpdate: w.getNextUpdate(),
+	})
+	if err != nil {
+		slog.Error("Failed to save widget snapshot", "widget", w.GetID(), "error", err)
+	}
+}
+
+// Snapshots are only restored if they were taken by the same version of Glance
+// from a widget with the exact same config, otherwise the data may not match
+// what the widget would have fetched or be in a different format altogether
+func restoreWidgetSnapshot(db *database.DB, w widget) {
+	snapshottable, ok := w.(snapshottableWidget)
+	if !ok {
+		return
+	}
+
+	snapshot, err := db.Snapshots.Get(context.Background(), w.GetID())
+	if err != nil {
+		slog.Error("Failed to load widget snapshot", "widget", w.GetID(), "error", err)
+		return
+	}
+
+	if snapshot == nil ||
+		snapshot.WidgetType != w.GetType() ||
+		snapshot.ConfigHash != snapshottable.getConfigHash() ||
+		snapshot.Version != buildVersion {
+		return
+	}
+
+	if err := json.Unmarshal(snapshot.Data, snapshottable.snapshotData()); err != nil {
+		slog.Warn("Failed to restore widget snapshot", "widget", w.GetID(), "error", err)
+		return
+	}
+
+	snapshottable.restoredFromSnapshot(snapshot.NextUpdate)
+}
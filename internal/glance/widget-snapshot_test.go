@@ -0,0 +1,55 @@
+package glance
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glanceapp/glance/internal/database"
+)
+
+func TestWidgetSnapshotIsOnlyRestoredForUnchangedConfig(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "glance.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	newWidget := func(configHash string) *rssWidget {
+		widget := &rssWidget{}
+		widget.ID = "news"
+		widget.Type = "rss"
+		widget.configHash = configHash
+		return widget
+	}
+
+	nextUpdate := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+
+	original := newWidget("a")
+	original.Items = rssFeedItemList{{Title: "First"}, {Title: "Second"}}
+	original.withError(nil)
+	original.nextUpdate = nextUpdate
+	saveWidgetSnapshot(db, original)
+
+	restored := newWidget("a")
+	restoreWidgetSnapshot(db, restored)
+
+	if len(restored.Items) != 2 || restored.Items[1].Title != "Second" {
+		t.Fatalf("Expected items to be restored, got %v", restored.Items)
+	}
+
+	if !restored.ContentAvailable {
+		t.Error("Expected content to be available after restoring")
+	}
+
+	if !restored.nextUpdate.Equal(nextUpdate) {
+		t.Errorf("Expected next update to be %v, got %v", nextUpdate, restored.nextUpdate)
+	}
+
+	changed := newWidget("b")
+	restoreWidgetSnapshot(db, changed)
+
+	if len(changed.Items) != 0 || changed.ContentAvailable {
+		t.Fatal("Snapshot should not be restored after the config changed")
+	}
+}
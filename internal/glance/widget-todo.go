@@ -8,17 +8,46 @@ var todoWidgetTemplate = mustParseTemplate("todo.html", "widget-base.html")
 
 type todoWidget struct {
 	widgetBase `yaml:",inline"`
-	cachedHTML template.HTML `yaml:"-"`
-	TodoID     string        `yaml:"id"`
+	// IDs used to be free-form and were only the key of the tasks in the local storage of
+	// the browser, so one that isn't a valid ID anymore is still used as that key rather
+	// than failing the config and orphaning the tasks
+	legacyID string
+}
+
+func (widget *todoWidget) assignID(location string) error {
+	if widget.ID != "" && !widgetIDPattern.MatchString(widget.ID) {
+		widget.legacyID = widget.ID
+		widget.ID = ""
+	}
+
+	return widget.widgetBase.assignID(location)
+}
+
+// The key under which the tasks are stored in the browser, empty if they aren't tied to an ID
+func (widget *todoWidget) StorageKey() string {
+	if widget.legacyID != "" {
+		return widget.legacyID
+	}
+
+	if widget.HasConfiguredID() {
+		return widget.ID
+	}
+
+	return ""
 }
 
 func (widget *todoWidget) initialize() error {
 	widget.withTitle("To-do").withError(nil)
 
-	widget.cachedHTML = widget.renderTemplate(widget, todoWidgetTemplate)
 	return nil
 }
 
+// Tasks are only synced through the server when the widget has an explicit ID
+// since it's the only thing that stays the same across restarts and devices
+func (widget *todoWidget) SyncEnabled() bool {
+	return widget.HasConfiguredID() && widget.Providers != nil && widget.Providers.db != nil
+}
+
 func (widget *todoWidget) Render() template.HTML {
-	return widget.cachedHTML
+	return widget.renderTemplate(widget, todoWidgetTemplate)
 }
@@ -59,6 +59,10 @@ func (widget *twitchChannelsWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, twitchChannelsWidgetTemplate)
 }
 
+func (widget *twitchChannelsWidget) snapshotData() any {
+	return &widget.Channels
+}
+
 type twitchChannel struct {
 	Login        string
 	Exists       bool
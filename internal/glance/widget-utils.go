@@ -24,19 +24,34 @@ var (
 const defaultClientTimeout = 5 * time.Second
 
 var defaultHTTPClient = &http.Client{
-	Transport: &http.Transport{
+	Transport: newInstrumentedTransport(&http.Transport{
 		MaxIdleConnsPerHost: 10,
 		Proxy:               http.ProxyFromEnvironment,
-	},
+	}),
 	Timeout: defaultClientTimeout,
 }
 
 var defaultInsecureHTTPClient = &http.Client{
 	Timeout: defaultClientTimeout,
-	Transport: &http.Transport{
+	Transport: newInstrumentedTransport(&http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		Proxy:           http.ProxyFromEnvironment,
-	},
+	}),
+}
+
+// Returned when a request gets a response with a status code other than the expected one
+type httpStatusError struct {
+	statusCode int
+	url        string
+	body       string
+}
+
+func (e *httpStatusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("unexpected status code %d from %s", e.statusCode, e.url)
+	}
+
+	return fmt.Sprintf("unexpected status code %d from %s, response: %s", e.statusCode, e.url, e.body)
 }
 
 type requestDoer interface {
@@ -76,12 +91,7 @@ func decodeJsonFromRequest[T any](client requestDoer, request *http.Request) (T,
 	if response.StatusCode != http.StatusOK {
 		truncatedBody, _ := limitStringLength(string(body), 256)
 
-		return result, fmt.Errorf(
-			"unexpected status code %d from %s, response: %s",
-			response.StatusCode,
-			request.URL,
-			truncatedBody,
-		)
+		return result, &httpStatusError{response.StatusCode, request.URL.String(), truncatedBody}
 	}
 
 	err = json.Unmarshal(body, &result)
@@ -116,12 +126,7 @@ func decodeXmlFromRequest[T any](client requestDoer, request *http.Request) (T,
 	if response.StatusCode != http.StatusOK {
 		truncatedBody, _ := limitStringLength(string(body), 256)
 
-		return result, fmt.Errorf(
-			"unexpected status code %d for %s, response: %s",
-			response.StatusCode,
-			request.URL,
-			truncatedBody,
-		)
+		return result, &httpStatusError{response.StatusCode, request.URL.String(), truncatedBody}
 	}
 
 	err = xml.Unmarshal(body, &result)
@@ -92,6 +92,10 @@ func (widget *videosWidget) Render() template.HTML {
 	return widget.renderTemplate(widget, template)
 }
 
+func (widget *videosWidget) snapshotData() any {
+	return &widget.Videos
+}
+
 type youtubeFeedResponseXml struct {
 	Channel     string `xml:"author>name"`
 	ChannelLink string `xml:"author>uri"`
@@ -3,20 +3,24 @@ package glance
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"math"
 	"net/http"
+	"regexp"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/glanceapp/glance/internal/database"
+	"github.com/glanceapp/glance/internal/metrics"
 	"gopkg.in/yaml.v3"
 )
 
-var widgetIDCounter atomic.Uint64
-
 func newWidget(widgetType string) (widget, error) {
 	if widgetType == "" {
 		return nil, errors.New("widget 'type' property is empty or not specified")
@@ -91,8 +95,6 @@ func newWidget(widgetType string) (widget, error) {
 		return nil, fmt.Errorf("unknown widget type: %s", widgetType)
 	}
 
-	w.setID(widgetIDCounter.Add(1))
-
 	return w, nil
 }
 
@@ -123,25 +125,52 @@ func (w *widgets) UnmarshalYAML(node *yaml.Node) error {
 			return err
 		}
 
+		configHash, err := hashYAMLNode(&node)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+
+		widget.setConfigHash(configHash)
 		*w = append(*w, widget)
 	}
 
 	return nil
 }
 
+func hashYAMLNode(node *yaml.Node) (string, error) {
+	contents, err := yaml.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 type widget interface {
 	// These need to be exported because they get called in templates
 	Render() template.HTML
 	GetType() string
-	GetID() uint64
+	GetID() string
 
 	initialize() error
 	requiresUpdate(*time.Time) bool
 	setProviders(*widgetProviders)
 	update(context.Context)
-	setID(uint64)
+	setConfigHash(string)
+	getConfigHash() string
+	assignID(location string) error
 	handleRequest(w http.ResponseWriter, r *http.Request)
 	setHideHeader(bool)
+	lock()
+	tryLock() bool
+	unlock()
+	getNextUpdate() time.Time
+	getError() error
+	getNotice() error
+	setRefreshing(bool)
+	setStaleContent(template.HTML)
+	getStaleContent() template.HTML
 }
 
 type cacheType int
@@ -153,7 +182,7 @@ const (
 )
 
 type widgetBase struct {
-	ID                  uint64           `yaml:"-"`
+	ID                  string           `yaml:"id"`
 	Providers           *widgetProviders `yaml:"-"`
 	Type                string           `yaml:"type"`
 	Title               string           `yaml:"title"`
@@ -170,10 +199,24 @@ type widgetBase struct {
 	cacheType           cacheType        `yaml:"-"`
 	nextUpdate          time.Time        `yaml:"-"`
 	updateRetriedTimes  int              `yaml:"-"`
+	configHash          string           `yaml:"-"`
+	hasConfiguredID     bool             `yaml:"-"`
+	// Held while the widget is being updated, rendered or handling a request
+	mu sync.Mutex `yaml:"-"`
+	// Set from the moment an update is scheduled until it finishes
+	refreshing atomic.Bool `yaml:"-"`
+	// What gets shown in place of the widget while it's being updated
+	staleMu      sync.Mutex    `yaml:"-"`
+	staleContent template.HTML `yaml:"-"`
 }
 
 type widgetProviders struct {
 	assetResolver func(string) string
+	// Nil when the database is disabled, widgets that use it must
+	// gracefully fall back to keeping their state in memory
+	db *database.DB
+	// Shared by all applications so that metrics aren't reset on reloads
+	metrics *metrics.Collector
 }
 
 func (w *widgetBase) requiresUpdate(now *time.Time) bool {
@@ -196,12 +239,89 @@ func (w *widgetBase) update(ctx context.Context) {
 
 }
 
-func (w *widgetBase) GetID() uint64 {
+func (w *widgetBase) GetID() string {
 	return w.ID
 }
 
-func (w *widgetBase) setID(id uint64) {
-	w.ID = id
+// Whether the ID was set through the config rather than derived from
+// the widget's location and properties
+func (w *widgetBase) HasConfiguredID() bool {
+	return w.hasConfiguredID
+}
+
+func (w *widgetBase) setConfigHash(hash string) {
+	w.configHash = hash
+}
+
+func (w *widgetBase) getConfigHash() string {
+	return w.configHash
+}
+
+// IDs end up in URLs and in the HTML of the page, so they're limited to characters that are safe in both
+var widgetIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Widgets without an ID in the config get one derived from where they are
+// placed, so that it stays the same across restarts, reloads and changes to
+// their properties for as long as they aren't moved
+func (w *widgetBase) assignID(location string) error {
+	if w.ID != "" {
+		if !widgetIDPattern.MatchString(w.ID) {
+			return fmt.Errorf("widget id \"%s\" can only contain letters, numbers, dashes and underscores", w.ID)
+		}
+
+		w.hasConfiguredID = true
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(location + "\x00" + w.Type))
+	w.ID = w.Type + "-" + hex.EncodeToString(sum[:5])
+	return nil
+}
+
+func (w *widgetBase) lock() {
+	w.mu.Lock()
+}
+
+func (w *widgetBase) tryLock() bool {
+	return w.mu.TryLock()
+}
+
+func (w *widgetBase) unlock() {
+	w.mu.Unlock()
+}
+
+func (w *widgetBase) getNextUpdate() time.Time {
+	return w.nextUpdate
+}
+
+func (w *widgetBase) getError() error {
+	return w.Error
+}
+
+func (w *widgetBase) getNotice() error {
+	return w.Notice
+}
+
+func (w *widgetBase) IsRefreshing() bool {
+	return w.refreshing.Load()
+}
+
+func (w *widgetBase) setRefreshing(value bool) {
+	w.refreshing.Store(value)
+}
+
+func (w *widgetBase) setStaleContent(content template.HTML) {
+	w.staleMu.Lock()
+	defer w.staleMu.Unlock()
+
+	w.staleContent = content
+}
+
+func (w *widgetBase) getStaleContent() template.HTML {
+	w.staleMu.Lock()
+	defer w.staleMu.Unlock()
+
+	return w.staleContent
 }
 
 func (w *widgetBase) setHideHeader(value bool) {
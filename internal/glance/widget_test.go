@@ -0,0 +1,168 @@
+package glance
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glanceapp/glance/internal/websocket"
+)
+
+type requestTestWidget struct {
+	widgetBase
+}
+
+func (widget *requestTestWidget) initialize() error {
+	return nil
+}
+
+func (widget *requestTestWidget) update(ctx context.Context) {}
+
+func (widget *requestTestWidget) Render() template.HTML {
+	return "interactive"
+}
+
+func (widget *requestTestWidget) handleRequest(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("handled " + r.PathValue("path")))
+}
+
+func newWidgetRequestTestApp(t *testing.T, yaml string, replace func(*config)) http.Handler {
+	t.Helper()
+
+	config, err := newConfigFromYAML([]byte(yaml))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	replace(config)
+
+	services := &sharedServices{wsHub: websocket.NewHub(), scheduler: newWidgetScheduler()}
+	app, err := newApplication(config, services, nil)
+	if err != nil {
+		t.Fatalf("Failed to create application: %v", err)
+	}
+
+	return app.handler()
+}
+
+func TestWidgetRequestsReachTheirWidget(t *testing.T) {
+	secret, _ := makeAuthSecretKey(AUTH_SECRET_KEY_LENGTH)
+	handler := newWidgetRequestTestApp(t, `
+auth:
+  secret-key: `+secret+`
+  users:
+    admin:
+      password: hunter22
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: placeholder
+          - type: group
+            widgets:
+              - type: html
+                id: nested
+                source: hello
+`, func(config *config) {
+		interactive := &requestTestWidget{}
+		interactive.ID = "interactive"
+		config.Pages[0].Columns[0].Widgets[0] = interactive
+	})
+
+	request := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if response := request("/api/widgets/interactive/items", nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected widget requests to require authentication, got %d", response.Code)
+	}
+
+	login := httptest.NewRequest("POST", "/api/authenticate", strings.NewReader(`{"username":"admin","password":"hunter22"}`))
+	login.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, login)
+	cookie := recorder.Result().Cookies()[0]
+
+	if response := request("/api/widgets/interactive/items", cookie); response.Body.String() != "handled items" {
+		t.Errorf("Expected the request to be handled by the widget, got %d: %s", response.Code, response.Body.String())
+	}
+
+	// Widgets inside of containers are reachable too, this one doesn't handle requests
+	if response := request("/api/widgets/nested/items", cookie); response.Code != http.StatusNotImplemented {
+		t.Errorf("Expected the request to reach the widget inside of the group, got %d", response.Code)
+	}
+
+	if response := request("/api/widgets/missing/items", cookie); response.Code != http.StatusNotFound {
+		t.Errorf("Expected a widget that doesn't exist not to be found, got %d", response.Code)
+	}
+}
+
+func TestLockedWidgetDoesNotBlockOtherWidgets(t *testing.T) {
+	first := &requestTestWidget{}
+	first.ID = "first"
+	second := &requestTestWidget{}
+	second.ID = "second"
+
+	handler := newWidgetRequestTestApp(t, `
+pages:
+  - name: Home
+    columns:
+      - size: full
+        widgets:
+          - type: html
+            source: placeholder
+          - type: html
+            source: placeholder
+`, func(config *config) {
+		config.Pages[0].Columns[0].Widgets[0] = first
+		config.Pages[0].Columns[0].Widgets[1] = second
+	})
+
+	request := func(path string) <-chan string {
+		body := make(chan string, 1)
+		go func() {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+			body <- recorder.Body.String()
+		}()
+
+		return body
+	}
+
+	// Held the same way as while the widget is being updated
+	first.lock()
+
+	blocked := request("/api/widgets/first/items")
+
+	select {
+	case body := <-request("/api/widgets/second/items"):
+		if body != "handled items" {
+			t.Errorf("Expected the other widget to handle the request, got %s", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the other widget not to wait for the locked one")
+	}
+
+	select {
+	case <-blocked:
+		t.Fatal("Expected the request to wait for the widget to be unlocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.unlock()
+	if body := <-blocked; body != "handled items" {
+		t.Errorf("Expected the request to be handled once the widget was unlocked, got %s", body)
+	}
+}
@@ -3,117 +3,208 @@ package metrics
 import (
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type WidgetMetrics struct {
-	WidgetID         string        `json:"widget_id"`
-	UpdateCount      int64         `json:"update_count"`
-	ErrorCount       int64         `json:"error_count"`
-	LastUpdateTime   time.Time     `json:"last_update_time"`
-	AverageUpdateMS  float64       `json:"average_update_ms"`
-	LastError        string        `json:"last_error,omitempty"`
-	updateTimes      []time.Duration
-	mu               sync.RWMutex
+	WidgetID     string `json:"widget_id"`
+	WidgetType   string `json:"widget_type"`
+	UpdateCount  int64  `json:"update_count"`
+	SuccessCount int64  `json:"success_count"`
+	PartialCount int64  `json:"partial_count"`
+	ErrorCount   int64  `json:"error_count"`
+	// Failed updates grouped by the class of the error they failed with
+	ErrorsByClass   map[string]int64 `json:"errors_by_class"`
+	LastUpdateTime  time.Time        `json:"last_update_time"`
+	LastOutcome     Outcome          `json:"last_outcome"`
+	LastUpdateMS    float64          `json:"last_update_ms"`
+	AverageUpdateMS float64          `json:"average_update_ms"`
+	P50UpdateMS     float64          `json:"p50_update_ms"`
+	P95UpdateMS     float64          `json:"p95_update_ms"`
+	P99UpdateMS     float64          `json:"p99_update_ms"`
+	// Cumulative counts of update durations in seconds
+	UpdateDurationBuckets []BucketCount          `json:"update_duration_buckets"`
+	Windows               map[string]WindowStats `json:"windows"`
+	LastError             string                 `json:"last_error,omitempty"`
+	LastErrorTime         *time.Time             `json:"last_error_time,omitempty"`
+
+	durations *Histogram
+	recent    *slidingWindow
+	mu        sync.RWMutex
+}
+
+// Outcome describes how an update of a widget went
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	// Some of the data couldn't be fetched but there was enough to show
+	OutcomePartial Outcome = "partial"
+	OutcomeError   Outcome = "error"
+)
+
+// Update holds the result of a single widget update
+type Update struct {
+	WidgetID   string
+	WidgetType string
+	Duration   time.Duration
+	Outcome    Outcome
+	// The error the update failed with, or the reason the content is partial
+	Err error
+	// A short description of the kind of error, such as "timeout", used to
+	// group failed updates. Defaults to "other" for failed updates.
+	ErrorClass string
 }
 
 type Collector struct {
 	widgets map[string]*WidgetMetrics
 	mu      sync.RWMutex
+
+	requests         *requestSeries
+	upstreamRequests *requestSeries
+	authFailures     atomic.Int64
+
+	gaugesMu sync.Mutex
+	gauges   []gauge
 }
 
 func NewCollector() *Collector {
 	return &Collector{
-		widgets: make(map[string]*WidgetMetrics),
+		widgets:          make(map[string]*WidgetMetrics),
+		requests:         newRequestSeries(),
+		upstreamRequests: newRequestSeries(),
 	}
 }
 
-func (c *Collector) RecordUpdate(widgetID string, duration time.Duration) {
+func (c *Collector) RecordUpdate(update Update) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	metrics, exists := c.widgets[widgetID]
+	metrics, exists := c.widgets[update.WidgetID]
 	if !exists {
 		metrics = &WidgetMetrics{
-			WidgetID:    widgetID,
-			updateTimes: make([]time.Duration, 0, 100),
+			WidgetID:      update.WidgetID,
+			ErrorsByClass: make(map[string]int64),
+			durations:     NewHistogram(DefaultBuckets),
+			recent:        &slidingWindow{},
 		}
-		c.widgets[widgetID] = metrics
+		c.widgets[update.WidgetID] = metrics
 	}
+	c.mu.Unlock()
 
 	metrics.mu.Lock()
 	defer metrics.mu.Unlock()
 
-	metrics.UpdateCount++
-	metrics.LastUpdateTime = time.Now()
-	metrics.updateTimes = append(metrics.updateTimes, duration)
+	now := time.Now()
 
-	// Keep only last 100 update times for average calculation
-	if len(metrics.updateTimes) > 100 {
-		metrics.updateTimes = metrics.updateTimes[1:]
+	metrics.WidgetType = update.WidgetType
+	metrics.UpdateCount++
+	metrics.LastUpdateTime = now
+	metrics.LastOutcome = update.Outcome
+	metrics.LastUpdateMS = float64(update.Duration) / float64(time.Millisecond)
+	metrics.durations.Observe(update.Duration)
+	metrics.recent.record(now, update.Outcome == OutcomeError, update.Duration)
+
+	switch update.Outcome {
+	case OutcomeSuccess:
+		metrics.SuccessCount++
+	case OutcomePartial:
+		metrics.PartialCount++
+	case OutcomeError:
+		metrics.ErrorCount++
+
+		class := update.ErrorClass
+		if class == "" {
+			class = "other"
+		}
+		metrics.ErrorsByClass[class]++
 	}
 
-	// Calculate average
-	var total time.Duration
-	for _, d := range metrics.updateTimes {
-		total += d
+	if update.Err != nil {
+		metrics.LastError = update.Err.Error()
+		metrics.LastErrorTime = &now
 	}
-	metrics.AverageUpdateMS = float64(total) / float64(len(metrics.updateTimes)) / float64(time.Millisecond)
 }
 
-func (c *Collector) RecordError(widgetID string, err error) {
+// Retain removes the metrics of all widgets except for the given ones, so
+// that widgets which have been removed from the config stop being reported
+func (c *Collector) Retain(widgetIDs []string) {
+	keep := make(map[string]bool, len(widgetIDs))
+	for _, id := range widgetIDs {
+		keep[id] = true
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	metrics, exists := c.widgets[widgetID]
-	if !exists {
-		metrics = &WidgetMetrics{
-			WidgetID:    widgetID,
-			updateTimes: make([]time.Duration, 0, 100),
+	for id := range c.widgets {
+		if !keep[id] {
+			delete(c.widgets, id)
 		}
-		c.widgets[widgetID] = metrics
-	}
-
-	metrics.mu.Lock()
-	defer metrics.mu.Unlock()
-
-	metrics.ErrorCount++
-	if err != nil {
-		metrics.LastError = err.Error()
 	}
 }
 
 func (c *Collector) GetMetrics(widgetID string) *WidgetMetrics {
 	c.mu.RLock()
-	defer c.mu.RUnlock()
-
 	metrics, exists := c.widgets[widgetID]
+	c.mu.RUnlock()
+
 	if !exists {
 		return nil
 	}
 
-	metrics.mu.RLock()
-	defer metrics.mu.RUnlock()
-
-	// Return a copy
-	return &WidgetMetrics{
-		WidgetID:        metrics.WidgetID,
-		UpdateCount:     metrics.UpdateCount,
-		ErrorCount:      metrics.ErrorCount,
-		LastUpdateTime:  metrics.LastUpdateTime,
-		AverageUpdateMS: metrics.AverageUpdateMS,
-		LastError:       metrics.LastError,
-	}
+	return metrics.copy()
 }
 
 func (c *Collector) GetAllMetrics() map[string]*WidgetMetrics {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	result := make(map[string]*WidgetMetrics)
-	for id := range c.widgets {
-		result[id] = c.GetMetrics(id)
+	result := make(map[string]*WidgetMetrics, len(c.widgets))
+	for id, metrics := range c.widgets {
+		result[id] = metrics.copy()
+	}
+	return result
+}
+
+// Returns a copy with the percentiles, buckets and windows filled in
+func (m *WidgetMetrics) copy() *WidgetMetrics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+
+	result := &WidgetMetrics{
+		WidgetID:              m.WidgetID,
+		WidgetType:            m.WidgetType,
+		UpdateCount:           m.UpdateCount,
+		SuccessCount:          m.SuccessCount,
+		PartialCount:          m.PartialCount,
+		ErrorCount:            m.ErrorCount,
+		ErrorsByClass:         make(map[string]int64, len(m.ErrorsByClass)),
+		LastUpdateTime:        m.LastUpdateTime,
+		LastOutcome:           m.LastOutcome,
+		LastUpdateMS:          m.LastUpdateMS,
+		P50UpdateMS:           m.durations.Quantile(0.5) * 1000,
+		P95UpdateMS:           m.durations.Quantile(0.95) * 1000,
+		P99UpdateMS:           m.durations.Quantile(0.99) * 1000,
+		UpdateDurationBuckets: m.durations.Buckets(),
+		Windows:               make(map[string]WindowStats, len(reportedWindows)),
+		LastError:             m.LastError,
+		LastErrorTime:         m.LastErrorTime,
+	}
+
+	if count := m.durations.Count(); count > 0 {
+		result.AverageUpdateMS = m.durations.Sum() / float64(count) * 1000
 	}
+
+	for class, count := range m.ErrorsByClass {
+		result.ErrorsByClass[class] = count
+	}
+
+	for _, window := range reportedWindows {
+		result.Windows[window.name] = m.recent.stats(now, window.duration)
+	}
+
 	return result
 }
 
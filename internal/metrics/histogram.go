@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// Upper bounds of the buckets in seconds, chosen to cover everything from a
+// response served from a nearby cache to a request that's about to time out
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts durations in fixed buckets, it isn't safe for concurrent
+// use and must be guarded by whatever owns it
+type Histogram struct {
+	bounds []float64
+	// Non-cumulative, with an extra bucket at the end for anything above the last bound
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// BucketCount is the cumulative number of observations less than or equal to LE
+type BucketCount struct {
+	// A string since +Inf can't be represented in JSON
+	LE    string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+
+	i := 0
+	for i < len(h.bounds) && seconds > h.bounds[i] {
+		i++
+	}
+
+	h.counts[i]++
+	h.count++
+	h.sum += seconds
+}
+
+func (h *Histogram) clone() *Histogram {
+	clone := *h
+	clone.counts = append([]uint64(nil), h.counts...)
+	return &clone
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.count
+}
+
+// Sum returns the total of all observations in seconds
+func (h *Histogram) Sum() float64 {
+	return h.sum
+}
+
+func (h *Histogram) Buckets() []BucketCount {
+	buckets := make([]BucketCount, len(h.counts))
+
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += h.counts[i]
+		buckets[i].Count = cumulative
+
+		if i < len(h.bounds) {
+			buckets[i].LE = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+		} else {
+			buckets[i].LE = "+Inf"
+		}
+	}
+
+	return buckets
+}
+
+// Quantile estimates the q-quantile in seconds by assuming that observations
+// are evenly spread within each bucket, the same way Prometheus does it.
+// Observations above the last bound are reported as the last bound.
+func (h *Histogram) Quantile(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := q * float64(h.count)
+
+	var cumulative uint64
+	for i, count := range h.counts {
+		if count == 0 || float64(cumulative+count) < rank {
+			cumulative += count
+			continue
+		}
+
+		if i == len(h.bounds) {
+			return h.bounds[len(h.bounds)-1]
+		}
+
+		lower := 0.0
+		if i > 0 {
+			lower = h.bounds[i-1]
+		}
+
+		return lower + (h.bounds[i]-lower)*(rank-float64(cumulative))/float64(count)
+	}
+
+	return h.bounds[len(h.bounds)-1]
+}
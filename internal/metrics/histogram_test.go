@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 0.5, 1})
+
+	for range 90 {
+		h.Observe(50 * time.Millisecond)
+	}
+	for range 10 {
+		h.Observe(800 * time.Millisecond)
+	}
+
+	if p50 := h.Quantile(0.5); math.Abs(p50-0.0556) > 0.001 {
+		t.Errorf("Expected p50 to be in the first bucket, got %v", p50)
+	}
+
+	if p95 := h.Quantile(0.95); math.Abs(p95-0.75) > 0.001 {
+		t.Errorf("Expected p95 to be halfway through the third bucket, got %v", p95)
+	}
+
+	h.Observe(5 * time.Second)
+	if p100 := h.Quantile(1); p100 != 1 {
+		t.Errorf("Expected observations above the last bound to be reported as the last bound, got %v", p100)
+	}
+
+	buckets := h.Buckets()
+	if len(buckets) != 4 || buckets[3].LE != "+Inf" || buckets[3].Count != 101 || buckets[0].Count != 90 {
+		t.Errorf("Unexpected buckets %+v", buckets)
+	}
+}
+
+func TestSlidingWindowOnlyCountsRecentUpdates(t *testing.T) {
+	var w slidingWindow
+	now := time.Now()
+
+	w.record(now.Add(-2*time.Hour), true, time.Second)
+	w.record(now.Add(-30*time.Minute), false, time.Second)
+	w.record(now, true, 3*time.Second)
+
+	if stats := w.stats(now, 5*time.Minute); stats.Updates != 1 || stats.Failures != 1 {
+		t.Errorf("Expected a single failed update in the last 5 minutes, got %+v", stats)
+	}
+
+	stats := w.stats(now, time.Hour)
+	if stats.Updates != 2 || stats.FailureRate != 0.5 || stats.AverageUpdateMS != 2000 {
+		t.Errorf("Unexpected stats for the last hour %+v", stats)
+	}
+
+	// Minutes without updates don't take up a slot and the ones older than a day get dropped
+	w.record(now.Add(23*time.Hour), false, time.Second)
+	if len(w.slots) != 3 {
+		t.Errorf("Expected only the minutes with updates to have a slot, got %d", len(w.slots))
+	}
+
+	w.record(now.Add(24*time.Hour), false, time.Second)
+	if stats := w.stats(now.Add(24*time.Hour), 24*time.Hour); stats.Updates != 2 || stats.Failures != 0 || len(w.slots) != 2 {
+		t.Errorf("Expected the updates from more than a day ago to be dropped, got %+v from %d slots", stats, len(w.slots))
+	}
+}
@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+var processStartTime = time.Now()
+
+// WriteOpenMetrics writes all of the collected metrics along with Go runtime
+// stats in the OpenMetrics text format
+func (c *Collector) WriteOpenMetrics(w io.Writer) error {
+	e := &expositionWriter{}
+
+	c.writeRequestMetrics(e, "glance_http_request", "route", "Requests served by Glance", c.requests.snapshot())
+	c.writeRequestMetrics(e, "glance_upstream_request", "host", "Requests made by Glance to other services", c.upstreamRequests.snapshot())
+	c.writeWidgetMetrics(e)
+
+	e.family("glance_auth_failures", "counter", "Failed login attempts")
+	e.sample("glance_auth_failures_total", nil, float64(c.authFailures.Load()))
+
+	c.gaugesMu.Lock()
+	for _, g := range c.gauges {
+		e.family(g.name, "gauge", g.help)
+		e.sample(g.name, nil, g.value())
+	}
+	c.gaugesMu.Unlock()
+
+	writeRuntimeMetrics(e)
+
+	e.buf.WriteString("# EOF\n")
+
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+func (c *Collector) writeRequestMetrics(e *expositionWriter, prefix, targetLabel, help string, series map[requestKey]*Histogram) {
+	keys := make([]requestKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].target != keys[j].target {
+			return keys[i].target < keys[j].target
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	labels := func(key requestKey) []string {
+		return []string{targetLabel, key.target, "method", key.method, "code", key.status}
+	}
+
+	e.family(prefix+"s", "counter", help)
+	for _, key := range keys {
+		e.sample(prefix+"s_total", labels(key), float64(series[key].Count()))
+	}
+
+	e.family(prefix+"_duration_seconds", "histogram", help+", by how long they took")
+	for _, key := range keys {
+		e.histogram(prefix+"_duration_seconds", labels(key), series[key])
+	}
+}
+
+func (c *Collector) writeWidgetMetrics(e *expositionWriter) {
+	c.mu.RLock()
+	widgets := make([]*WidgetMetrics, 0, len(c.widgets))
+	for _, metrics := range c.widgets {
+		widgets = append(widgets, metrics)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(widgets, func(i, j int) bool {
+		return widgets[i].WidgetID < widgets[j].WidgetID
+	})
+
+	type widgetSnapshot struct {
+		labels     []string
+		updates    map[Outcome]int64
+		durations  *Histogram
+		lastUpdate time.Time
+	}
+
+	snapshots := make([]widgetSnapshot, len(widgets))
+	for i, metrics := range widgets {
+		metrics.mu.RLock()
+		snapshots[i] = widgetSnapshot{
+			labels: []string{"widget_id", metrics.WidgetID, "widget_type", metrics.WidgetType},
+			updates: map[Outcome]int64{
+				OutcomeSuccess: metrics.SuccessCount,
+				OutcomePartial: metrics.PartialCount,
+				OutcomeError:   metrics.ErrorCount,
+			},
+			durations:  metrics.durations.clone(),
+			lastUpdate: metrics.LastUpdateTime,
+		}
+		metrics.mu.RUnlock()
+	}
+
+	e.family("glance_widget_updates", "counter", "Widget updates by their outcome")
+	for _, snapshot := range snapshots {
+		for _, outcome := range []Outcome{OutcomeSuccess, OutcomePartial, OutcomeError} {
+			e.sample("glance_widget_updates_total", append(snapshot.labels, "outcome", string(outcome)), float64(snapshot.updates[outcome]))
+		}
+	}
+
+	e.family("glance_widget_update_duration_seconds", "histogram", "How long widget updates took")
+	for _, snapshot := range snapshots {
+		e.histogram("glance_widget_update_duration_seconds", snapshot.labels, snapshot.durations)
+	}
+
+	e.family("glance_widget_last_update_timestamp_seconds", "gauge", "When widgets were last updated")
+	for _, snapshot := range snapshots {
+		e.sample("glance_widget_last_update_timestamp_seconds", snapshot.labels, float64(snapshot.lastUpdate.UnixMilli())/1000)
+	}
+}
+
+func writeRuntimeMetrics(e *expositionWriter) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	// Samples of info families are named after the family with _info added to it
+	e.family("go", "info", "Information about the Go environment")
+	e.sample("go_info", []string{"version", runtime.Version()}, 1)
+
+	e.family("go_goroutines", "gauge", "Number of goroutines that currently exist")
+	e.sample("go_goroutines", nil, float64(runtime.NumGoroutine()))
+
+	e.family("go_memstats_alloc_bytes", "gauge", "Bytes of allocated heap objects")
+	e.sample("go_memstats_alloc_bytes", nil, float64(m.Alloc))
+
+	e.family("go_memstats_heap_inuse_bytes", "gauge", "Bytes in in-use heap spans")
+	e.sample("go_memstats_heap_inuse_bytes", nil, float64(m.HeapInuse))
+
+	e.family("go_memstats_sys_bytes", "gauge", "Bytes of memory obtained from the OS")
+	e.sample("go_memstats_sys_bytes", nil, float64(m.Sys))
+
+	e.family("go_gc_cycles", "counter", "Completed GC cycles")
+	e.sample("go_gc_cycles_total", nil, float64(m.NumGC))
+
+	e.family("go_gc_pause_seconds", "counter", "Total time spent in GC stop-the-world pauses")
+	e.sample("go_gc_pause_seconds_total", nil, float64(m.PauseTotalNs)/float64(time.Second))
+
+	e.family("process_start_time_seconds", "gauge", "Start time of the process since the Unix epoch")
+	e.sample("process_start_time_seconds", nil, float64(processStartTime.Unix()))
+}
+
+type expositionWriter struct {
+	buf bytes.Buffer
+}
+
+func (e *expositionWriter) family(name, metricType, help string) {
+	e.buf.WriteString("# TYPE " + name + " " + metricType + "\n")
+	e.buf.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+}
+
+// Labels are given as name and value pairs
+func (e *expositionWriter) sample(name string, labels []string, value float64) {
+	e.buf.WriteString(name)
+
+	if len(labels) > 0 {
+		e.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.buf.WriteString(labels[i] + `="` + escapeLabelValue(labels[i+1]) + `"`)
+		}
+		e.buf.WriteByte('}')
+	}
+
+	e.buf.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+func (e *expositionWriter) histogram(name string, labels []string, h *Histogram) {
+	for _, bucket := range h.Buckets() {
+		e.sample(name+"_bucket", append(labels[:len(labels):len(labels)], "le", bucket.LE), float64(bucket.Count))
+	}
+
+	e.sample(name+"_count", labels, float64(h.Count()))
+	e.sample(name+"_sum", labels, h.Sum())
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	collector := NewCollector()
+	collector.RecordRequest("GET /{page}", "GET", 200, 100*time.Millisecond)
+	collector.RecordRequest("GET /{page}", "GET", 200, 300*time.Millisecond)
+	collector.RecordUpstreamRequest("example.com", "GET", 0, time.Second)
+	collector.RecordUpdate(Update{WidgetID: `say "hi"`, WidgetType: "rss", Duration: time.Second, Outcome: OutcomeError, Err: errors.New("failed")})
+	collector.RecordAuthFailure()
+	collector.RegisterGauge("glance_test_gauge", "A test gauge", func() float64 { return 3 })
+
+	var buf bytes.Buffer
+	if err := collector.WriteOpenMetrics(&buf); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		`glance_http_requests_total{route="GET /{page}",method="GET",code="200"} 2`,
+		`glance_http_request_duration_seconds_sum{route="GET /{page}",method="GET",code="200"} 0.4`,
+		`glance_upstream_requests_total{host="example.com",method="GET",code="error"} 1`,
+		`glance_widget_updates_total{widget_id="say \"hi\"",widget_type="rss",outcome="error"} 1`,
+		`glance_widget_updates_total{widget_id="say \"hi\"",widget_type="rss",outcome="success"} 0`,
+		`glance_auth_failures_total 1`,
+		`glance_test_gauge 3`,
+		"# TYPE go_goroutines gauge",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected output to contain %q", line)
+		}
+	}
+
+	if !strings.HasSuffix(output, "# EOF\n") {
+		t.Error("Expected output to end with # EOF")
+	}
+}
+
+// Suffixes that the names of samples can have on top of the name of their family, by the type of the family
+var openMetricsSampleSuffixes = map[string][]string{
+	"counter":   {"_total", "_created"},
+	"gauge":     {""},
+	"histogram": {"_bucket", "_count", "_sum", "_created"},
+	"info":      {"_info"},
+}
+
+func TestOpenMetricsSamplesBelongToTheirFamilies(t *testing.T) {
+	collector := NewCollector()
+	collector.RecordRequest("GET /{page}", "GET", 200, 100*time.Millisecond)
+	collector.RecordUpstreamRequest("example.com", "GET", 0, time.Second)
+	collector.RecordUpdate(Update{WidgetID: "weather", WidgetType: "weather", Duration: time.Second, Outcome: OutcomeSuccess})
+	collector.RegisterGauge("glance_test_gauge", "A test gauge", func() float64 { return 3 })
+
+	var buf bytes.Buffer
+	if err := collector.WriteOpenMetrics(&buf); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	output := buf.String()
+	for _, line := range []string{"# TYPE go info", `go_info{version="` + runtime.Version() + `"} 1`} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected output to contain %q", line)
+		}
+	}
+
+	family, familyType := "", ""
+	samples := 0
+
+	for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		if fields, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			family, familyType, _ = strings.Cut(fields, " ")
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name := line[:strings.IndexAny(line, "{ ")]
+		samples++
+
+		// Scrapers reject the whole exposition when a sample doesn't match the family it's under
+		suffixes, known := openMetricsSampleSuffixes[familyType]
+		if !known || !slices.ContainsFunc(suffixes, func(suffix string) bool { return name == family+suffix }) {
+			t.Errorf("Sample %s doesn't belong to the %s family %s", name, familyType, family)
+		}
+	}
+
+	if samples == 0 {
+		t.Error("Expected samples to be written")
+	}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+type requestKey struct {
+	// The route of incoming requests or the host of outgoing ones
+	target string
+	method string
+	// The status code of the response or "error" if there wasn't one
+	status string
+}
+
+type requestSeries struct {
+	mu     sync.Mutex
+	series map[requestKey]*Histogram
+}
+
+func newRequestSeries() *requestSeries {
+	return &requestSeries{series: make(map[requestKey]*Histogram)}
+}
+
+func (s *requestSeries) record(key requestKey, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	durations, exists := s.series[key]
+	if !exists {
+		durations = NewHistogram(DefaultBuckets)
+		s.series[key] = durations
+	}
+
+	durations.Observe(duration)
+}
+
+func (s *requestSeries) snapshot() map[requestKey]*Histogram {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[requestKey]*Histogram, len(s.series))
+	for key, durations := range s.series {
+		result[key] = durations.clone()
+	}
+
+	return result
+}
+
+// RecordRequest records a request served by Glance, the route should be the
+// pattern that matched the request rather than its path to keep the number
+// of series bounded
+func (c *Collector) RecordRequest(route, method string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+
+	c.requests.record(requestKey{route, method, strconv.Itoa(status)}, duration)
+}
+
+// RecordUpstreamRequest records a request made by Glance to another service,
+// status should be 0 if the request failed without a response
+func (c *Collector) RecordUpstreamRequest(host, method string, status int, duration time.Duration) {
+	statusLabel := "error"
+	if status > 0 {
+		statusLabel = strconv.Itoa(status)
+	}
+
+	c.upstreamRequests.record(requestKey{host, method, statusLabel}, duration)
+}
+
+func (c *Collector) RecordAuthFailure() {
+	c.authFailures.Add(1)
+}
+
+type gauge struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+// RegisterGauge adds a value that gets read every time the metrics are exposed
+func (c *Collector) RegisterGauge(name, help string, value func() float64) {
+	c.gaugesMu.Lock()
+	defer c.gaugesMu.Unlock()
+
+	c.gauges = append(c.gauges, gauge{name, help, value})
+}
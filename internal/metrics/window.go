@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// WindowStats summarizes the updates of a widget within a recent period of time
+type WindowStats struct {
+	Updates         int64   `json:"updates"`
+	Failures        int64   `json:"failures"`
+	FailureRate     float64 `json:"failure_rate"`
+	UpdatesPerHour  float64 `json:"updates_per_hour"`
+	AverageUpdateMS float64 `json:"average_update_ms"`
+}
+
+// The windows reported by GetMetrics, none can be longer than slidingWindowMinutes
+var reportedWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+}
+
+const slidingWindowMinutes = 24 * 60
+
+type windowSlot struct {
+	// Minutes since the Unix epoch
+	minute   int64
+	updates  uint32
+	failures uint32
+	duration time.Duration
+}
+
+// Keeps per minute counts for the last day. Only the minutes in which there were
+// updates get a slot, so widgets that update rarely or not at all take up little memory.
+type slidingWindow struct {
+	// Ordered from oldest to newest
+	slots []windowSlot
+}
+
+func (w *slidingWindow) record(now time.Time, failed bool, duration time.Duration) {
+	minute := now.Unix() / 60
+
+	// The clock could have gone backwards, in which case the slot goes where it belongs
+	i := len(w.slots)
+	for i > 0 && w.slots[i-1].minute > minute {
+		i--
+	}
+
+	if i == 0 || w.slots[i-1].minute != minute {
+		w.slots = slices.Insert(w.slots, i, windowSlot{minute: minute})
+		i++
+	}
+
+	slot := &w.slots[i-1]
+	slot.updates++
+	if failed {
+		slot.failures++
+	}
+	slot.duration += duration
+
+	oldest := w.slots[len(w.slots)-1].minute - slidingWindowMinutes + 1
+	stale := 0
+	for stale < len(w.slots) && w.slots[stale].minute < oldest {
+		stale++
+	}
+
+	if stale > 0 {
+		w.slots = slices.Delete(w.slots, 0, stale)
+	}
+}
+
+func (w *slidingWindow) stats(now time.Time, window time.Duration) WindowStats {
+	current := now.Unix() / 60
+	oldest := current - int64(window/time.Minute) + 1
+
+	var stats WindowStats
+	var duration time.Duration
+
+	for i := range w.slots {
+		slot := &w.slots[i]
+		if slot.minute < oldest || slot.minute > current {
+			continue
+		}
+
+		stats.Updates += int64(slot.updates)
+		stats.Failures += int64(slot.failures)
+		duration += slot.duration
+	}
+
+	if stats.Updates > 0 {
+		stats.FailureRate = float64(stats.Failures) / float64(stats.Updates)
+		stats.AverageUpdateMS = float64(duration) / float64(stats.Updates) / float64(time.Millisecond)
+	}
+
+	stats.UpdatesPerHour = math.Round(float64(stats.Updates)/window.Hours()*100) / 100
+
+	return stats
+}